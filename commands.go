@@ -0,0 +1,360 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Max number of choices Discord accepts for autocompletion
+const AUTOCOMPLETE_LIMIT = 25
+
+// Deck option with autocompletion from the quiz list
+func deckOption(description string) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         "deck",
+		Description:  description,
+		Required:     true,
+		Autocomplete: true,
+	}
+}
+
+// Option to accept readings typed in romaji
+var romajiOption = &discordgo.ApplicationCommandOption{
+	Type:        discordgo.ApplicationCommandOptionBoolean,
+	Name:        "romaji",
+	Description: "Accept readings typed in romaji",
+}
+
+// Option to show hints when nobody answers
+var hintsOption = &discordgo.ApplicationCommandOption{
+	Type:        discordgo.ApplicationCommandOptionBoolean,
+	Name:        "hints",
+	Description: "Show hints when nobody answers, for fewer points",
+}
+
+// Option to ask for the questions by their meaning or reading
+var reverseOption = &discordgo.ApplicationCommandOption{
+	Type:        discordgo.ApplicationCommandOptionBoolean,
+	Name:        "reverse",
+	Description: "Show the meaning or reading and answer with the word",
+}
+
+// Application (slash) commands mirroring the most used prefix commands
+var slashCommands = []*discordgo.ApplicationCommand{
+	{
+		Name:        "quiz",
+		Description: "Start a quiz in this channel",
+		Options: []*discordgo.ApplicationCommandOption{
+			deckOption("Deck to play"),
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "mode",
+				Description: "Game mode, the server's default speed if not given",
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "quiz (2s answer window)", Value: "quiz"},
+					{Name: "mad (0s answer window)", Value: "mad"},
+					{Name: "fast (1s answer window)", Value: "fast"},
+					{Name: "mild (3s answer window)", Value: "mild"},
+					{Name: "slow (5s answer window)", Value: "slow"},
+					{Name: "flash (no pause between questions)", Value: "flash"},
+					{Name: "multi (score on multiple answers)", Value: "multi"},
+					{Name: "choice (multiple choice with buttons)", Value: "choice"},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "score",
+				Description: "Score needed to win",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "range",
+				Description: "Play questions in deck order, e.g. 1-100",
+			},
+			romajiOption,
+			hintsOption,
+			reverseOption,
+		},
+	},
+	{
+		Name:        "stop",
+		Description: "Stop the quiz running in this channel",
+	},
+	{
+		Name:        "list",
+		Description: "List available quiz decks",
+	},
+	{
+		Name:        "info",
+		Description: "Show information about a quiz deck",
+		Options: []*discordgo.ApplicationCommandOption{
+			deckOption("Deck to describe"),
+		},
+	},
+	{
+		Name:        "kanji",
+		Description: "Look up a kanji",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "kanji",
+				Description: "Kanji to look up",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "pitch",
+		Description: "Look up the pitch accent of a word",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "word",
+				Description: "Word to look up",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "frequency",
+		Description: "Look up how common a word is",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "word",
+				Description: "Word to look up",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "gauntlet",
+		Description: "Start a kanji time trial, in DM only",
+		Options: []*discordgo.ApplicationCommandOption{
+			deckOption("Deck to play"),
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "minutes",
+				Description: "Time limit in minutes, unranked if given",
+				MinValue:    &[]float64{1}[0],
+			},
+			romajiOption,
+		},
+	},
+	{
+		Name:        "scramble",
+		Description: "Start an English Word Scramble quiz in this channel",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "difficulty",
+				Description: "Word lengths to play with, normal by default",
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "easy", Value: "easy"},
+					{Name: "normal", Value: "normal"},
+					{Name: "hard", Value: "hard"},
+					{Name: "insane", Value: "insane"},
+				},
+			},
+		},
+	},
+}
+
+// Register the application commands with Discord, replacing any old ones
+func registerCommands(s *discordgo.Session) {
+	if _, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, "", slashCommands); err != nil {
+		log.Println("ERROR, Could not register application commands:", err)
+	}
+}
+
+// This function will be called (due to AddHandler above) every time an
+// application command is used or needs autocompletion
+func interactionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	switch i.Type {
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		autocompleteDeck(s, i)
+	case discordgo.InteractionApplicationCommand:
+		runCommand(s, i)
+	}
+}
+
+// Suggest deck names matching what's been typed so far
+func autocompleteDeck(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var typed string
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Focused {
+			typed = strings.ToLower(option.StringValue())
+		}
+	}
+
+	quizlist := guildQuizlist(i.GuildID)
+	sort.Strings(quizlist)
+
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, AUTOCOMPLETE_LIMIT)
+	for _, name := range quizlist {
+		if strings.Contains(name, typed) {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: name})
+			if len(choices) >= AUTOCOMPLETE_LIMIT {
+				break
+			}
+		}
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		log.Println("ERROR, Could not send autocompletion:", err)
+	}
+}
+
+// Stand-in for the message a prefix command would have come in, so that the
+// same handlers can serve both
+func interactionMessage(i *discordgo.InteractionCreate) *discordgo.MessageCreate {
+	author := i.User
+	if i.Member != nil {
+		author = i.Member.User
+	}
+
+	return &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:        i.ID,
+		ChannelID: i.ChannelID,
+		GuildID:   i.GuildID,
+		Author:    author,
+	}}
+}
+
+// Run an application command, with replies going to the channel the same way
+// as for prefix commands
+func runCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	m := interactionMessage(i)
+	t := discordTransport{s}
+
+	options := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+	for _, option := range data.Options {
+		options[option.Name] = option
+	}
+
+	stringOption := func(name, fallback string) string {
+		if option, ok := options[name]; ok {
+			return strings.ToLower(strings.TrimSpace(option.StringValue()))
+		}
+		return fallback
+	}
+
+	intOption := func(name string) string {
+		if option, ok := options[name]; ok {
+			return strconv.FormatInt(option.IntValue(), 10)
+		}
+		return ""
+	}
+
+	var opts GameOptions
+	if option, ok := options["romaji"]; ok {
+		opts.Romaji = option.BoolValue()
+	}
+	if option, ok := options["hints"]; ok {
+		opts.Hints = option.BoolValue()
+	}
+	if option, ok := options["reverse"]; ok {
+		opts.Reverse = option.BoolValue()
+	}
+
+	// Acknowledge privately, anything else would be sent to the channel twice
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		log.Println("ERROR, Could not acknowledge command:", err)
+		return
+	}
+
+	// Some commands are only for moderators and admins
+	if allowed, level := commandAllowed(s, m, data.Name); !allowed {
+		finishCommand(s, i, permissionMsg(level)+m.Author.Mention())
+		return
+	}
+
+	var reply string
+	switch data.Name {
+	case "quiz":
+		if !isBotChannel(s, m) {
+			err = fmt.Errorf("Quizzes can't be started in this channel")
+			break
+		}
+		mode := stringOption("mode", "quiz")
+		if _, given := options["mode"]; !given && len(getGuildConfig(m.GuildID).Speed) > 0 {
+			// Servers may prefer another speed for regular quizzes
+			mode = getGuildConfig(m.GuildID).Speed
+		}
+		speed, ok := Settings.Speed[mode]
+		if !ok {
+			err = fmt.Errorf("Unknown game mode: %s", mode)
+			break
+		}
+		if mode == "multi" {
+			go runMultiQuiz(t, m.ChannelID, m.Author.ID, stringOption("deck", ""), intOption("score"), speed[0], speed[1], opts)
+		} else if mode == "choice" {
+			go runChoiceQuiz(t, m.ChannelID, m.Author.ID, stringOption("deck", ""), intOption("score"), speed[0], speed[1], opts)
+		} else if start := stringOption("range", ""); len(start) > 0 {
+			go runQuizSequential(t, m.ChannelID, m.Author.ID, stringOption("deck", ""), start, speed[0], speed[0], opts)
+		} else {
+			go runQuiz(t, m.ChannelID, m.Author.ID, stringOption("deck", ""), intOption("score"), speed[0], speed[1], opts)
+		}
+	case "stop":
+		reply, err = stopGame(m.ChannelID, m.Author.ID, permissionLevel(s, m.GuildID, m.ChannelID, m.Author.ID))
+	case "list":
+		showList(s, m)
+	case "info":
+		_, err = quizInfo(s, m.ChannelID, stringOption("deck", ""))
+	case "kanji":
+		_, err = sendKanjiInfo(s, m.ChannelID, stringOption("kanji", ""))
+	case "pitch":
+		_, err = sendPitchInfo(s, m.ChannelID, stringOption("word", ""))
+	case "frequency":
+		_, err = sendWordFrequencyInfo(s, m.ChannelID, stringOption("word", ""))
+	case "gauntlet":
+		if !isBotChannel(s, m) {
+			err = fmt.Errorf("Gauntlets can't be started in this channel")
+			break
+		}
+		go runGauntlet(t, m, stringOption("deck", ""), intOption("minutes"), opts)
+	case "scramble":
+		if !isBotChannel(s, m) {
+			err = fmt.Errorf("Quizzes can't be started in this channel")
+			break
+		}
+		go runScramble(t, m.ChannelID, m.Author.ID, stringOption("difficulty", ""))
+	default:
+		err = fmt.Errorf("Unknown command: %s", data.Name)
+	}
+
+	if err != nil {
+		reply = "Error: " + err.Error()
+	}
+
+	finishCommand(s, i, reply)
+}
+
+// Show the player a reply to their command, or clear away the acknowledgement
+// if there's nothing to say
+func finishCommand(s *discordgo.Session, i *discordgo.InteractionCreate, reply string) {
+	var err error
+	if len(reply) > 0 {
+		_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &reply})
+	} else {
+		err = s.InteractionResponseDelete(i.Interaction)
+	}
+	if err != nil {
+		log.Println("ERROR, Could not finish command response:", err)
+	}
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Filename for persisted guild settings
+const GUILDS_FILE = "guilds.json"
+
+// Settings a server can change for itself, zero values mean the bot's defaults
+type GuildConfig struct {
+	Prefix   string   `json:"prefix,omitempty"`    // Command prefix instead of CMD_PREFIX
+	Channels []string `json:"channels,omitempty"`  // Channels allowed to host quizzes instead of #bot*
+	Output   string   `json:"output,omitempty"`    // Channel for Gauntlet score announcements
+	WinLimit int      `json:"win_limit,omitempty"` // Score needed to win by default
+	Speed    string   `json:"speed,omitempty"`     // Speed preset used by the quiz command
+	Disabled []string `json:"disabled,omitempty"`  // Decks that can't be played
+
+	Moderators []string `json:"moderators,omitempty"` // Roles allowed to moderate quizzes
+	NoRomaji   bool     `json:"no_romaji,omitempty"`  // Never accept romaji, for competitive play
+
+	Render *RenderOptions `json:"render,omitempty"` // How to draw questions, unless the deck says otherwise
+}
+
+// Guilds keeps track of every server's settings
+var Guilds struct {
+	sync.RWMutex
+	ID map[string]*GuildConfig
+}
+
+// Serializes writes of the guilds file
+var guildsWriter sync.Mutex
+
+// Returns a copy of a guild's settings, defaults for DM
+func getGuildConfig(guildID string) (cfg GuildConfig) {
+	Guilds.RLock()
+	if gc := Guilds.ID[guildID]; gc != nil {
+		cfg = *gc
+		cfg.Channels = append([]string(nil), gc.Channels...)
+		cfg.Disabled = append([]string(nil), gc.Disabled...)
+		cfg.Moderators = append([]string(nil), gc.Moderators...)
+		if gc.Render != nil {
+			render := *gc.Render
+			cfg.Render = &render
+		}
+	}
+	Guilds.RUnlock()
+
+	return cfg
+}
+
+// Change a guild's settings and save them to disk
+func updateGuildConfig(guildID string, update func(cfg *GuildConfig)) {
+	Guilds.Lock()
+	if Guilds.ID == nil {
+		Guilds.ID = make(map[string]*GuildConfig)
+	}
+	if Guilds.ID[guildID] == nil {
+		Guilds.ID[guildID] = &GuildConfig{}
+	}
+	update(Guilds.ID[guildID])
+	Guilds.Unlock()
+
+	writeGuilds()
+}
+
+// Command prefix used in given guild
+func guildPrefix(guildID string) string {
+	if prefix := getGuildConfig(guildID).Prefix; len(prefix) > 0 {
+		return prefix
+	}
+
+	return CMD_PREFIX
+}
+
+// Check whether a deck, or any deck combined into it, is disabled in given guild
+// Quiz list entries made of other decks count as combined too
+func isDeckDisabled(guildID, quizname string) bool {
+	disabled := getGuildConfig(guildID).Disabled
+	if hasString(disabled, strings.ToLower(quizname)) {
+		return true
+	}
+
+	for _, name := range deckNames(quizname) {
+		if hasString(disabled, strings.ToLower(name)) {
+			return true
+		}
+
+		Quizzes.RLock()
+		expr := Quizzes.Map[name]
+		Quizzes.RUnlock()
+		if !isDeckExpr(expr) {
+			continue
+		}
+		for _, inner := range deckNames(expr) {
+			if hasString(disabled, strings.ToLower(inner)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Channels to announce a player's Gauntlet scores in
+func gauntletOutputs(t Transport, userID string) []string {
+	var outputs []string
+
+	// Bot-wide announcement channel from before guilds had their own
+	if legacy := getStorage("output"); len(legacy) != 0 {
+		outputs = append(outputs, legacy)
+	}
+
+	Guilds.RLock()
+	candidates := make(map[string]string)
+	for guildID, cfg := range Guilds.ID {
+		if len(cfg.Output) > 0 && !hasString(outputs, cfg.Output) {
+			candidates[guildID] = cfg.Output
+		}
+	}
+	Guilds.RUnlock()
+
+	// Membership lookups can be slow, so do them outside the lock
+	for guildID, output := range candidates {
+		if t.IsMember(guildID, userID) {
+			outputs = append(outputs, output)
+		}
+	}
+
+	return outputs
+}
+
+// Extract a channel ID from a channel mention
+func parseChannel(arg string) (string, bool) {
+	id := strings.TrimSuffix(strings.TrimPrefix(arg, "<#"), ">")
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return "", false
+	}
+
+	return id, true
+}
+
+// Extract a role ID from a role mention
+func parseRole(arg string) (string, bool) {
+	id := strings.TrimSuffix(strings.TrimPrefix(arg, "<@&"), ">")
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return "", false
+	}
+
+	return id, true
+}
+
+// Show or change the settings of the current guild
+func runConfig(s *discordgo.Session, m *discordgo.MessageCreate, input []string) (sent *discordgo.Message) {
+
+	if len(m.GuildID) == 0 {
+		return msgSend(s, m.ChannelID, "Settings can only be changed in a server!")
+	}
+
+	prefix := guildPrefix(m.GuildID)
+
+	if len(input) < 2 {
+		return showConfig(s, m)
+	}
+
+	if permissionLevel(s, m.GuildID, m.ChannelID, m.Author.ID) < PERM_MANAGER {
+		return msgSend(s, m.ChannelID, permissionMsg(PERM_MANAGER)+m.Author.Mention())
+	}
+
+	setting := input[1]
+	args := input[2:]
+	reset := len(args) == 1 && args[0] == "default"
+
+	var err error
+	switch setting {
+	case "prefix":
+		if len(args) != 1 || len(args[0]) > 10 {
+			err = fmt.Errorf("Use `%sconfig prefix <prefix>` with up to 10 characters", prefix)
+			break
+		}
+		updateGuildConfig(m.GuildID, func(cfg *GuildConfig) {
+			cfg.Prefix = ""
+			if !reset {
+				cfg.Prefix = args[0]
+			}
+		})
+	case "channels":
+		var channels []string
+		if !reset {
+			for _, arg := range args {
+				id, ok := parseChannel(arg)
+				if !ok {
+					err = fmt.Errorf("Not a channel: %s", arg)
+					break
+				}
+				channels = append(channels, id)
+			}
+			if err == nil && len(channels) == 0 {
+				err = fmt.Errorf("Use `%sconfig channels <#channel> [#channel...]`, or `default` for #bot channels", prefix)
+			}
+			if err != nil {
+				break
+			}
+		}
+		updateGuildConfig(m.GuildID, func(cfg *GuildConfig) {
+			cfg.Channels = channels
+		})
+	case "moderators":
+		var roles []string
+		if !reset {
+			for _, arg := range args {
+				id, ok := parseRole(arg)
+				if !ok {
+					err = fmt.Errorf("Not a role: %s", arg)
+					break
+				}
+				roles = append(roles, id)
+			}
+			if err == nil && len(roles) == 0 {
+				err = fmt.Errorf("Use `%sconfig moderators <@role> [@role...]`, or `default` for none", prefix)
+			}
+			if err != nil {
+				break
+			}
+		}
+		updateGuildConfig(m.GuildID, func(cfg *GuildConfig) {
+			cfg.Moderators = roles
+		})
+	case "output":
+		output := m.ChannelID
+		if len(args) == 1 {
+			if args[0] == "none" || reset {
+				output = ""
+			} else if id, ok := parseChannel(args[0]); ok {
+				output = id
+			} else {
+				err = fmt.Errorf("Not a channel: %s", args[0])
+				break
+			}
+		}
+		updateGuildConfig(m.GuildID, func(cfg *GuildConfig) {
+			cfg.Output = output
+		})
+	case "winlimit":
+		winLimit := 0
+		if !reset {
+			if len(args) != 1 {
+				err = fmt.Errorf("Use `%sconfig winlimit <score>`", prefix)
+				break
+			}
+			winLimit, err = strconv.Atoi(args[0])
+			if err != nil || winLimit < 1 {
+				err = fmt.Errorf("Not a valid score: %s", args[0])
+				break
+			}
+		}
+		updateGuildConfig(m.GuildID, func(cfg *GuildConfig) {
+			cfg.WinLimit = winLimit
+		})
+	case "speed":
+		var speed string
+		if !reset {
+			if len(args) == 1 {
+				speed = args[0]
+			}
+			if _, ok := Settings.Speed[speed]; !ok || speed == "multi" || speed == "choice" {
+				err = fmt.Errorf("Use `%sconfig speed <flash/mad/fast/quiz/mild/slow>`", prefix)
+				break
+			}
+		}
+		updateGuildConfig(m.GuildID, func(cfg *GuildConfig) {
+			cfg.Speed = speed
+		})
+	case "romaji":
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off" && !reset) {
+			err = fmt.Errorf("Use `%sconfig romaji <on/off>`", prefix)
+			break
+		}
+		updateGuildConfig(m.GuildID, func(cfg *GuildConfig) {
+			cfg.NoRomaji = args[0] == "off"
+		})
+	case "render":
+		var render *RenderOptions
+		if !reset {
+			usage := fmt.Errorf("Use `%sconfig render <theme/size/vertical/font/noise> <value>`, or `default` to draw questions the usual way", prefix)
+			if len(args) != 2 {
+				err = usage
+				break
+			}
+
+			opts := RenderOptions{}.with(getGuildConfig(m.GuildID).Render)
+			value := args[1]
+			switch args[0] {
+			case "theme":
+				opts.Theme = value
+			case "size", "noise":
+				number, parseErr := strconv.ParseFloat(value, 64)
+				if parseErr != nil {
+					err = fmt.Errorf("Not a number: %s", value)
+				} else if args[0] == "size" {
+					opts.Size = number
+				} else {
+					opts.Noise = number
+				}
+			case "vertical":
+				if value != "on" && value != "off" {
+					err = fmt.Errorf("Use `%sconfig render vertical <on/off>`", prefix)
+				}
+				opts.Vertical = value == "on"
+			case "font":
+				opts.Font = value
+				if value == "default" {
+					opts.Font = ""
+				}
+			default:
+				err = usage
+			}
+			if err == nil {
+				err = opts.validate()
+			}
+			if err != nil {
+				break
+			}
+			if opts != (RenderOptions{}) {
+				render = &opts
+			}
+		}
+		updateGuildConfig(m.GuildID, func(cfg *GuildConfig) {
+			cfg.Render = render
+		})
+	case "disable", "enable":
+		if len(args) == 0 {
+			err = fmt.Errorf("Use `%sconfig %s <deck> [deck...]`", prefix, setting)
+			break
+		}
+		updateGuildConfig(m.GuildID, func(cfg *GuildConfig) {
+			for _, deck := range args {
+				if setting == "disable" && !hasString(cfg.Disabled, deck) {
+					cfg.Disabled = append(cfg.Disabled, deck)
+				} else if setting == "enable" {
+					cfg.Disabled = removeString(cfg.Disabled, deck)
+				}
+			}
+			sort.Strings(cfg.Disabled)
+		})
+	default:
+		err = fmt.Errorf("Unknown setting: %s", setting)
+	}
+
+	if err != nil {
+		return msgSend(s, m.ChannelID, "Error: "+err.Error())
+	}
+
+	return showConfig(s, m)
+}
+
+// Show the settings of the current guild
+func showConfig(s *discordgo.Session, m *discordgo.MessageCreate) (sent *discordgo.Message) {
+	cfg := getGuildConfig(m.GuildID)
+	prefix := guildPrefix(m.GuildID)
+
+	channels := "#bot channels"
+	if len(cfg.Channels) > 0 {
+		channels = "<#" + strings.Join(cfg.Channels, "> <#") + ">"
+	}
+
+	moderators := "None"
+	if len(cfg.Moderators) > 0 {
+		moderators = "<@&" + strings.Join(cfg.Moderators, "> <@&") + ">"
+	}
+
+	output := "None"
+	if len(cfg.Output) > 0 {
+		output = "<#" + cfg.Output + ">"
+	}
+
+	winLimit := "15"
+	if cfg.WinLimit > 0 {
+		winLimit = strconv.Itoa(cfg.WinLimit)
+	}
+
+	speed := "quiz"
+	if len(cfg.Speed) > 0 {
+		speed = cfg.Speed
+	}
+
+	romaji := "on"
+	if cfg.NoRomaji {
+		romaji = "off"
+	}
+
+	disabled := "None"
+	if len(cfg.Disabled) > 0 {
+		disabled = truncate(strings.Join(cfg.Disabled, ", "), 1024)
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Type:        "rich",
+		Title:       UNICODE_INFO + " Server Settings",
+		Color:       0xFADE40,
+		Description: fmt.Sprintf("Use `%sconfig <setting> <value>` to change, or `default` to reset.", prefix),
+		Fields: []*discordgo.MessageEmbedField{
+			&discordgo.MessageEmbedField{Name: "prefix", Value: prefix, Inline: true},
+			&discordgo.MessageEmbedField{Name: "winlimit", Value: winLimit, Inline: true},
+			&discordgo.MessageEmbedField{Name: "speed", Value: speed, Inline: true},
+			&discordgo.MessageEmbedField{Name: "romaji", Value: romaji, Inline: true},
+			&discordgo.MessageEmbedField{Name: "channels", Value: channels, Inline: false},
+			&discordgo.MessageEmbedField{Name: "moderators", Value: moderators, Inline: false},
+			&discordgo.MessageEmbedField{Name: "output", Value: output, Inline: false},
+			&discordgo.MessageEmbedField{Name: "render", Value: RenderOptions{}.with(cfg.Render).String(), Inline: false},
+			&discordgo.MessageEmbedField{Name: "disable/enable", Value: disabled, Inline: false},
+		},
+	}
+
+	return embedSend(s, m.ChannelID, embed)
+}
+
+// Returns list without any occurrences of given string
+func removeString(list []string, s string) []string {
+	var result []string
+	for _, item := range list {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+// Writes guild settings as JSON to disk
+func writeGuilds() {
+	guildsWriter.Lock()
+	defer guildsWriter.Unlock()
+
+	Guilds.RLock()
+	b, err := json.Marshal(Guilds.ID)
+	Guilds.RUnlock()
+	if err != nil {
+		log.Println("ERROR, Could not marshal Guilds to json:", err)
+		return
+	}
+
+	if err = writeFileAtomic(GUILDS_FILE, b); err != nil {
+		log.Println("ERROR, Could not write Guilds file to disk:", err)
+	}
+}
+
+// Load guild settings from JSON on disk
+func loadGuilds() {
+
+	Guilds.Lock()
+	defer Guilds.Unlock()
+
+	Guilds.ID = make(map[string]*GuildConfig)
+
+	file, err := ioutil.ReadFile(GUILDS_FILE)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("ERROR, Reading Guilds json:", err)
+		}
+		return
+	}
+
+	if err = json.Unmarshal(file, &Guilds.ID); err != nil {
+		log.Println("ERROR, Unmarshalling Guilds json:", err)
+	}
+}
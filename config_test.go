@@ -0,0 +1,150 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Use the given guild settings instead of the ones on disk
+func withGuilds(t *testing.T, guilds map[string]*GuildConfig) {
+	Guilds.Lock()
+	saved := Guilds.ID
+	Guilds.ID = guilds
+	Guilds.Unlock()
+
+	t.Cleanup(func() {
+		Guilds.Lock()
+		Guilds.ID = saved
+		Guilds.Unlock()
+	})
+}
+
+// Transport where players are members of the given guilds
+type memberTransport struct {
+	*fakeTransport
+	members map[string][]string // Guild ID -> user IDs
+}
+
+func (mt memberTransport) IsMember(guildID, userID string) bool {
+	return hasString(mt.members[guildID], userID)
+}
+
+func TestIsDeckDisabled(t *testing.T) {
+	withGuilds(t, map[string]*GuildConfig{"g1": {Disabled: []string{"n5", "kanken_1k"}}})
+
+	// Quiz list entries made of other decks
+	Quizzes.Lock()
+	if Quizzes.Map == nil {
+		Quizzes.Map = make(map[string]string)
+	}
+	Quizzes.Map["_n54"] = "n5+n4"
+	Quizzes.Unlock()
+	t.Cleanup(func() {
+		Quizzes.Lock()
+		delete(Quizzes.Map, "_n54")
+		Quizzes.Unlock()
+	})
+
+	tests := []struct {
+		guild    string
+		deck     string
+		disabled bool
+	}{
+		{"g1", "n5", true},
+		{"g1", "N5", true},
+		{"g1", "n4", false},
+		{"g1", "n4+n5", true},
+		{"g1", "n4 + kanken_1k[tag:verb]", true},
+		{"g1", "n4+n3[jlpt=3]", false},
+		{"g1", "_n54", true},
+		{"g2", "n5", false},
+		{"", "n5+n4", false},
+	}
+
+	for _, test := range tests {
+		if disabled := isDeckDisabled(test.guild, test.deck); disabled != test.disabled {
+			t.Errorf("isDeckDisabled(%q, %q) = %v, expected %v", test.guild, test.deck, disabled, test.disabled)
+		}
+	}
+}
+
+func TestGetGuildConfig(t *testing.T) {
+	withGuilds(t, map[string]*GuildConfig{"g1": {
+		Prefix:     "!",
+		Channels:   []string{"1"},
+		Disabled:   []string{"n5"},
+		Moderators: []string{"2"},
+		Render:     &RenderOptions{Theme: "dark"},
+	}})
+
+	// Changing a copy leaves the settings alone
+	cfg := getGuildConfig("g1")
+	cfg.Channels[0] = "changed"
+	cfg.Disabled = append(cfg.Disabled[:0], "changed")
+	cfg.Moderators[0] = "changed"
+	cfg.Render.Theme = "light"
+	cfg.Prefix = "?"
+
+	expected := GuildConfig{
+		Prefix:     "!",
+		Channels:   []string{"1"},
+		Disabled:   []string{"n5"},
+		Moderators: []string{"2"},
+		Render:     &RenderOptions{Theme: "dark"},
+	}
+	if diff := cmp.Diff(expected, getGuildConfig("g1")); diff != "" {
+		t.Errorf("Settings changed through a copy (-want +got):\n%s", diff)
+	}
+
+	// Guilds without settings get the defaults
+	if diff := cmp.Diff(GuildConfig{}, getGuildConfig("g2")); diff != "" {
+		t.Errorf("Unexpected default settings (-want +got):\n%s", diff)
+	}
+	if prefix := guildPrefix("g2"); prefix != CMD_PREFIX {
+		t.Errorf("Expected the default prefix, got %s", prefix)
+	}
+}
+
+func TestGauntletOutputs(t *testing.T) {
+	withGuilds(t, map[string]*GuildConfig{
+		"g1": {Output: "c1"},
+		"g2": {Output: "c2"},
+		"g3": {Output: "legacy"},
+		"g4": {},
+	})
+
+	Storage.Lock()
+	saved := Storage.Map
+	Storage.Map = map[string]string{}
+	Storage.Unlock()
+	t.Cleanup(func() {
+		Storage.Lock()
+		Storage.Map = saved
+		Storage.Unlock()
+	})
+
+	mt := memberTransport{newFakeTransport(), map[string][]string{"g1": {"alice"}, "g2": {"bob"}, "g3": {"alice"}, "g4": {"alice"}}}
+
+	outputs := gauntletOutputs(mt, "alice")
+	sort.Strings(outputs)
+	if diff := cmp.Diff([]string{"c1", "legacy"}, outputs); diff != "" {
+		t.Errorf("Unexpected outputs (-want +got):\n%s", diff)
+	}
+
+	// The bot-wide channel from before guilds had their own comes first, and
+	// isn't announced in twice
+	Storage.Lock()
+	Storage.Map["output"] = "legacy"
+	Storage.Unlock()
+	if diff := cmp.Diff([]string{"legacy", "c1"}, gauntletOutputs(mt, "alice")); diff != "" {
+		t.Errorf("Unexpected outputs with the legacy channel (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"legacy", "c2"}, gauntletOutputs(mt, "bob")); diff != "" {
+		t.Errorf("Unexpected outputs for bob (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"legacy"}, gauntletOutputs(mt, "carol")); diff != "" {
+		t.Errorf("Unexpected outputs for a player in no guild (-want +got):\n%s", diff)
+	}
+}
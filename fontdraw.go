@@ -2,13 +2,21 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
 	"image/png"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"math"
+	"math/rand"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/golang/freetype/truetype"
 	"golang.org/x/image/font"
@@ -23,29 +31,366 @@ var (
 	fontTtf     *truetype.Font
 )
 
-// Load Font from disk
+// Fonts in resources for characters the main font lacks, tried in order,
+// like the rarer kanji of Extension A and B in kanken_1k and obscure
+var (
+	fontFallbacks = []string{"HanaMinA.ttf", "HanaMinB.ttf"}
+	fallbackTtfs  []*truetype.Font
+)
+
+// Limits for font sizes picked by decks and servers, in points
+const MIN_FONT_SIZE = 24
+const MAX_FONT_SIZE = 144
+
+// Fonts other than the main one, loaded when first asked for
+var Fonts struct {
+	sync.RWMutex
+	Map map[string]*truetype.Font
+}
+
+// Text and background colours of each theme
+var renderThemes = map[string][2]color.Color{
+	"light": {color.Black, color.White},
+	"dark":  {color.RGBA{0xdc, 0xdd, 0xde, 0xff}, color.RGBA{0x36, 0x39, 0x3f, 0xff}},
+}
+
+// Vertical forms of punctuation that would look wrong turned on its side
+var verticalForms = map[rune]rune{
+	'ー': '︱', '－': '︱', '—': '︱', '…': '︙', '‥': '︰',
+	'、': '︑', '。': '︒', '，': '︐', '：': '︓', '；': '︔', '！': '︕', '？': '︖',
+	'「': '﹁', '」': '﹂', '『': '﹃', '』': '﹄', '（': '︵', '）': '︶',
+	'【': '︻', '】': '︼', '〈': '︿', '〉': '﹀', '《': '︽', '》': '︾', '〔': '︹', '〕': '︺',
+}
+
+// RenderOptions change how question images are drawn, for decks in their
+// "render" block and for servers in their settings
+type RenderOptions struct {
+	Theme    string  `json:"theme,omitempty"`    // light or dark, light by default
+	Size     float64 `json:"size,omitempty"`     // Font size in points instead of fontSize
+	Vertical bool    `json:"vertical,omitempty"` // Write lines as columns from right to left
+	Font     string  `json:"font,omitempty"`     // Font file in resources instead of fontFile
+	Noise    float64 `json:"noise,omitempty"`    // Warping and speckles from 0 to 1, to get in the way of OCR
+}
+
+// Options with the ones set in other taking precedence
+func (opts RenderOptions) with(other *RenderOptions) RenderOptions {
+	if other == nil {
+		return opts
+	}
+
+	if len(other.Theme) > 0 {
+		opts.Theme = other.Theme
+	}
+	if other.Size > 0 {
+		opts.Size = other.Size
+	}
+	if other.Vertical {
+		opts.Vertical = true
+	}
+	if len(other.Font) > 0 {
+		opts.Font = other.Font
+	}
+	if other.Noise > 0 {
+		opts.Noise = other.Noise
+	}
+
+	return opts
+}
+
+// Check that the options can be drawn with
+func (opts RenderOptions) validate() error {
+	if _, ok := renderThemes[opts.Theme]; !ok && len(opts.Theme) > 0 {
+		return fmt.Errorf("Unknown theme '%s', expected light or dark", opts.Theme)
+	}
+	if opts.Size != 0 && (opts.Size < MIN_FONT_SIZE || opts.Size > MAX_FONT_SIZE) {
+		return fmt.Errorf("Font size %g isn't between %d and %d", opts.Size, MIN_FONT_SIZE, MAX_FONT_SIZE)
+	}
+	if opts.Noise < 0 || opts.Noise > 1 {
+		return fmt.Errorf("Noise %g isn't between 0 and 1", opts.Noise)
+	}
+	if len(opts.Font) > 0 {
+		if _, err := getFont(opts.Font); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Describe the options that differ from the defaults
+func (opts RenderOptions) String() string {
+	var parts []string
+	if len(opts.Theme) > 0 {
+		parts = append(parts, "theme "+opts.Theme)
+	}
+	if opts.Size > 0 {
+		parts = append(parts, fmt.Sprintf("size %g", opts.Size))
+	}
+	if opts.Vertical {
+		parts = append(parts, "vertical")
+	}
+	if len(opts.Font) > 0 {
+		parts = append(parts, "font "+opts.Font)
+	}
+	if opts.Noise > 0 {
+		parts = append(parts, fmt.Sprintf("noise %g", opts.Noise))
+	}
+
+	if len(parts) == 0 {
+		return "default"
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// How to draw questions of a deck in given guild, with the deck's own options
+// taking precedence over the server's
+func renderOptions(guildID string, quiz Quiz) RenderOptions {
+	return RenderOptions{}.with(getGuildConfig(guildID).Render).with(quiz.Render)
+}
+
+// Load Font from disk, along with whichever fallback fonts are there
 func loadFont() {
+	var err error
+	fontTtf, err = loadFontFile(fontFile)
+	if err != nil {
+		log.Fatalln("ERROR, Loading font:", err)
+	}
+
+	fallbackTtfs = nil
+	for _, name := range fontFallbacks {
+		ttf, err := loadFontFile(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Printf("NOTICE, Fallback font %s isn't in resources\n", name)
+			continue
+		} else if err != nil {
+			log.Println("ERROR, Loading fallback font:", err)
+			continue
+		}
+		fallbackTtfs = append(fallbackTtfs, ttf)
+	}
+}
+
+// Fonts to draw with, given font first and then the main font and the
+// fallbacks, leaving out any that aren't loaded
+func fontChain(ttf *truetype.Font) []*truetype.Font {
+	var chain []*truetype.Font
+	for _, f := range append([]*truetype.Font{ttf, fontTtf}, fallbackTtfs...) {
+		if f != nil && !slices.Contains(chain, f) {
+			chain = append(chain, f)
+		}
+	}
+
+	return chain
+}
+
+// Characters of the text that no font of the chain has, each once
+func missingGlyphs(chain []*truetype.Font, text string) string {
+	var missing []rune
+	for _, r := range text {
+		if r == '\n' || hasGlyph(chain, r) || slices.Contains(missing, r) {
+			continue
+		}
+		missing = append(missing, r)
+	}
+
+	return string(missing)
+}
+
+// Check whether any font of the chain has a glyph for the rune
+func hasGlyph(chain []*truetype.Font, r rune) bool {
+	for _, ttf := range chain {
+		if ttf.Index(r) != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Face drawing every rune with the first font of a chain that has it, and
+// runes none of them have with the first font's missing glyph box
+// Faces of the fallbacks are only made once they're needed
+type fallbackFace struct {
+	fonts []*truetype.Font
+	faces []font.Face
+	opts  *truetype.Options
+}
+
+func newFallbackFace(chain []*truetype.Font, opts *truetype.Options) *fallbackFace {
+	return &fallbackFace{fonts: chain, faces: make([]font.Face, len(chain)), opts: opts}
+}
+
+// Face to draw given rune with
+func (ff *fallbackFace) pick(r rune) font.Face {
+	i := 0
+	for j, ttf := range ff.fonts {
+		if ttf.Index(r) != 0 {
+			i = j
+			break
+		}
+	}
+
+	if ff.faces[i] == nil {
+		ff.faces[i] = truetype.NewFace(ff.fonts[i], ff.opts)
+	}
+
+	return ff.faces[i]
+}
+
+func (ff *fallbackFace) Close() error {
+	for _, face := range ff.faces {
+		if face != nil {
+			face.Close()
+		}
+	}
+
+	return nil
+}
+
+func (ff *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return ff.pick(r).Glyph(dot, r)
+}
+
+func (ff *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return ff.pick(r).GlyphBounds(r)
+}
+
+func (ff *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return ff.pick(r).GlyphAdvance(r)
+}
+
+// Kerning only applies between runes drawn with the same font
+func (ff *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	if face := ff.pick(r0); face == ff.pick(r1) {
+		return face.Kern(r0, r1)
+	}
+
+	return 0
+}
+
+// Lines are spaced by the first font
+func (ff *fallbackFace) Metrics() font.Metrics {
+	return ff.pick(0).Metrics()
+}
+
+// Faces that are done drawing, kept for reuse along with their glyph caches
+// since making new ones for every image is costly
+var Faces struct {
+	sync.Mutex
+	Pools map[faceKey]*sync.Pool
+}
+
+// Faces are pooled by their first font and options
+type faceKey struct {
+	ttf  *truetype.Font
+	opts truetype.Options
+}
+
+// Face for the chain with given options, to be handed back with putFace once
+// it's done drawing
+func getFace(chain []*truetype.Font, opts truetype.Options) *fallbackFace {
+	pool := facePool(faceKey{chain[0], opts})
+
+	// Faces made before the fallbacks changed are left for the collector
+	if ff, ok := pool.Get().(*fallbackFace); ok && slices.Equal(ff.fonts, chain) {
+		return ff
+	}
+
+	return newFallbackFace(chain, &opts)
+}
+
+// Hand a face back for reuse
+func putFace(ff *fallbackFace) {
+	facePool(faceKey{ff.fonts[0], *ff.opts}).Put(ff)
+}
+
+func facePool(key faceKey) *sync.Pool {
+	Faces.Lock()
+	defer Faces.Unlock()
+
+	if Faces.Pools == nil {
+		Faces.Pools = make(map[faceKey]*sync.Pool)
+	}
+	pool, ok := Faces.Pools[key]
+	if !ok {
+		pool = &sync.Pool{}
+		Faces.Pools[key] = pool
+	}
+
+	return pool
+}
+
+// Read and parse a font file in resources
+func loadFontFile(name string) (*truetype.Font, error) {
 
 	// Read the font data
-	fontBytes, err := ioutil.ReadFile(RESOURCES_FOLDER + fontFile)
+	fontBytes, err := ioutil.ReadFile(RESOURCES_FOLDER + name)
 	if err != nil {
-		log.Fatalln("ERROR, Loading font:", err)
+		return nil, err
 	}
 
-	fontTtf, err = truetype.Parse(fontBytes)
+	ttf, err := truetype.Parse(fontBytes)
 	if err != nil {
-		log.Fatalln("ERROR, Parsing font:", err)
+		return nil, fmt.Errorf("Parsing %s: %w", name, err)
 	}
+
+	return ttf, nil
+}
+
+// Font by file name, the main font if the name is empty
+func getFont(name string) (*truetype.Font, error) {
+	if len(name) == 0 || name == fontFile {
+		return fontTtf, nil
+	}
+
+	// Fonts may only come from resources
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("Invalid font name '%s'", name)
+	}
+
+	Fonts.RLock()
+	ttf := Fonts.Map[name]
+	Fonts.RUnlock()
+	if ttf != nil {
+		return ttf, nil
+	}
+
+	ttf, err := loadFontFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	Fonts.Lock()
+	if Fonts.Map == nil {
+		Fonts.Map = make(map[string]*truetype.Font)
+	}
+	Fonts.Map[name] = ttf
+	Fonts.Unlock()
+
+	return ttf, nil
 }
 
 // Generate a PNG image reader with given string written
-func GenerateImage(input string) *bytes.Buffer {
+func GenerateImage(input string, opts RenderOptions) *bytes.Buffer {
 
 	if len(input) == 0 {
 		log.Println("ERROR, Can't generate image without input")
 		return nil
 	}
 
+	// Pick the font, falling back on the main one
+	ttf, err := getFont(opts.Font)
+	if err != nil {
+		log.Println("ERROR, Loading font for image:", err)
+		ttf = fontTtf
+	}
+
+	size := fontSize
+	if opts.Size > 0 {
+		size = math.Max(MIN_FONT_SIZE, math.Min(opts.Size, MAX_FONT_SIZE))
+	}
+
 	// Set up font hinting
 	h := font.HintingNone
 	switch fontHinting {
@@ -54,21 +399,63 @@ func GenerateImage(input string) *bytes.Buffer {
 	}
 
 	// Pick colours
-	fg, bg := image.Black, image.White
+	theme, ok := renderThemes[opts.Theme]
+	if !ok {
+		theme = renderThemes["light"]
+	}
+	fg, bg := theme[0], theme[1]
+
+	// Characters the font lacks are drawn with the fallbacks, and the ones
+	// none of them have are worth knowing about
+	chain := fontChain(ttf)
+	if len(chain) == 0 {
+		log.Println("ERROR, Can't generate image without a font")
+		return nil
+	}
+	if missing := missingGlyphs(chain, input); len(missing) > 0 {
+		log.Printf("NOTICE, No font can draw %s in '%s'\n", missing, input)
+	}
 
 	// Set up font drawer
+	face := getFace(chain, truetype.Options{
+		Size:    size,
+		DPI:     fontDpi,
+		Hinting: h,
+	})
+	defer putFace(face)
 	d := &font.Drawer{
-		Src: fg,
-		Face: truetype.NewFace(fontTtf, &truetype.Options{
-			Size:    fontSize,
-			DPI:     fontDpi,
-			Hinting: h,
-		}),
+		Src:  image.NewUniform(fg),
+		Face: face,
 	}
 
 	// Prepare lines to be drawn
 	lines := strings.Split(input, "\n")
 
+	var rgba *image.RGBA
+	if opts.Vertical {
+		rgba = drawVertical(d, chain, lines, size, bg)
+	} else {
+		rgba = drawHorizontal(d, lines, size, bg)
+	}
+
+	if opts.Noise > 0 {
+		rgba = addNoise(rgba, math.Min(opts.Noise, 1), fg, bg)
+	}
+
+	// Encode PNG image
+	var buf bytes.Buffer
+	err = png.Encode(&buf, rgba)
+	if err != nil {
+		log.Println("ERROR, Encoding PNG with '"+input+"':", err)
+		return &buf
+	}
+
+	return &buf
+}
+
+// Draw lines of text below each other, centered
+func drawHorizontal(d *font.Drawer, lines []string, size float64, bg color.Color) *image.RGBA {
+
 	// Figure out image bounds
 	var widest int
 	for _, line := range lines {
@@ -78,7 +465,7 @@ func GenerateImage(input string) *bytes.Buffer {
 		}
 	}
 
-	lineHeight := int(math.Ceil(fontSize * fontDpi / 72 * 1.18))
+	lineHeight := int(math.Ceil(size * fontDpi / 72 * 1.18))
 	imgW := widest * 11 / 10 // 10% extra for margins
 	imgH := len(lines) * lineHeight
 
@@ -86,13 +473,13 @@ func GenerateImage(input string) *bytes.Buffer {
 	rgba := image.NewRGBA(image.Rect(0, 0, imgW, imgH))
 
 	// Draw the background and the guidelines
-	draw.Draw(rgba, rgba.Bounds(), bg, image.ZP, draw.Src)
+	draw.Draw(rgba, rgba.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
 
 	// Attach image to font drawer
 	d.Dst = rgba
 
 	// Figure out writing position
-	y := int(math.Ceil(fontSize * fontDpi / 72 * 0.94))
+	y := int(math.Ceil(size * fontDpi / 72 * 0.94))
 	x := fixed.I(imgW-widest) / 2
 	for _, line := range lines {
 		d.Dot = fixed.Point26_6{
@@ -107,13 +494,98 @@ func GenerateImage(input string) *bytes.Buffer {
 		y += lineHeight
 	}
 
-	// Encode PNG image
-	var buf bytes.Buffer
-	err := png.Encode(&buf, rgba)
-	if err != nil {
-		log.Println("ERROR, Encoding PNG with '"+input+"':", err)
-		return &buf
+	return rgba
+}
+
+// Draw lines of text as columns from right to left, one character below the
+// other, the way Japanese is written vertically
+func drawVertical(d *font.Drawer, chain []*truetype.Font, lines []string, size float64, bg color.Color) *image.RGBA {
+
+	// Punctuation turns along with the text, if a font has it turned
+	columns := make([][]rune, len(lines))
+	var longest int
+	for i, line := range lines {
+		for _, r := range line {
+			if vr, ok := verticalForms[r]; ok && hasGlyph(chain, vr) {
+				r = vr
+			}
+			columns[i] = append(columns[i], r)
+		}
+		longest = max(longest, len(columns[i]))
 	}
 
-	return &buf
+	columnWidth := int(math.Ceil(size * fontDpi / 72 * 1.18))
+	step := int(math.Ceil(size * fontDpi / 72 * 1.05))
+	margin := longest * step / 20 // 10% extra for margins
+	imgW := len(columns) * columnWidth
+	imgH := longest*step + 2*margin
+
+	rgba := image.NewRGBA(image.Rect(0, 0, imgW, imgH))
+	draw.Draw(rgba, rgba.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	d.Dst = rgba
+
+	// Characters sit on their baseline a bit above the bottom of their cell
+	for i, column := range columns {
+		center := fixed.I(imgW - i*columnWidth - columnWidth/2)
+		y := margin + int(math.Ceil(size*fontDpi/72*0.88))
+		for _, r := range column {
+			d.Dot = fixed.Point26_6{
+				X: center - d.MeasureString(string(r))/2,
+				Y: fixed.I(y),
+			}
+			d.DrawString(string(r))
+			y += step
+		}
+	}
+
+	return rgba
+}
+
+// Warp an image along random waves and sprinkle it with speckles and lines,
+// more of each the higher the amount
+func addNoise(src *image.RGBA, amount float64, fg, bg color.Color) *image.RGBA {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return src
+	}
+
+	// Shift rows and columns along sine waves
+	amplitude := amount * float64(h) / 16
+	period := float64(h) * (1 + rand.Float64())
+	phaseX, phaseY := rand.Float64()*2*math.Pi, rand.Float64()*2*math.Pi
+
+	dst := image.NewRGBA(bounds)
+	draw.Draw(dst, bounds, image.NewUniform(bg), image.Point{}, draw.Src)
+	for y := 0; y < h; y++ {
+		dx := int(amplitude * math.Sin(2*math.Pi*float64(y)/period+phaseX))
+		for x := 0; x < w; x++ {
+			dy := int(amplitude * math.Sin(2*math.Pi*float64(x)/period+phaseY))
+			if sx, sy := x+dx, y+dy; sx >= 0 && sx < w && sy >= 0 && sy < h {
+				dst.Set(x, y, src.At(sx, sy))
+			}
+		}
+	}
+
+	// Speckles in both colours
+	for n := int(amount * float64(w*h) / 150); n > 0; n-- {
+		c := fg
+		if n%2 == 0 {
+			c = bg
+		}
+		dst.Set(rand.Intn(w), rand.Intn(h), c)
+	}
+
+	// Thin lines crossing the text
+	for n := 1 + int(amount*3); n > 0; n-- {
+		x0, y0 := float64(rand.Intn(w)), float64(rand.Intn(h))
+		x1, y1 := float64(rand.Intn(w)), float64(rand.Intn(h))
+		steps := int(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))) + 1
+		for i := 0; i <= steps; i++ {
+			t := float64(i) / float64(steps)
+			dst.Set(int(x0+(x1-x0)*t), int(y0+(y1-y0)*t), fg)
+		}
+	}
+
+	return dst
 }
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// Copy of the Go font without the characters around given rune, by dropping
+// the cmap segments that map them
+func withoutRune(t *testing.T, r rune) *truetype.Font {
+	data := append([]byte(nil), goregular.TTF...)
+	be := binary.BigEndian
+
+	for i := 0; i < int(be.Uint16(data[4:])); i++ {
+		entry := data[12+16*i:]
+		if string(entry[:4]) != "cmap" {
+			continue
+		}
+
+		cmap := data[be.Uint32(entry[8:]):]
+		for j := 0; j < int(be.Uint16(cmap[2:])); j++ {
+			sub := cmap[be.Uint32(cmap[8+8*j:]):]
+			switch be.Uint16(sub) {
+			case 4: // Segment ends, padding, then segment starts
+				segments := int(be.Uint16(sub[6:])) / 2
+				ends, starts := sub[14:], sub[16+2*segments:]
+				for k := 0; k < segments; k++ {
+					if end := be.Uint16(ends[2*k:]); rune(be.Uint16(starts[2*k:])) <= r && r <= rune(end) {
+						be.PutUint16(starts[2*k:], end+1)
+					}
+				}
+			case 12: // Groups of start, end and first glyph
+				for k := 0; k < int(be.Uint32(sub[12:])); k++ {
+					group := sub[16+12*k:]
+					if end := be.Uint32(group[4:]); rune(be.Uint32(group)) <= r && r <= rune(end) {
+						be.PutUint32(group, end+1)
+					}
+				}
+			}
+		}
+	}
+
+	ttf, err := truetype.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttf.Index(r) != 0 || ttf.Index('A') == 0 {
+		t.Fatalf("Failed to leave %c out of the font", r)
+	}
+
+	return ttf
+}
+
+// Use the Go font in place of the main font, which isn't kept in the repository
+func withTestFont(t testing.TB) {
+	ttf, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, savedFallbacks := fontTtf, fallbackTtfs
+	fontTtf, fallbackTtfs = ttf, nil
+	t.Cleanup(func() { fontTtf, fallbackTtfs = saved, savedFallbacks })
+}
+
+func decodeImage(t *testing.T, buf *bytes.Buffer) image.Image {
+	if buf == nil {
+		t.Fatal("No image generated")
+	}
+	img, err := png.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return img
+}
+
+func TestGenerateImage(t *testing.T) {
+	withTestFont(t)
+
+	plain := decodeImage(t, GenerateImage("abcd", RenderOptions{}))
+	if r, g, b, _ := plain.At(0, 0).RGBA(); r != 0xffff || g != 0xffff || b != 0xffff {
+		t.Errorf("Expected a white background, got %v", plain.At(0, 0))
+	}
+
+	dark := decodeImage(t, GenerateImage("abcd", RenderOptions{Theme: "dark"}))
+	if c := color.RGBAModel.Convert(dark.At(0, 0)); c != renderThemes["dark"][1] {
+		t.Errorf("Expected a dark background, got %v", c)
+	}
+
+	// Sizes are kept within limits
+	big := decodeImage(t, GenerateImage("abcd", RenderOptions{Size: 144}))
+	huge := decodeImage(t, GenerateImage("abcd", RenderOptions{Size: 1000}))
+	if big.Bounds().Dy() <= plain.Bounds().Dy() || big.Bounds() != huge.Bounds() {
+		t.Errorf("Unexpected sizes: %v at 72pt, %v at 144pt and %v at 1000pt", plain.Bounds(), big.Bounds(), huge.Bounds())
+	}
+
+	// Lines turn into columns, right to left
+	vertical := decodeImage(t, GenerateImage("abcd\nef", RenderOptions{Vertical: true}))
+	if w, h := vertical.Bounds().Dx(), vertical.Bounds().Dy(); w >= h {
+		t.Errorf("Expected a tall image for vertical text, got %dx%d", w, h)
+	}
+
+	// Noise changes the picture but not its size
+	noisy := decodeImage(t, GenerateImage("abcd", RenderOptions{Noise: 1}))
+	if noisy.Bounds() != plain.Bounds() {
+		t.Fatalf("Noise changed the size from %v to %v", plain.Bounds(), noisy.Bounds())
+	}
+	var changed int
+	for y := 0; y < plain.Bounds().Dy(); y++ {
+		for x := 0; x < plain.Bounds().Dx(); x++ {
+			if plain.At(x, y) != noisy.At(x, y) {
+				changed++
+			}
+		}
+	}
+	if changed == 0 {
+		t.Error("Noise didn't change the image")
+	}
+
+	// Fonts that can't be loaded fall back on the main one
+	if fallback := decodeImage(t, GenerateImage("abcd", RenderOptions{Font: "../go.mod"})); fallback.Bounds() != plain.Bounds() {
+		t.Errorf("Expected the main font for an invalid font name, got %v", fallback.Bounds())
+	}
+}
+
+func TestRenderOptions(t *testing.T) {
+	server := &RenderOptions{Theme: "dark", Noise: 0.5}
+	deck := &RenderOptions{Theme: "light", Vertical: true}
+
+	if opts := (RenderOptions{}).with(server).with(deck); opts != (RenderOptions{Theme: "light", Vertical: true, Noise: 0.5}) {
+		t.Errorf("Deck options should take precedence over the server's: %+v", opts)
+	}
+	if opts := (RenderOptions{}).with(server).with(nil); opts.String() != "theme dark, noise 0.5" {
+		t.Errorf("Unexpected description: %s", opts)
+	}
+
+	for _, invalid := range []RenderOptions{{Theme: "sepia"}, {Size: 10}, {Noise: 2}, {Font: "../go.mod"}, {Font: "missing.ttf"}} {
+		if err := invalid.validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", invalid)
+		}
+	}
+	if err := (RenderOptions{Theme: "dark", Size: 96}).validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFontFallback(t *testing.T) {
+	withTestFont(t)
+	full := fontTtf
+	fontTtf = withoutRune(t, 'Ж')
+
+	// Without fallbacks there's nothing to draw Ж with
+	without := decodeImage(t, GenerateImage("AЖ", RenderOptions{}))
+	if missing := missingGlyphs(fontChain(nil), "AЖ"); missing != "Ж" {
+		t.Errorf("Expected Ж to be missing, got %q", missing)
+	}
+
+	fallbackTtfs = []*truetype.Font{full}
+	chain := fontChain(nil)
+	if len(chain) != 2 || chain[0] != fontTtf || chain[1] != full {
+		t.Fatalf("Unexpected chain: %v", chain)
+	}
+	if missing := missingGlyphs(chain, "AЖ漢字漢"); missing != "漢字" {
+		t.Errorf("Expected only the kanji to be missing, got %q", missing)
+	}
+
+	// Each rune is drawn by the first font that has it, the main font's box
+	// standing in for runes none of them have
+	face := newFallbackFace(chain, &truetype.Options{Size: fontSize, DPI: fontDpi})
+	defer face.Close()
+	if face.pick('A') != face.pick('漢') || face.pick('A') == face.pick('Ж') {
+		t.Error("Runes drawn with the wrong fonts")
+	}
+	if face.faces[1] == nil || face.Kern('A', 'Ж') != 0 {
+		t.Error("Fallback face not used for Ж")
+	}
+
+	with := decodeImage(t, GenerateImage("AЖ", RenderOptions{}))
+	if with.Bounds() == without.Bounds() {
+		same := true
+		for y := 0; y < with.Bounds().Dy() && same; y++ {
+			for x := 0; x < with.Bounds().Dx() && same; x++ {
+				same = with.At(x, y) == without.At(x, y)
+			}
+		}
+		if same {
+			t.Error("Fallback font made no difference to the image")
+		}
+	}
+
+	// Decks are checked against the whole chain
+	issues, err := glyphValidator{}.Check(Quiz{Deck: []Card{{Question: "AЖ", Answers: []string{"a"}}, {Question: "漢", Answers: []string{"a"}}}})
+	if err != nil || len(issues) != 1 || issues[0].Card != 2 || issues[0].Message != "No font has glyphs for 漢" {
+		t.Errorf("Unexpected glyph issues: %v, %v", issues, err)
+	}
+}
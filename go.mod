@@ -6,9 +6,12 @@ toolchain go1.24.1
 
 require (
 	github.com/bwmarrin/discordgo v0.29.0
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	github.com/google/go-cmp v0.6.0
+	github.com/klauspost/compress v1.18.0
 	golang.org/x/image v0.27.0
+	golang.org/x/text v0.25.0
 )
 
 require (
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"sync"
+)
+
+// Most bytes of question images to keep around, enough for a few thousand
+const IMAGE_CACHE_BYTES = 32 << 20
+
+// Upcoming questions to draw while a game pauses before the next one
+const PRERENDER_AHEAD = 2
+
+// Question images drawn recently or ahead of time
+var Images = newImageCache(IMAGE_CACHE_BYTES)
+
+// Least recently used cache of PNG images by text and render options
+// Noisy images are only ever sent once, so that bots can't learn to recognize
+// them from earlier games
+type imageCache struct {
+	sync.Mutex
+	limit int                        // Most bytes of images to keep
+	size  int                        // Bytes of images kept
+	order *list.List                 // Entries, most recently used first
+	items map[imageKey]*list.Element // Entries by what they're drawn from
+}
+
+type imageKey struct {
+	Text string
+	Opts RenderOptions
+}
+
+// Image that's ready or still being drawn
+type imageEntry struct {
+	key  imageKey
+	data []byte        // PNG image, nil if it couldn't be drawn
+	done chan struct{} // Closed once the image is drawn
+}
+
+func newImageCache(limit int) *imageCache {
+	return &imageCache{limit: limit, order: list.New(), items: make(map[imageKey]*list.Element)}
+}
+
+// Get the PNG image of given text, drawing it unless it's cached or already
+// being drawn
+// Returns nil if the image couldn't be drawn
+func (c *imageCache) Get(text string, opts RenderOptions) []byte {
+	key := imageKey{text, opts}
+
+	c.Lock()
+	var e *imageEntry
+	elem, cached := c.items[key]
+	if cached {
+		e = elem.Value.(*imageEntry)
+		if opts.Noise > 0 {
+			c.remove(elem)
+		} else {
+			c.order.MoveToFront(elem)
+		}
+	} else if opts.Noise == 0 {
+		e = c.add(key)
+	}
+	c.Unlock()
+
+	switch {
+	case e == nil:
+		return imageBytes(GenerateImage(text, opts))
+	case cached:
+		<-e.done
+	default:
+		c.draw(e)
+	}
+
+	return e.data
+}
+
+// Prepare starts drawing the image of given text in the background, unless
+// it's cached already
+func (c *imageCache) Prepare(text string, opts RenderOptions) {
+	key := imageKey{text, opts}
+
+	c.Lock()
+	_, cached := c.items[key]
+	var e *imageEntry
+	if !cached {
+		e = c.add(key)
+	}
+	c.Unlock()
+
+	if !cached {
+		go c.draw(e)
+	}
+}
+
+// Len is the number of images kept, including those still being drawn
+func (c *imageCache) Len() int {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.order.Len()
+}
+
+// Add an entry to be drawn, caller must hold the lock
+func (c *imageCache) add(key imageKey) *imageEntry {
+	e := &imageEntry{key: key, done: make(chan struct{})}
+	c.items[key] = c.order.PushFront(e)
+
+	return e
+}
+
+// Remove an entry, caller must hold the lock
+func (c *imageCache) remove(elem *list.Element) {
+	e := elem.Value.(*imageEntry)
+	c.order.Remove(elem)
+	delete(c.items, e.key)
+	c.size -= len(e.data)
+}
+
+// Draw the image of an entry, then make room for it
+func (c *imageCache) draw(e *imageEntry) {
+	data := imageBytes(GenerateImage(e.key.Text, e.key.Opts))
+
+	c.Lock()
+	e.data = data
+
+	// Entries may have been taken or evicted while they were drawn
+	if elem, ok := c.items[e.key]; ok && elem.Value == e {
+		if data == nil {
+			c.remove(elem)
+		} else {
+			c.size += len(data)
+		}
+	}
+	for c.size > c.limit && c.order.Len() > 1 {
+		c.remove(c.order.Back())
+	}
+	c.Unlock()
+
+	close(e.done)
+}
+
+// Contents of an image buffer, nil if there's no image
+func imageBytes(image *bytes.Buffer) []byte {
+	if image == nil {
+		return nil
+	}
+
+	return image.Bytes()
+}
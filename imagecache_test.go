@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Use an empty image cache of given size
+func withImageCache(t testing.TB, limit int) {
+	saved := Images
+	Images = newImageCache(limit)
+	t.Cleanup(func() { Images = saved })
+}
+
+func TestImageCache(t *testing.T) {
+	withTestFont(t)
+	withImageCache(t, IMAGE_CACHE_BYTES)
+
+	first := Images.Get("abcd", RenderOptions{})
+	if first == nil {
+		t.Fatal("No image drawn")
+	}
+	if again := Images.Get("abcd", RenderOptions{}); &again[0] != &first[0] {
+		t.Error("Expected the cached image the second time")
+	}
+	if dark := Images.Get("abcd", RenderOptions{Theme: "dark"}); &dark[0] == &first[0] {
+		t.Error("Expected another image for other options")
+	}
+
+	// Noisy images are only kept until they're sent
+	Images.Prepare("abcd", RenderOptions{Noise: 1})
+	noisy := Images.Get("abcd", RenderOptions{Noise: 1})
+	if noisy == nil || Images.Len() != 2 {
+		t.Errorf("Expected the noisy image to be taken out, %d images left", Images.Len())
+	}
+	if again := Images.Get("abcd", RenderOptions{Noise: 1}); &again[0] == &noisy[0] || Images.Len() != 2 {
+		t.Error("Noisy image sent twice")
+	}
+
+	// Images that can't be drawn aren't kept
+	if image := Images.Get("", RenderOptions{}); image != nil || Images.Len() != 2 {
+		t.Errorf("Expected no image for empty text, got %d bytes", len(image))
+	}
+}
+
+func TestImageCacheEviction(t *testing.T) {
+	withTestFont(t)
+	withImageCache(t, 0)
+
+	// Room for two images
+	a := Images.Get("a", RenderOptions{})
+	Images.limit = 2*len(a) + len(a)/2
+	Images.Get("a", RenderOptions{})
+	Images.Get("b", RenderOptions{})
+	Images.Get("a", RenderOptions{})
+	Images.Get("c", RenderOptions{})
+
+	var kept []string
+	for elem := Images.order.Front(); elem != nil; elem = elem.Next() {
+		kept = append(kept, elem.Value.(*imageEntry).key.Text)
+	}
+	if diff := cmp.Diff([]string{"c", "a"}, kept); diff != "" {
+		t.Errorf("Expected the least recently used image to go (-want +got):\n%s", diff)
+	}
+	if Images.size > Images.limit {
+		t.Errorf("Cache over its limit: %d bytes", Images.size)
+	}
+}
+
+func TestPrerender(t *testing.T) {
+	withTestFont(t)
+	withImageCache(t, IMAGE_CACHE_BYTES)
+
+	deck := []Card{{Question: "a"}, {Question: "b"}, {Question: "c", Media: MEDIA_TEXT}, {Question: "d"}}
+	g := &Game{Source: &deckSource{deck: deck}, Prerender: 2}
+
+	// Shuffled decks are handed out from the back, and only images are drawn
+	g.prerender()
+	if Images.Len() != 1 {
+		t.Fatalf("Expected 1 image being drawn, got %d", Images.Len())
+	}
+
+	g.Source = &deckSource{deck: deck, sequential: true}
+	g.prerender()
+	if Images.Len() != 3 {
+		t.Fatalf("Expected 3 images being drawn, got %d", Images.Len())
+	}
+	for _, text := range []string{"a", "b", "d"} {
+		if _, ok := Images.items[imageKey{Text: text}]; !ok {
+			t.Errorf("%s wasn't drawn ahead of time", text)
+		}
+		Images.Get(text, RenderOptions{})
+	}
+}
+
+// Short questions to draw, a different one each time
+func benchmarkWords(n int) []string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprintf("w%dx", i)
+	}
+
+	return words
+}
+
+func BenchmarkGenerateImage(b *testing.B) {
+	withTestFont(b)
+	words := benchmarkWords(100)
+
+	b.Run("new faces", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Faces.Lock()
+			Faces.Pools = nil
+			Faces.Unlock()
+			GenerateImage(words[i%len(words)], RenderOptions{})
+		}
+	})
+	b.Run("reused faces", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			GenerateImage(words[i%len(words)], RenderOptions{})
+		}
+	})
+}
+
+func BenchmarkImageCache(b *testing.B) {
+	withTestFont(b)
+	withImageCache(b, IMAGE_CACHE_BYTES)
+	words := benchmarkWords(100)
+
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Images.Get(words[i%len(words)], RenderOptions{})
+		}
+	})
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Filename for persisted game results
+const RESULTS_FILE = "results.json"
+
+// Number of players shown on a leaderboard
+const LEADERBOARD_SIZE = 10
+
+// A single player's result from a finished game
+type Result struct {
+	User  string    `json:"user"`
+	Guild string    `json:"guild,omitempty"` // Empty when played in DM
+	Deck  string    `json:"deck"`
+	Mode  string    `json:"mode"` // quiz | gauntlet
+	Score float64   `json:"score"`
+	Time  time.Time `json:"time"`
+}
+
+// How long individual results are kept, the longest leaderboard window
+const RESULTS_WINDOW = 30 * 24 * time.Hour
+
+// Results keeps ranked game results for leaderboards, individually for the
+// latest ones and as totals per player, deck, mode and guild for all time
+var Results struct {
+	sync.RWMutex
+	List    []Result       `json:"recent"`
+	AllTime []Result       `json:"alltime"` // Best gauntlet score or total quiz points, at the latest time
+	index   map[string]int // Position of each total in AllTime
+}
+
+// Serializes writes of the results file
+var resultsWriter sync.Mutex
+
+// Leaderboard time windows
+var leaderboardWindows = map[string]time.Duration{
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": RESULTS_WINDOW,
+	"alltime": 0,
+}
+
+// Player, deck, mode and guild a result is totalled under
+func resultKey(result Result) string {
+	return strings.Join([]string{result.User, result.Deck, result.Mode, result.Guild}, "\x00")
+}
+
+// Add a result to the latest ones and to the all-time totals, with Results
+// already locked
+func addResult(result Result) {
+	Results.List = append(Results.List, result)
+
+	if Results.index == nil {
+		Results.index = make(map[string]int)
+	}
+
+	i, exists := Results.index[resultKey(result)]
+	if !exists {
+		Results.index[resultKey(result)] = len(Results.AllTime)
+		Results.AllTime = append(Results.AllTime, result)
+		return
+	}
+
+	total := &Results.AllTime[i]
+	if result.Mode == "gauntlet" {
+		total.Score = math.Max(total.Score, result.Score)
+	} else {
+		total.Score += result.Score
+	}
+	if result.Time.After(total.Time) {
+		total.Time = result.Time
+	}
+}
+
+// Drop individual results older than any leaderboard window looks at, with
+// Results already locked
+func pruneResults(now time.Time) {
+	kept := Results.List[:0]
+	for _, result := range Results.List {
+		if now.Sub(result.Time) <= RESULTS_WINDOW {
+			kept = append(kept, result)
+		}
+	}
+	Results.List = kept
+}
+
+// Add the results of a finished game to the leaderboards
+func recordResults(g *Game) {
+	if !g.Ranked {
+		return
+	}
+
+	now := time.Now()
+	deck := strings.ToLower(g.Name)
+
+	Results.Lock()
+	if Results.List == nil {
+		// Not loaded, so nowhere to save them either
+		Results.Unlock()
+		return
+	}
+
+	for player, points := range g.Players {
+		result := Result{
+			User:  player,
+			Guild: g.Guild,
+			Deck:  deck,
+			Mode:  "quiz",
+			Score: float64(points),
+			Time:  now,
+		}
+
+		if g.Timed {
+			result.Mode = "gauntlet"
+			result.Score = gauntletScore(g.Correct[player], g.Answered)
+		}
+
+		addResult(result)
+	}
+	pruneResults(now)
+	Results.Unlock()
+
+	writeResults()
+}
+
+// Writes game results as JSON to disk
+func writeResults() {
+	resultsWriter.Lock()
+	defer resultsWriter.Unlock()
+
+	Results.RLock()
+	b, err := json.Marshal(&Results)
+	Results.RUnlock()
+	if err != nil {
+		log.Println("ERROR, Could not marshal Results to json:", err)
+		return
+	}
+
+	if err = writeFileAtomic(RESULTS_FILE, b); err != nil {
+		log.Println("ERROR, Could not write Results file to disk:", err)
+	}
+}
+
+// Load game results from JSON on disk
+func loadResults() {
+
+	Results.Lock()
+	defer Results.Unlock()
+
+	Results.List = make([]Result, 0)
+	Results.AllTime = nil
+	Results.index = nil
+
+	file, err := ioutil.ReadFile(RESULTS_FILE)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("ERROR, Reading Results json:", err)
+		}
+		return
+	}
+
+	// Older files are a plain list of every result, which go into the totals
+	if bytes.HasPrefix(bytes.TrimSpace(file), []byte("[")) {
+		var list []Result
+		if err = json.Unmarshal(file, &list); err != nil {
+			log.Println("ERROR, Unmarshalling Results json:", err)
+		}
+		for _, result := range list {
+			addResult(result)
+		}
+	} else if err = json.Unmarshal(file, &Results); err != nil {
+		log.Println("ERROR, Unmarshalling Results json:", err)
+	}
+
+	if Results.List == nil {
+		Results.List = make([]Result, 0)
+	}
+	Results.index = make(map[string]int)
+	for i, result := range Results.AllTime {
+		Results.index[resultKey(result)] = i
+	}
+
+	pruneResults(time.Now())
+}
+
+// Rank players on a deck, gauntlets by best score and quizzes by total points
+// With a guild given, results from other guilds are left out, and players who
+// only have results from DM are returned with an empty Guild
+func rankResults(deck, mode, guild string, since time.Time) []Result {
+
+	best := make(map[string]Result)
+
+	Results.RLock()
+	results := Results.List
+	if since.IsZero() {
+		results = Results.AllTime
+	}
+	for _, result := range results {
+		if result.Deck != deck || result.Mode != mode || result.Time.Before(since) {
+			continue
+		}
+
+		if len(guild) > 0 && len(result.Guild) > 0 && result.Guild != guild {
+			continue
+		}
+
+		current, exists := best[result.User]
+		if !exists {
+			best[result.User] = result
+			continue
+		}
+
+		// Players keep the first guild they're seen in, so that those who
+		// also play in DM still show up on their server's leaderboard
+		if len(current.Guild) == 0 {
+			current.Guild = result.Guild
+		}
+
+		if mode == "gauntlet" {
+			if result.Score > current.Score {
+				current.Score, current.Time = result.Score, result.Time
+			}
+		} else {
+			current.Score += result.Score
+			current.Time = result.Time
+		}
+
+		best[result.User] = current
+	}
+	Results.RUnlock()
+
+	ranked := make([]Result, 0, len(best))
+	for _, result := range best {
+		ranked = append(ranked, result)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].User < ranked[j].User
+	})
+
+	return ranked
+}
+
+// Check whether a user is a member of the given guild
+func isGuildMember(s *discordgo.Session, guildID, userID string) bool {
+	if _, err := s.State.Member(guildID, userID); err == nil {
+		return true
+	}
+
+	_, err := s.GuildMember(guildID, userID)
+	return err == nil
+}
+
+// Show a deck's leaderboard for a game mode, scope and time window
+func showLeaderboard(s *discordgo.Session, m *discordgo.MessageCreate, input []string) (sent *discordgo.Message) {
+
+	if len(input) < 2 {
+		return msgSend(s, m.ChannelID, fmt.Sprintf("No quiz specified! Use `%sleaderboard <deck> [gauntlet/quiz] [server/global] [weekly/monthly/alltime]`", guildPrefix(m.GuildID)))
+	}
+
+	deck := input[1]
+	mode := "quiz"
+	scope := "server"
+	window := "alltime"
+
+	for _, arg := range input[2:] {
+		switch arg {
+		case "quiz", "gauntlet":
+			mode = arg
+		case "server", "global":
+			scope = arg
+		default:
+			if _, ok := leaderboardWindows[arg]; ok {
+				window = arg
+			} else {
+				return msgSend(s, m.ChannelID, "Unknown leaderboard option: "+arg)
+			}
+		}
+	}
+
+	// There's no server to speak of in DM
+	guild := m.GuildID
+	if len(guild) == 0 {
+		scope = "global"
+	}
+	if scope == "global" {
+		guild = ""
+	}
+
+	var since time.Time
+	if d := leaderboardWindows[window]; d > 0 {
+		since = time.Now().Add(-d)
+	}
+
+	// Membership lookups can be slow, so only check as many as needed
+	var list string
+	var count int
+	for _, result := range rankResults(deck, mode, guild, since) {
+
+		// Players who've only played in DM need to be members of this server
+		if len(guild) > 0 && len(result.Guild) == 0 && !isGuildMember(s, guild, result.User) {
+			continue
+		}
+
+		count++
+		if mode == "gauntlet" {
+			list += fmt.Sprintf("%d. <@%s> %.2f points\n", count, result.User, result.Score)
+		} else {
+			list += fmt.Sprintf("%d. <@%s> %.f point(s)\n", count, result.User, result.Score)
+		}
+
+		if count >= LEADERBOARD_SIZE {
+			break
+		}
+	}
+
+	if count == 0 {
+		list = "No results yet!"
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Type:        "rich",
+		Title:       fmt.Sprintf(":trophy: Leaderboard: %s (%s, %s, %s)", deck, mode, scope, window),
+		Color:       0xFADE40,
+		Description: list,
+	}
+
+	return embedSend(s, m.ChannelID, embed)
+}
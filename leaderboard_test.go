@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRankResults(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+	day := 24 * time.Hour
+
+	Results.Lock()
+	saved, savedAllTime, savedIndex := Results.List, Results.AllTime, Results.index
+	Results.List, Results.AllTime, Results.index = make([]Result, 0), nil, nil
+	for _, result := range []Result{
+		{User: "alice", Guild: "g1", Deck: "n5", Mode: "gauntlet", Score: 10, Time: ago(time.Hour)},
+		{User: "alice", Guild: "", Deck: "n5", Mode: "gauntlet", Score: 15, Time: ago(20 * day)},
+		{User: "bob", Guild: "", Deck: "n5", Mode: "gauntlet", Score: 11, Time: ago(2 * time.Hour)},
+		{User: "carol", Guild: "g2", Deck: "n5", Mode: "gauntlet", Score: 20, Time: ago(time.Hour)},
+		{User: "alice", Guild: "g1", Deck: "n5", Mode: "quiz", Score: 5, Time: ago(time.Hour)},
+		{User: "alice", Guild: "g2", Deck: "n5", Mode: "quiz", Score: 3, Time: ago(40 * day)},
+		{User: "alice", Guild: "g1", Deck: "n5", Mode: "quiz", Score: 2, Time: ago(35 * day)},
+		{User: "bob", Guild: "g1", Deck: "n5", Mode: "quiz", Score: 4, Time: ago(10 * day)},
+		{User: "dave", Guild: "", Deck: "n5", Mode: "quiz", Score: 7, Time: ago(time.Hour)},
+		{User: "erin", Guild: "g1", Deck: "n4", Mode: "quiz", Score: 100, Time: ago(time.Hour)},
+	} {
+		addResult(result)
+	}
+
+	// Only the totals are kept of results older than a month
+	pruneResults(now)
+	recent, totals := len(Results.List), len(Results.AllTime)
+	Results.Unlock()
+	t.Cleanup(func() {
+		Results.Lock()
+		Results.List, Results.AllTime, Results.index = saved, savedAllTime, savedIndex
+		Results.Unlock()
+	})
+
+	if recent != 8 || totals != 9 {
+		t.Errorf("Expected 8 recent results and 9 totals, got %d and %d", recent, totals)
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		guild    string
+		since    time.Time
+		expected []string // Player, guild and score
+	}{
+		{"gauntlet best scores", "gauntlet", "", time.Time{}, []string{"carol g2 20", "alice g1 15", "bob  11"}},
+		{"gauntlet on a server", "gauntlet", "g1", time.Time{}, []string{"alice g1 15", "bob  11"}},
+		{"gauntlet this week", "gauntlet", "g1", ago(7 * day), []string{"bob  11", "alice g1 10"}},
+		{"quiz totals", "quiz", "", time.Time{}, []string{"alice g1 10", "dave  7", "bob g1 4"}},
+		{"quiz on a server", "quiz", "g1", time.Time{}, []string{"alice g1 7", "dave  7", "bob g1 4"}},
+		{"quiz this month", "quiz", "", ago(30 * day), []string{"dave  7", "alice g1 5", "bob g1 4"}},
+		{"quiz this week", "quiz", "g2", ago(7 * day), []string{"dave  7"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ranked []string
+			for _, result := range rankResults("n5", test.mode, test.guild, test.since) {
+				ranked = append(ranked, fmt.Sprintf("%s %s %g", result.User, result.Guild, result.Score))
+			}
+			if diff := cmp.Diff(test.expected, ranked); diff != "" {
+				t.Errorf("Unexpected ranking (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGameRanked(t *testing.T) {
+	loadQuizList()
+
+	tests := []struct {
+		name      string
+		mode      string
+		timeLimit string
+		opts      GameOptions
+		ranked    bool
+	}{
+		{"default", "gauntlet", "", GameOptions{}, true},
+		{"custom time limit", "gauntlet", "3", GameOptions{}, false},
+		{"romaji", "gauntlet", "", GameOptions{Romaji: true}, false},
+		{"quiz", "quiz", "", GameOptions{}, true},
+		{"multiple choice", "choice", "", GameOptions{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			ft := newFakeTransport()
+			cid := "ranked " + test.name
+			m := &discordgo.MessageCreate{Message: &discordgo.Message{ChannelID: cid, Author: &discordgo.User{ID: "alice"}}}
+
+			done := make(chan struct{})
+			go func() {
+				switch test.mode {
+				case "gauntlet":
+					runGauntlet(ft, m, "n5", test.timeLimit, test.opts)
+				case "choice":
+					runChoiceQuiz(ft, cid, "alice", "n5", "", 0, 0, test.opts)
+				default:
+					runQuiz(ft, cid, "alice", "n5", "", 0, 0, test.opts)
+				}
+				close(done)
+			}()
+
+			if msg := ft.next(t); !strings.Contains(msg.Text, "n5") {
+				t.Errorf("Expected the game to start: %+v", msg)
+			}
+			Ongoing.Lock()
+			g := Ongoing.Games[cid]
+			Ongoing.Unlock()
+			if g == nil || g.Ranked != test.ranked {
+				t.Errorf("Expected ranked to be %v", test.ranked)
+			}
+
+			ft.say(cid, "alice", "kq!stop")
+			for {
+				select {
+				case <-ft.sent:
+					continue
+				case <-done:
+				}
+				break
+			}
+		})
+	}
+}
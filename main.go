@@ -29,6 +29,8 @@ const RESOURCES_FOLDER = "./resources/"
 
 // Notification when attempting unauthorized commands
 const OWNER_ONLY_MSG = "オーナーさんに　ちょうせん　なんて　10000こうねん　はやいんだよ！　"
+const MANAGE_SERVER_ONLY_MSG = "Only server managers can do that, sorry "
+const MODERATOR_ONLY_MSG = "Only moderators can do that, sorry "
 
 // Discord API string limits
 const DISCORD_DESC_MAX = 2048
@@ -45,10 +47,38 @@ const UNICODE_INFO = "ℹ"
 // Discord Bot token
 var Token string
 
+// Local terminal game options
+var Terminal struct {
+	Deck    string // Deck to play instead of connecting to Discord
+	Mode    string // Game mode to play the deck with
+	Images  string // Folder to write question images to
+	Romaji  bool   // Accept readings typed in romaji
+	Hints   bool   // Show hints when nobody answers
+	Reverse bool   // Ask for the questions by their meaning or reading
+}
+
+// Deck conversion options
+var Convert struct {
+	Import string // CSV, TSV or Anki file to turn into a deck
+	Export string // Deck to write out in another format
+	Format string // Format to export to
+	Output string // File to write to instead of stdout
+	Schema bool   // Write out the JSON Schema for deck files
+}
+
+// Deck validation options
+var Validate struct {
+	Decks  string // Comma separated decks to check, or all of them
+	Fix    bool   // Propose fixes as diffs
+	Apply  bool   // Write the proposed fixes to the deck files
+	Report string // Format to write reports in
+}
+
 // Ongoing keeps track of active quizzes and the channels they belong to
 var Ongoing struct {
 	sync.RWMutex
 	ChannelID map[string]bool
+	Games     map[string]*Game // Game running in each channel, once it's begun
 }
 
 // Monitored keeps track of actively monitored messages in case of deletion
@@ -57,12 +87,6 @@ var Monitored struct {
 	MessageID map[string]string
 }
 
-// Review keeps track of review quizzes and the channels they belong to
-var Review struct {
-	sync.RWMutex
-	ChannelID map[string]Quiz
-}
-
 // General bot settings (READ ONLY)
 var Settings struct {
 	Owner       *discordgo.User   // Bot owner account
@@ -77,7 +101,21 @@ func init() {
 	}()
 
 	flag.StringVar(&Token, "t", "", "Bot Token")
-	flag.Parse()
+	flag.StringVar(&Terminal.Deck, "play", "", "Play given deck in the terminal instead of connecting to Discord")
+	flag.StringVar(&Terminal.Mode, "mode", "quiz", "Game mode for -play (quiz/mad/fast/mild/slow/flash/multi/choice/gauntlet)")
+	flag.StringVar(&Terminal.Images, "images", "", "Folder to write -play question images to as PNG files")
+	flag.BoolVar(&Terminal.Romaji, "romaji", false, "Accept readings typed in romaji for -play")
+	flag.BoolVar(&Terminal.Hints, "hints", false, "Show hints when nobody answers for -play")
+	flag.BoolVar(&Terminal.Reverse, "reverse", false, "Ask for the questions by their meaning or reading for -play")
+	flag.StringVar(&Convert.Import, "import", "", "Convert given .csv, .tsv, Anki .txt or .apkg file to a deck")
+	flag.StringVar(&Convert.Export, "export", "", "Write out given deck in -format")
+	flag.StringVar(&Convert.Format, "format", "json", "Format for -export (json/csv/tsv/txt)")
+	flag.StringVar(&Convert.Output, "o", "", "File to write -import, -export or -schema to instead of stdout")
+	flag.BoolVar(&Convert.Schema, "schema", false, "Write out the JSON Schema for deck files")
+	flag.StringVar(&Validate.Decks, "validate", "", "Check given comma separated decks, or all")
+	flag.BoolVar(&Validate.Fix, "fix", false, "Show fixes for -validate as diffs")
+	flag.BoolVar(&Validate.Apply, "apply", false, "Write the fixes for -validate to the deck files")
+	flag.StringVar(&Validate.Report, "report", "text", "Report format for -validate (text/json)")
 
 	// New seed for random in order to shuffle properly
 	rand.Seed(time.Now().UnixNano())
@@ -85,14 +123,15 @@ func init() {
 	// Initialize settings
 	Settings.TimeStarted = time.Now()
 	Settings.Speed = map[string][2]int{
-		"flash": [2]int{250, 500}, // Wait time, Pause time
-		"mad":   [2]int{0, 5000},
-		"fast":  [2]int{1000, 5000},
-		"quiz":  [2]int{2000, 5000},
-		"mild":  [2]int{3000, 5000},
-		"slow":  [2]int{5000, 5000},
-		"multi": [2]int{1500, 5000},
-		"qq":    [2]int{1250, 500},
+		"flash":  [2]int{250, 500}, // Wait time, Pause time
+		"mad":    [2]int{0, 5000},
+		"fast":   [2]int{1000, 5000},
+		"quiz":   [2]int{2000, 5000},
+		"mild":   [2]int{3000, 5000},
+		"slow":   [2]int{5000, 5000},
+		"multi":  [2]int{1500, 5000},
+		"choice": [2]int{2000, 5000},
+		"qq":     [2]int{1250, 500},
 	}
 	Settings.Difficulty = map[string][2]int{
 		"easy":   [2]int{3, 5}, // Shortest, Longest
@@ -102,12 +141,46 @@ func init() {
 	}
 
 	Ongoing.ChannelID = make(map[string]bool)
+	Ongoing.Games = make(map[string]*Game)
 	Monitored.MessageID = make(map[string]string)
+	QuizCache.Map = make(map[string]*cachedQuiz)
 	Review.ChannelID = make(map[string]Quiz)
+	Review.ChannelDeck = make(map[string]string)
+	Review.UserID = make(map[string]map[string]Quiz)
 }
 
 func main() {
 
+	flag.Parse()
+
+	// Play locally if a deck is given
+	if len(Terminal.Deck) != 0 {
+		if err := playTerminal(Terminal.Deck, Terminal.Mode, Terminal.Images, GameOptions{Romaji: Terminal.Romaji, Hints: Terminal.Hints, Reverse: Terminal.Reverse}); err != nil {
+			log.Fatalln("ERROR, Could not play in terminal:", err)
+		}
+		return
+	}
+
+	// Convert decks if asked to
+	if len(Convert.Import) > 0 || len(Convert.Export) > 0 || Convert.Schema {
+		if err := runConvert(); err != nil {
+			log.Fatalln("ERROR, Could not convert deck:", err)
+		}
+		return
+	}
+
+	// Check decks if asked to, failing if there's anything wrong with them
+	if len(Validate.Decks) > 0 {
+		found, err := runValidate()
+		if err != nil {
+			log.Fatalln("ERROR, Could not validate decks:", err)
+		}
+		if found {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Make sure we start with a token supplied
 	if len(Token) == 0 {
 		flag.Usage()
@@ -124,8 +197,9 @@ func main() {
 		log.Fatalln("ERROR, Failed to create Discord session:", err)
 	}
 
-	// Enable all intents for now
-	session.Identify.Intents = discordgo.MakeIntent(discordgo.IntentsAll)
+	// Message content is only needed for prefix commands and answers, slash
+	// commands work without it
+	session.Identify.Intents = discordgo.MakeIntent(discordgo.IntentsAllWithoutPrivileged | discordgo.IntentMessageContent)
 
 	// Open a websocket connection to Discord and begin listening
 	err = session.Open()
@@ -140,6 +214,14 @@ func main() {
 	}
 	Settings.Owner = app.Owner
 
+	// Reload decks when their files change, telling the owner about broken edits
+	QuizCache.Lock()
+	QuizCache.Report = func(msg string) { ownerSend(session, msg) }
+	QuizCache.Unlock()
+	if err := watchQuizzes(); err != nil {
+		log.Println("ERROR, Couldn't watch quiz files:", err)
+	}
+
 	// Register the messageCreate func as a callback for MessageCreate events
 	session.AddHandler(messageCreate)
 
@@ -149,6 +231,10 @@ func main() {
 	// Register the messageDelete func as a callback for MessageDeleteBulk events
 	session.AddHandler(messageDeleteBulk)
 
+	// Register the interactionCreate func as a callback for slash commands
+	session.AddHandler(interactionCreate)
+	registerCommands(session)
+
 	// Wait here until CTRL-C or other term signal is received
 	log.Println("NOTICE, Bot is now running. Press CTRL-C to exit.")
 	sc := make(chan os.Signal, 1)
@@ -183,8 +269,11 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 		return
 	}
 
+	// Each server may have its own prefix
+	prefix := guildPrefix(m.GuildID)
+
 	// Handle bot commmands
-	if isBotCommand(m.Content) {
+	if isBotCommand(m.Content, prefix) {
 
 		var sent *discordgo.Message
 		var err error
@@ -193,7 +282,21 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 		input := strings.Fields(strings.ToLower(strings.TrimSpace(m.Content)))
 		var command string
 		if len(input) >= 1 {
-			command = input[0][len(CMD_PREFIX):]
+			command = input[0][len(prefix):]
+		}
+
+		// Game options can go anywhere after the deck name
+		var opts GameOptions
+		if _, isQuiz := Settings.Speed[command]; isQuiz || command == "gauntlet" {
+			opts, input = parseGameOptions(input)
+		}
+
+		// Some commands are only for moderators and admins
+		if allowed, level := commandAllowed(s, m, command); !allowed {
+			if sent := msgSend(s, m.ChannelID, permissionMsg(level)+m.Author.Mention()); sent != nil {
+				monitorDeletion(m.ID, sent.ID)
+			}
+			return
 		}
 
 		switch command {
@@ -232,7 +335,7 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 			}
 		case "ss":
 			timeoutLimit := 30
-			if m.Author.ID == Settings.Owner.ID {
+			if isBotAdmin(m.Author.ID) {
 				timeoutLimit = 120
 			}
 
@@ -263,36 +366,36 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 			if len(input) >= 2 {
 				sent = msgSend(s, m.ChannelID, UnitConversion(m.Content[len(input[0])+1:]))
 			}
+		case "leaderboard", "lb":
+			sent = showLeaderboard(s, m, input)
+		case "stats":
+			sent = showStats(s, m, input)
 		case "uptime":
 			sent = msgSend(s, m.ChannelID, Uptime())
 		case "reload":
-			if m.Author.ID == Settings.Owner.ID {
-				if err := loadQuizList(); err == nil {
-					sent = showList(s, m)
-				} else {
-					sent = msgSend(s, m.ChannelID, "Error: Failed to load quiz list!")
-				}
+			if err := loadQuizList(); err == nil {
+				sent = showList(s, m)
 			} else {
-				sent = msgSend(s, m.ChannelID, OWNER_ONLY_MSG+m.Author.Mention())
+				sent = msgSend(s, m.ChannelID, "Error: Failed to load quiz list!")
 			}
 		case "draw":
 			if len(input) >= 2 {
-				sent = imgSend(s, m.ChannelID, strings.Replace(m.Content[len(input[0])+1:], "\\n", "\n", -1))
+				sent = imgSend(s, m.ChannelID, strings.Replace(m.Content[len(input[0])+1:], "\\n", "\n", -1), renderOptions(m.GuildID, Quiz{}))
 			}
 		case "output":
-			// Sets Gauntlet score output channel
-			if m.Author.ID == Settings.Owner.ID {
-				putStorage("output", m.ChannelID)
-				sent = msgSend(s, m.ChannelID, "Gauntlet Score output set to this channel.")
+			// Sets Gauntlet score output channel for this server
+			if len(m.GuildID) == 0 {
+				sent = msgSend(s, m.ChannelID, "Gauntlet Scores can only be announced in a server!")
 			} else {
-				sent = msgSend(s, m.ChannelID, OWNER_ONLY_MSG+m.Author.Mention())
+				updateGuildConfig(m.GuildID, func(cfg *GuildConfig) {
+					cfg.Output = m.ChannelID
+				})
+				sent = msgSend(s, m.ChannelID, "Gauntlet Score output set to this channel.")
 			}
+		case "config":
+			sent = runConfig(s, m, input)
 		case "ongoing":
-			if m.Author.ID == Settings.Owner.ID {
-				sent = msgOngoing(s, m.ChannelID)
-			} else {
-				sent = msgSend(s, m.ChannelID, OWNER_ONLY_MSG+m.Author.Mention())
-			}
+			sent = msgOngoing(s, m.ChannelID)
 		case "ping":
 			sent = msgSend(s, m.ChannelID, fmt.Sprintf("Latency: %d", time.Now().UnixNano()))
 		case "time":
@@ -307,12 +410,16 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 			if !isBotChannel(s, m) {
 				break
 			}
+			// Servers may prefer another speed for regular quizzes
+			if speed := getGuildConfig(m.GuildID).Speed; command == "quiz" && len(speed) > 0 {
+				command = speed
+			}
 			if len(input) == 2 {
-				go runQuiz(s, m.ChannelID, input[1], "", Settings.Speed[command][0], Settings.Speed[command][1])
+				go runQuiz(discordTransport{s}, m.ChannelID, m.Author.ID, input[1], "", Settings.Speed[command][0], Settings.Speed[command][1], opts)
 			} else if len(input) == 3 && strings.Contains(input[2], "-") {
-				go runQuizSequential(s, m.ChannelID, input[1], input[2], Settings.Speed[command][0], Settings.Speed[command][0])
+				go runQuizSequential(discordTransport{s}, m.ChannelID, m.Author.ID, input[1], input[2], Settings.Speed[command][0], Settings.Speed[command][0], opts)
 			} else if len(input) == 3 {
-				go runQuiz(s, m.ChannelID, input[1], input[2], Settings.Speed[command][0], Settings.Speed[command][1])
+				go runQuiz(discordTransport{s}, m.ChannelID, m.Author.ID, input[1], input[2], Settings.Speed[command][0], Settings.Speed[command][1], opts)
 			} else {
 				// Show if no quiz specified
 				sent = showList(s, m)
@@ -322,9 +429,21 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 				break
 			}
 			if len(input) == 2 {
-				go runMultiQuiz(s, m.ChannelID, input[1], "", Settings.Speed[command][0], Settings.Speed[command][1])
+				go runMultiQuiz(discordTransport{s}, m.ChannelID, m.Author.ID, input[1], "", Settings.Speed[command][0], Settings.Speed[command][1], opts)
 			} else if len(input) == 3 {
-				go runMultiQuiz(s, m.ChannelID, input[1], input[2], Settings.Speed[command][0], Settings.Speed[command][1])
+				go runMultiQuiz(discordTransport{s}, m.ChannelID, m.Author.ID, input[1], input[2], Settings.Speed[command][0], Settings.Speed[command][1], opts)
+			} else {
+				// Show if no quiz specified
+				sent = showList(s, m)
+			}
+		case "choice":
+			if !isBotChannel(s, m) {
+				break
+			}
+			if len(input) == 2 {
+				go runChoiceQuiz(discordTransport{s}, m.ChannelID, m.Author.ID, input[1], "", Settings.Speed[command][0], Settings.Speed[command][1], opts)
+			} else if len(input) == 3 {
+				go runChoiceQuiz(discordTransport{s}, m.ChannelID, m.Author.ID, input[1], input[2], Settings.Speed[command][0], Settings.Speed[command][1], opts)
 			} else {
 				// Show if no quiz specified
 				sent = showList(s, m)
@@ -334,9 +453,9 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 				break
 			}
 			if len(input) == 1 {
-				go runScramble(s, m.ChannelID, "")
+				go runScramble(discordTransport{s}, m.ChannelID, m.Author.ID, "")
 			} else if len(input) == 2 {
-				go runScramble(s, m.ChannelID, input[1])
+				go runScramble(discordTransport{s}, m.ChannelID, m.Author.ID, input[1])
 			} else {
 				// Show if no quiz specified
 				sent = showList(s, m)
@@ -346,13 +465,25 @@ func messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 				break
 			}
 			if len(input) == 2 {
-				go runGauntlet(s, m, input[1], "")
+				go runGauntlet(discordTransport{s}, m, input[1], "", opts)
 			} else if len(input) == 3 {
-				go runGauntlet(s, m, input[1], input[2])
+				go runGauntlet(discordTransport{s}, m, input[1], input[2], opts)
 			} else {
 				// Show if no quiz specified
 				sent = showHelp(s, m)
 			}
+		case "review":
+			deck, winLimit := parseReviewArgs(input[1:])
+			go runReview(discordTransport{s}, m, deck, winLimit)
+		case "study":
+			if len(input) == 2 {
+				go runStudy(discordTransport{s}, m, input[1], "")
+			} else if len(input) == 3 {
+				go runStudy(discordTransport{s}, m, input[1], input[2])
+			} else {
+				// Show if no quiz specified
+				sent = showList(s, m)
+			}
 		case "information", "info":
 			if len(input) >= 2 {
 				// Strip first space (in case it's Japanese)
@@ -390,19 +521,21 @@ func messageDeleteBulk(s *discordgo.Session, m *discordgo.MessageDeleteBulk) {
 
 // Show quiz list message in channel
 func showList(s *discordgo.Session, m *discordgo.MessageCreate) (sent *discordgo.Message) {
-	quizlist := GetQuizlist()
+	prefix := guildPrefix(m.GuildID)
+	quizlist := guildQuizlist(m.GuildID)
 	sort.Strings(quizlist)
-	return msgSend(s, m.ChannelID, fmt.Sprintf("Available quizzes: ```%s```\nUse `%squiz <deck> [optional max score]` to start or `%shelp` for more detailed information.", strings.Join(quizlist, ", "), CMD_PREFIX, CMD_PREFIX))
+	return msgSend(s, m.ChannelID, fmt.Sprintf("Available quizzes: ```%s```\nUse `%squiz <deck> [optional max score]` to start or `%shelp` for more detailed information.", strings.Join(quizlist, ", "), prefix, prefix))
 }
 
 // Show bot help message in channel
 func showHelp(s *discordgo.Session, m *discordgo.MessageCreate) (sent *discordgo.Message) {
 
+	prefix := guildPrefix(m.GuildID)
 	var fields []*discordgo.MessageEmbedField
 
 	fields = append(fields, &discordgo.MessageEmbedField{
 		Name:   "How to run a quiz round",
-		Value:  fmt.Sprintf("Type `%squiz <deck> [optional max score]` in a #bot channel or by DM.\nUse `%sstop` to cancel a running quiz.", CMD_PREFIX, CMD_PREFIX),
+		Value:  fmt.Sprintf("Type `%squiz <deck> [optional max score]` in a #bot channel or by DM.\nUse `%sstop` to cancel a running quiz.", prefix, prefix),
 		Inline: false,
 	})
 
@@ -433,13 +566,16 @@ func showHelp(s *discordgo.Session, m *discordgo.MessageCreate) (sent *discordgo
 	fields = append(fields, &discordgo.MessageEmbedField{
 		Name: "Alternative game modes",
 		Value: fmt.Sprintf(
-			"`%smad/fast/quiz/mild/slow <deck>` for 0/1/2/3/5 second answer windows.\n`%smulti <deck>` for scoring on multiple answers to the same question.\n`%sflash <deck>` for no pause between questions.\n`%sgauntlet <deck> [minutes]` in DM for a kanji time trial.\n`%sscramble [easy/normal/hard/insane]` for an English Word Scramble quiz.\n`%sinfo <deck>` for a description of the quiz.",
-			CMD_PREFIX,
-			CMD_PREFIX,
-			CMD_PREFIX,
-			CMD_PREFIX,
-			CMD_PREFIX,
-			CMD_PREFIX,
+			"`%smad/fast/quiz/mild/slow <deck>` for 0/1/2/3/5 second answer windows.\n`%smulti <deck>` for scoring on multiple answers to the same question.\n`%schoice <deck>` for multiple choice questions.\n`%sflash <deck>` for no pause between questions.\n`%sgauntlet <deck> [minutes]` in DM for a kanji time trial.\n`%sstudy <deck> [new cards]` in DM for spaced repetition study.\n`%sreview` in DM to replay the questions you missed.\n`%sscramble [easy/normal/hard/insane]` for an English Word Scramble quiz.\n`%sinfo <deck>` for a description of the quiz.",
+			prefix,
+			prefix,
+			prefix,
+			prefix,
+			prefix,
+			prefix,
+			prefix,
+			prefix,
+			prefix,
 		),
 		Inline: false,
 	})
@@ -457,7 +593,7 @@ func showHelp(s *discordgo.Session, m *discordgo.MessageCreate) (sent *discordgo
 }
 
 // Stop ongoing quiz in given channel
-func stopQuiz(s *discordgo.Session, quizChannel string) {
+func stopQuiz(t Transport, quizChannel string) {
 	count := 0
 
 	Ongoing.Lock()
@@ -473,14 +609,11 @@ func stopQuiz(s *discordgo.Session, quizChannel string) {
 		status = fmt.Sprintf("%d quizzes", count)
 	}
 
-	err := s.UpdateGameStatus(0, status)
-	if err != nil {
-		log.Println("ERROR, Could not update status:", err)
-	}
+	t.SetStatus(status)
 }
 
 // Start ongoing quiz in given channel
-func startQuiz(s *discordgo.Session, quizChannel string) (err error) {
+func startQuiz(t Transport, quizChannel string) (err error) {
 	count := 0
 
 	Ongoing.Lock()
@@ -501,43 +634,35 @@ func startQuiz(s *discordgo.Session, quizChannel string) (err error) {
 		status = fmt.Sprintf("%d quizzes", count)
 	}
 
-	err2 := s.UpdateGameStatus(0, status)
-	if err2 != nil {
-		log.Println("ERROR, Could not update status:", err2)
-	}
+	t.SetStatus(status)
 
 	return
 }
 
-// Checks if given channel has ongoing quiz
-func hasQuiz(quizChannel string) bool {
+// Ask the game running in given channel to stop on behalf of a player
+// Returns an error if there's no game, and otherwise a message for the player, if any
+func stopGame(quizChannel string, userID string, level Permission) (reply string, err error) {
 	Ongoing.RLock()
-	_, exists := Ongoing.ChannelID[quizChannel]
+	g, exists := Ongoing.Games[quizChannel]
 	Ongoing.RUnlock()
 
-	return exists
-}
-
-// Get review quiz for given channel
-func getReview(quizChannel string) Quiz {
-
-	var result Quiz
-
-	Review.Lock()
-	result = Review.ChannelID[quizChannel]
-	delete(Review.ChannelID, quizChannel)
-	Review.Unlock()
+	if !exists {
+		return "", fmt.Errorf("No quiz running in this channel")
+	}
 
-	shuffle(result.Deck)
+	g.markSeen(userID)
+	_, reply = g.requestStop(userID, level)
 
-	return result
+	return reply, nil
 }
 
-// Insert quiz into Review for given channel
-func putReview(quizChannel string, quiz Quiz) {
-	Review.Lock()
-	Review.ChannelID[quizChannel] = quiz
-	Review.Unlock()
+// Checks if given channel has ongoing quiz
+func hasQuiz(quizChannel string) bool {
+	Ongoing.RLock()
+	_, exists := Ongoing.ChannelID[quizChannel]
+	Ongoing.RUnlock()
+
+	return exists
 }
 
 // Insert message and response IDs into Monitored map in case of deletion
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Kana by the vowel they end in, for spelling out ー
+var kanaVowels = map[rune]string{
+	'あ': "あかさたなはまやらわがざだばぱぁゃゎ",
+	'い': "いきしちにひみりぎじぢびぴぃゐ",
+	'う': "うくすつぬふむゆるぐずづぶぷゔぅゅ",
+	'え': "えけせてねへめれげぜでべぺぇゑ",
+	'お': "おこそとのほもよろをごぞどぼぽぉょ",
+}
+
+// Small kana and their full size forms
+var smallKana = map[rune]rune{
+	'ぁ': 'あ', 'ぃ': 'い', 'ぅ': 'う', 'ぇ': 'え', 'ぉ': 'お',
+	'っ': 'つ', 'ゃ': 'や', 'ゅ': 'ゆ', 'ょ': 'よ', 'ゎ': 'わ',
+}
+
+// Normalize text so that answers and lookups match however they were typed
+// NFKC folds full-width Latin and half-width katakana, then everything is
+// lowercased, katakana becomes hiragana and iteration marks are spelled out
+// With longVowels, ー is also replaced by the vowel it lengthens
+func normalizeKana(s string, longVowels bool) string {
+	s = strings.ToLower(norm.NFKC.String(s))
+
+	result := make([]rune, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r >= 'ァ' && r <= 'ヶ':
+			r -= 0x60
+		case r >= 'ヷ' && r <= 'ヺ':
+			// Rare katakana for va, vi, ve and vo
+			result = append(result, 'ゔ', []rune("ぁぃぇぉ")[r-'ヷ'])
+			continue
+		case r == 'ヽ' || r == 'ヾ':
+			r -= 0x60
+		}
+
+		var previous rune
+		if len(result) > 0 {
+			previous = result[len(result)-1]
+		}
+
+		switch r {
+		case 'ゕ', 'ゖ':
+			// Counters like 一ヶ所 and 三ヵ月 are read か, or now and then が
+			// or こ, but never け
+			r = 'か'
+		case 'ゝ', '々':
+			if previous != 0 {
+				r = previous
+			}
+		case 'ゞ':
+			if previous != 0 {
+				r = voiced(previous)
+			}
+		case 'ー':
+			if vowel, ok := kanaVowel(previous); ok && longVowels {
+				r = vowel
+			}
+		}
+
+		result = append(result, r)
+	}
+
+	return string(result)
+}
+
+// Write small kana full size, for decks where players can't be expected to
+// get them right, like old texts that didn't use them
+func foldSmallKana(s string) string {
+	return strings.Map(func(r rune) rune {
+		if full, ok := smallKana[r]; ok {
+			return full
+		}
+		return r
+	}, s)
+}
+
+// Voiced version of a kana, or the kana itself if it has none
+func voiced(r rune) rune {
+	composed := []rune(norm.NFC.String(string(r) + "゙"))
+	if len(composed) != 1 {
+		return r
+	}
+
+	return composed[0]
+}
+
+// Vowel a hiragana ends in
+func kanaVowel(r rune) (rune, bool) {
+	for vowel, kana := range kanaVowels {
+		if strings.ContainsRune(kana, r) {
+			return vowel, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNormalizeKana(t *testing.T) {
+	tests := []struct {
+		input      string
+		longVowels bool
+		expected   string
+	}{
+		// Kana types
+		{"カタカナ", false, "かたかな"},
+		{"ひらがな", false, "ひらがな"},
+		{"ヴァイオリン", false, "ゔぁいおりん"},
+		{"ゔぁいおりん", false, "ゔぁいおりん"},
+		{"ヷヸヹヺ", false, "ゔぁゔぃゔぇゔぉ"},
+		{"ヵ月", false, "か月"},
+		{"一ヶ所", false, "一か所"},
+		{"一ゖ所", false, "一か所"},
+
+		// Width folding
+		{"ｶﾀｶﾅ", false, "かたかな"},
+		{"ｶﾞｯｺｳ", false, "がっこう"},
+		{"ﾊﾟﾝ", false, "ぱん"},
+		{"ＡＢＣ１２３", false, "abc123"},
+		{"ｈｅｌｌｏ　ｗｏｒｌｄ", false, "hello world"},
+		{"Tōkyō", false, "tōkyō"},
+
+		// Iteration marks
+		{"時々", false, "時時"},
+		{"人々", false, "人人"},
+		{"こゝろ", false, "こころ"},
+		{"いすゞ", false, "いすず"},
+		{"みすゞ", false, "みすず"},
+		{"バナヽ", false, "ばなな"},
+		{"ハヾ", false, "はば"},
+		{"々", false, "々"},
+		{"ゝ", false, "ゝ"},
+
+		// Long vowels
+		{"コーヒー", false, "こーひー"},
+		{"コーヒー", true, "こおひい"},
+		{"ラーメン", true, "らあめん"},
+		{"スーパー", true, "すうぱあ"},
+		{"ケーキ", true, "けえき"},
+		{"ちょーだい", true, "ちょおだい"},
+		{"ンー", true, "んー"},
+		{"ー", true, "ー"},
+	}
+
+	for _, test := range tests {
+		if result := normalizeKana(test.input, test.longVowels); result != test.expected {
+			t.Errorf("normalizeKana(%q, %t) = %q, expected %q", test.input, test.longVowels, result, test.expected)
+		}
+	}
+}
+
+func TestReadingJudgeNormalization(t *testing.T) {
+	card := Card{Question: "珈琲", Answers: []string{"コーヒー"}}
+
+	for _, answer := range []string{"コーヒー", "こーひー", "ｺｰﾋｰ"} {
+		if _, ok := (readingJudge{}).Judge(card, answer); !ok {
+			t.Errorf("Answer %q should be accepted", answer)
+		}
+	}
+
+	if _, ok := (readingJudge{}).Judge(card, "こおひい"); ok {
+		t.Error("Spelled out long vowels should only be accepted when enabled")
+	}
+	if _, ok := (readingJudge{longVowels: true}).Judge(card, "こおひい"); !ok {
+		t.Error("Spelled out long vowels should be accepted when enabled")
+	}
+
+	// Counters are read with か
+	if _, ok := (readingJudge{}).Judge(Card{Question: "一ヶ所", Answers: []string{"一ヶ所"}}, "一か所"); !ok {
+		t.Error("ヶ should be matched by か")
+	}
+
+	// Small kana only match full size ones when enabled
+	card = Card{Question: "今日", Answers: []string{"きょう"}}
+	if _, ok := (readingJudge{}).Judge(card, "きよう"); ok {
+		t.Error("Full size kana should only match small ones when enabled")
+	}
+	for _, answer := range []string{"きよう", "キョウ", "きょう"} {
+		if _, ok := (readingJudge{smallKana: true}).Judge(card, answer); !ok {
+			t.Errorf("Answer %q should be accepted with small kana folded", answer)
+		}
+	}
+	if folded := foldSmallKana("ちょっとヴぁ"); folded != "ちよつとヴあ" {
+		t.Errorf("Unexpected small kana folding: %s", folded)
+	}
+}
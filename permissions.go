@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Permission levels for commands, each one allowed everything below it
+type Permission int
+
+const (
+	PERM_EVERYONE  Permission = iota
+	PERM_MODERATOR            // Members with one of the server's moderator roles
+	PERM_MANAGER              // Server owner and members with Manage Server permission
+	PERM_ADMIN                // Bot owner and extra bot admins
+)
+
+// Commands that need more than PERM_EVERYONE, for prefix and slash commands alike
+var commandPermissions = map[string]Permission{
+	"reload":  PERM_ADMIN,
+	"ongoing": PERM_ADMIN,
+	"output":  PERM_MANAGER,
+}
+
+// How long a quiz starter can be quiet before others may vote to stop it
+const STOP_VOTE_ABSENCE = 2 * time.Minute
+
+// Notification when lacking the permission for a command
+func permissionMsg(level Permission) string {
+	switch level {
+	case PERM_ADMIN:
+		return OWNER_ONLY_MSG
+	case PERM_MANAGER:
+		return MANAGE_SERVER_ONLY_MSG
+	default:
+		return MODERATOR_ONLY_MSG
+	}
+}
+
+// Check whether a user is the bot owner or one of the extra bot admins
+// listed in the "admins" key of storage.json
+func isBotAdmin(userID string) bool {
+	if Settings.Owner != nil && userID == Settings.Owner.ID {
+		return true
+	}
+
+	admins := strings.FieldsFunc(getStorage("admins"), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+
+	return hasString(admins, userID)
+}
+
+// Highest permission level of a user in the given channel
+func permissionLevel(s *discordgo.Session, guildID, channelID, userID string) Permission {
+	if isBotAdmin(userID) {
+		return PERM_ADMIN
+	}
+
+	// Nobody to moderate in private channels
+	if len(guildID) == 0 {
+		return PERM_EVERYONE
+	}
+
+	if guild, err := s.State.Guild(guildID); err == nil && guild.OwnerID == userID {
+		return PERM_MANAGER
+	}
+
+	perms, err := s.State.UserChannelPermissions(userID, channelID)
+	if err != nil {
+		perms, err = s.UserChannelPermissions(userID, channelID)
+		if err != nil {
+			log.Println("ERROR, Could not get permissions:", err)
+			return PERM_EVERYONE
+		}
+	}
+	if perms&discordgo.PermissionManageGuild != 0 {
+		return PERM_MANAGER
+	}
+
+	moderators := getGuildConfig(guildID).Moderators
+	if len(moderators) == 0 {
+		return PERM_EVERYONE
+	}
+
+	member, err := s.State.Member(guildID, userID)
+	if err != nil {
+		member, err = s.GuildMember(guildID, userID)
+		if err != nil {
+			return PERM_EVERYONE
+		}
+	}
+	for _, role := range member.Roles {
+		if hasString(moderators, role) {
+			return PERM_MODERATOR
+		}
+	}
+
+	return PERM_EVERYONE
+}
+
+// Check whether the author of a command message is allowed to use it
+// Returns the permission level needed if not
+func commandAllowed(s *discordgo.Session, m *discordgo.MessageCreate, command string) (bool, Permission) {
+	level, restricted := commandPermissions[command]
+	if !restricted || permissionLevel(s, m.GuildID, m.ChannelID, m.Author.ID) >= level {
+		return true, level
+	}
+
+	return false, level
+}
+
+// Ask the game to stop on behalf of a player, which goes through right away
+// for the quiz starter and moderators, and otherwise needs a majority vote
+// of the active players once the starter has gone quiet
+// Returns a message for the player, if any
+func (g *Game) requestStop(userID string, level Permission) (stopped bool, reply string) {
+	g.stopLock.Lock()
+	defer g.stopLock.Unlock()
+
+	if len(g.Starter) == 0 || userID == g.Starter || level >= PERM_MODERATOR {
+		g.quit <- struct{}{}
+		return true, ""
+	}
+
+	now := time.Now()
+	if now.Sub(g.seen[g.Starter]) < STOP_VOTE_ABSENCE {
+		return false, fmt.Sprintf("Only <@%s> or a moderator can stop this quiz.", g.Starter)
+	}
+
+	// Majority of everybody who's been around lately
+	var active int
+	for _, seen := range g.seen {
+		if now.Sub(seen) < STOP_VOTE_ABSENCE {
+			active++
+		}
+	}
+
+	g.votes[userID] = true
+	needed := active/2 + 1
+	if len(g.votes) >= needed {
+		g.quit <- struct{}{}
+		return true, fmt.Sprintf("Vote to stop passed (%d/%d).", len(g.votes), needed)
+	}
+
+	return false, fmt.Sprintf("Vote to stop the quiz: %d/%d", len(g.votes), needed)
+}
+
+// Keep track of when a player was last active for stop votes
+func (g *Game) markSeen(userID string) {
+	g.stopLock.Lock()
+	g.seen[userID] = time.Now()
+	g.stopLock.Unlock()
+}
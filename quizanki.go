@@ -0,0 +1,354 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Collections inside an Anki package, newest format first
+// collection.anki21b is zstd compressed, and packages that have it only keep a
+// placeholder in collection.anki2 for older Anki versions
+var ankiCollections = []string{"collection.anki21b", "collection.anki21", "collection.anki2"}
+
+// Separates the fields of an Anki note
+const ANKI_FIELD_SEPARATOR = "\x1f"
+
+// Anki note, its fields in note type order and its tags
+type ankiNote struct {
+	Fields []string
+	Tags   []string
+}
+
+// Read the notes out of an Anki .apkg package
+func readApkg(r io.ReaderAt, size int64) ([]ankiNote, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("Reading package: %w", err)
+	}
+
+	for _, name := range ankiCollections {
+		file, err := archive.Open(name)
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Reading %s: %w", name, err)
+		}
+
+		if strings.HasSuffix(name, "b") {
+			decoder, err := zstd.NewReader(nil)
+			if err != nil {
+				return nil, err
+			}
+			data, err = decoder.DecodeAll(data, nil)
+			decoder.Close()
+			if err != nil {
+				return nil, fmt.Errorf("Decompressing %s: %w", name, err)
+			}
+		}
+
+		return readAnkiNotes(data)
+	}
+
+	return nil, fmt.Errorf("No Anki collection in package")
+}
+
+// Read the notes table of an Anki collection, which is an SQLite database
+func readAnkiNotes(data []byte) ([]ankiNote, error) {
+	db, err := openSqlite(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the notes table in the schema table: type, name, tbl_name, rootpage, sql
+	var root int
+	err = db.scan(1, func(row []interface{}) error {
+		if len(row) >= 4 && row[0] == "table" && row[1] == "notes" {
+			if page, ok := row[3].(int64); ok {
+				root = int(page)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if root == 0 {
+		return nil, fmt.Errorf("No notes table in collection")
+	}
+
+	// Notes are id, guid, mid, mod, usn, tags, flds, sfld, csum, flags, data
+	var notes []ankiNote
+	err = db.scan(root, func(row []interface{}) error {
+		if len(row) < 7 {
+			return fmt.Errorf("Note with %d columns", len(row))
+		}
+		tags, _ := row[5].(string)
+		fields, _ := row[6].(string)
+		notes = append(notes, ankiNote{
+			Fields: strings.Split(fields, ANKI_FIELD_SEPARATOR),
+			Tags:   strings.Fields(tags),
+		})
+		return nil
+	})
+
+	return notes, err
+}
+
+// Just enough of an SQLite reader to walk the rows of a table
+type sqliteDB struct {
+	data     []byte
+	pageSize int
+	usable   int // Page size without the space reserved for extensions
+}
+
+// Check the SQLite header and read the page size
+func openSqlite(data []byte) (*sqliteDB, error) {
+	if len(data) < 100 || !bytes.HasPrefix(data, []byte("SQLite format 3\x00")) {
+		return nil, fmt.Errorf("Not an SQLite database")
+	}
+
+	pageSize := int(binary.BigEndian.Uint16(data[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("Invalid page size %d", pageSize)
+	}
+
+	// SQLite never leaves less than 480 bytes of a page usable
+	usable := pageSize - int(data[20])
+	if usable < 480 {
+		return nil, fmt.Errorf("Invalid reserved space %d", data[20])
+	}
+
+	return &sqliteDB{data: data, pageSize: pageSize, usable: usable}, nil
+}
+
+// Contents of a page, counting from 1 like SQLite does
+func (db *sqliteDB) page(n int) ([]byte, error) {
+	start := (n - 1) * db.pageSize
+	if n < 1 || start+db.pageSize > len(db.data) {
+		return nil, fmt.Errorf("Page %d out of range", n)
+	}
+
+	return db.data[start : start+db.pageSize], nil
+}
+
+// Call fn for every row of the table b-tree rooted at given page, in rowid order
+func (db *sqliteDB) scan(root int, fn func(row []interface{}) error) error {
+	return db.walk(root, make(map[int]bool), fn)
+}
+
+// Walk a table b-tree, refusing to visit a page twice so that a corrupt
+// database can't send it around in circles
+func (db *sqliteDB) walk(n int, visited map[int]bool, fn func(row []interface{}) error) error {
+	if visited[n] {
+		return fmt.Errorf("Page %d visited twice", n)
+	}
+	visited[n] = true
+
+	page, err := db.page(n)
+	if err != nil {
+		return err
+	}
+
+	// The first page starts with the database header
+	header := 0
+	if n == 1 {
+		header = 100
+	}
+
+	// Interior pages have a longer header, with the right-most child last
+	headerSize := 8
+	if page[header] == 0x05 {
+		headerSize = 12
+	}
+	cells := int(binary.BigEndian.Uint16(page[header+3:]))
+	if header+headerSize+2*cells > len(page) {
+		return fmt.Errorf("Page %d has too many cells", n)
+	}
+	cellAt := func(i int) (int, error) {
+		cell := int(binary.BigEndian.Uint16(page[header+headerSize+2*i:]))
+		if cell+4 > len(page) {
+			return 0, fmt.Errorf("Cell out of range on page %d", n)
+		}
+		return cell, nil
+	}
+
+	switch page[header] {
+	case 0x05: // Interior table page, children to the left of each cell and the right-most one last
+		for i := 0; i < cells; i++ {
+			cell, err := cellAt(i)
+			if err != nil {
+				return err
+			}
+			if err := db.walk(int(binary.BigEndian.Uint32(page[cell:])), visited, fn); err != nil {
+				return err
+			}
+		}
+		return db.walk(int(binary.BigEndian.Uint32(page[header+8:])), visited, fn)
+	case 0x0d: // Leaf table page, rows
+		for i := 0; i < cells; i++ {
+			cell, err := cellAt(i)
+			if err != nil {
+				return err
+			}
+			payload, err := db.payload(page, cell)
+			if err != nil {
+				return err
+			}
+			row, err := decodeRecord(payload)
+			if err != nil {
+				return err
+			}
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("Page %d isn't a table page", n)
+}
+
+// Payload of a leaf cell, with whatever spilled onto overflow pages
+func (db *sqliteDB) payload(page []byte, cell int) ([]byte, error) {
+	size, n := readVarint(page[cell:])
+	cell += n
+	_, n = readVarint(page[cell:]) // rowid
+	cell += n
+
+	// Payloads that don't fit keep only part of themselves on the page, and
+	// none can be bigger than the whole database
+	if size > uint64(len(db.data)) {
+		return nil, fmt.Errorf("Payload of %d bytes out of range", size)
+	}
+	total := int(size)
+	local := total
+	if max := db.usable - 35; total > max {
+		min := (db.usable-12)*32/255 - 23
+		local = min + (total-min)%(db.usable-4)
+		if local > max {
+			local = min
+		}
+	}
+	if cell+local > len(page) || (local < total && cell+local+4 > len(page)) {
+		return nil, fmt.Errorf("Cell out of range")
+	}
+
+	payload := append([]byte(nil), page[cell:cell+local]...)
+	if local == total {
+		return payload, nil
+	}
+
+	next := int(binary.BigEndian.Uint32(page[cell+local:]))
+	visited := make(map[int]bool)
+	for len(payload) < total && next != 0 {
+		if visited[next] {
+			return nil, fmt.Errorf("Overflow page %d visited twice", next)
+		}
+		visited[next] = true
+
+		overflow, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		next = int(binary.BigEndian.Uint32(overflow))
+		chunk := overflow[4:db.usable]
+		if rest := total - len(payload); len(chunk) > rest {
+			chunk = chunk[:rest]
+		}
+		payload = append(payload, chunk...)
+	}
+	if len(payload) < total {
+		return nil, fmt.Errorf("Payload cut short")
+	}
+
+	return payload, nil
+}
+
+// Decode a record into its values, int64, float64, string, []byte or nil
+func decodeRecord(payload []byte) ([]interface{}, error) {
+	headerSize, n := readVarint(payload)
+	if headerSize > uint64(len(payload)) {
+		return nil, fmt.Errorf("Record header out of range")
+	}
+
+	var types []int64
+	for pos := n; pos < int(headerSize); {
+		serial, n := readVarint(payload[pos:])
+		types = append(types, int64(serial))
+		pos += n
+	}
+
+	row := make([]interface{}, len(types))
+	body := payload[headerSize:]
+	for i, serial := range types {
+		var size int
+		switch {
+		case serial >= 1 && serial <= 4:
+			size = int(serial)
+		case serial == 5:
+			size = 6
+		case serial == 6 || serial == 7:
+			size = 8
+		case serial >= 12:
+			size = int(serial-12) / 2
+		}
+		if size > len(body) {
+			return nil, fmt.Errorf("Record value out of range")
+		}
+		value := body[:size]
+		body = body[size:]
+
+		switch {
+		case serial == 0:
+			row[i] = nil
+		case serial <= 6:
+			var v int64
+			for _, b := range value {
+				v = v<<8 | int64(b)
+			}
+			if size < 8 && size > 0 && value[0]&0x80 != 0 {
+				v -= 1 << (8 * size) // negative
+			}
+			row[i] = v
+		case serial == 7:
+			row[i] = math.Float64frombits(binary.BigEndian.Uint64(value))
+		case serial == 8 || serial == 9:
+			row[i] = serial - 8
+		case serial%2 == 0:
+			row[i] = append([]byte(nil), value...)
+		default:
+			row[i] = string(value)
+		}
+	}
+
+	return row, nil
+}
+
+// Read an SQLite varint, returning its value and length
+func readVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+
+	return v, len(b)
+}
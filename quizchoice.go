@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Letters for picking options in multiple choice questions, one per option
+const CHOICE_LETTERS = "abcd"
+
+// Prefix of option button IDs, followed by the option's letter
+const CHOICE_BUTTON_PREFIX = "choice:"
+
+// Reactions standing in for the letters when buttons can't be sent
+var choiceReactions = []string{"🇦", "🇧", "🇨", "🇩"}
+
+// Random draws from the deck when looking for distractors, the first half
+// only accepting ones as long as the answer
+const CHOICE_TRIES = 100
+
+// Lettered options already written into questions, like in the grammar decks
+var embeddedChoiceRegexp = regexp.MustCompile(`(?m)^([a-d])\) *(.+)$`)
+
+// Run multiple choice quiz loop in given channel
+func runChoiceQuiz(t Transport, quizChannel string, starter string, quizname string, winLimitGiven string, waitTimeGiven int, pauseTimeGiven int, opts GameOptions) {
+
+	g := loadGame(t, quizChannel, quizname, true, opts)
+	if g == nil {
+		return
+	}
+	g.Starter = starter
+
+	// Picking from a few options isn't comparable to typing the answer
+	g.Ranked = false
+
+	// Review decks are played until the end
+	if g.Reviewing {
+		g.WinLimit = g.Source.Len()
+	}
+	g.WinLimit = parseWinLimit(winLimitGiven, g.WinLimit, g.Source.Len())
+
+	g.Wait = time.Duration(waitTimeGiven) * time.Millisecond   // delay before closing round
+	g.Pause = time.Duration(pauseTimeGiven) * time.Millisecond // delay before next question
+	g.Judge = choiceJudge{}
+	g.Scoring = choiceScoring{pool: choicePool(g.Source.Rest())}
+	g.Render = choiceRenderer{}
+
+	g.Run()
+}
+
+// Split the lettered options out of a question, if it has any
+func splitChoices(question string) (stem string, choices []string) {
+	matches := embeddedChoiceRegexp.FindAllStringSubmatch(question, -1)
+	if len(matches) < 2 {
+		return question, nil
+	}
+
+	for _, match := range matches {
+		choices = append(choices, strings.TrimSpace(match[2]))
+	}
+	stem = strings.TrimSpace(embeddedChoiceRegexp.ReplaceAllString(question, ""))
+
+	return stem, choices
+}
+
+// Check whether an option is one of the card's answers
+func isCardAnswer(card Card, option string) bool {
+	option = normalizeKana(option, false)
+	for _, ans := range card.Answers {
+		if normalizeKana(ans, false) == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Answers to draw distractors from, one for every card in the deck
+func choicePool(deck []Card) []string {
+	pool := make([]string, 0, len(deck))
+	for _, card := range deck {
+		if answer := card.primaryAnswer(); len(answer) > 0 {
+			pool = append(pool, answer)
+		}
+	}
+
+	return pool
+}
+
+// Split a pick into the message it was made on, if it came from a button or
+// reaction, and its letter
+func parsePick(pick string) (message string, letter string) {
+	if i := strings.LastIndex(pick, ":"); i >= 0 {
+		return pick[:i], pick[i+1:]
+	}
+
+	return "", pick
+}
+
+// Accepts any letter picking an option, whether it's right is up to scoring
+type choiceJudge struct{}
+
+func (cj choiceJudge) Judge(card Card, answer string) (string, bool) {
+	key := cj.Key(answer)
+	_, letter := parsePick(key)
+
+	return key, len(letter) == 1 && strings.Contains(CHOICE_LETTERS, letter)
+}
+
+func (choiceJudge) Key(answer string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(answer)), ")")
+}
+
+// Every player picking the right option gets a point, but only their first
+// pick counts
+type choiceScoring struct {
+	firstScoring
+	pool []string // Answers to draw distractors from
+}
+
+func (cs choiceScoring) Start(g *Game, r *Round) {
+	r.Choices = cs.choices(r.Card)
+}
+
+// Options for a card, the ones written into the question if it has them and
+// otherwise its answer mixed in with answers of other cards
+func (cs choiceScoring) choices(card Card) []string {
+	if _, embedded := splitChoices(card.Question); len(embedded) > 0 {
+		for _, option := range embedded {
+			if isCardAnswer(card, option) {
+				return embedded
+			}
+		}
+	}
+
+	answer := card.primaryAnswer()
+	options := []string{answer}
+	length := utf8.RuneCountInString(answer)
+
+	// Distractors as long as the answer are harder to rule out
+	for tries := 0; len(options) < len(CHOICE_LETTERS) && tries < CHOICE_TRIES && len(cs.pool) > 0; tries++ {
+		option := cs.pool[rand.Intn(len(cs.pool))]
+		if tries < CHOICE_TRIES/2 && utf8.RuneCountInString(option) != length {
+			continue
+		}
+		if !isCardAnswer(card, option) && !hasString(options, option) {
+			options = append(options, option)
+		}
+	}
+
+	shuffle(options)
+
+	return options
+}
+
+func (choiceScoring) Score(g *Game, r *Round, player, key, content string) (counted, closing bool) {
+
+	// Only a player's first pick counts
+	if _, picked := r.Answers[player]; picked {
+		return false, false
+	}
+
+	// Ignore clicks on the options of earlier questions
+	message, letter := parsePick(key)
+	if len(message) > 0 && message != r.Prompt {
+		return false, false
+	}
+
+	i := strings.Index(CHOICE_LETTERS, letter)
+	if i < 0 || i >= len(r.Choices) {
+		return false, false
+	}
+
+	r.Answers[player] = []string{fmt.Sprintf("%c) %s", CHOICE_LETTERS[i], r.Choices[i])}
+	if !isCardAnswer(r.Card, r.Choices[i]) {
+		return true, false
+	}
+
+	closing = !r.Scored()
+	r.Order = append(r.Order, player)
+
+	return true, closing
+}
+
+// Multiple choice presentation with the options as buttons
+type choiceRenderer struct {
+	quizRenderer
+}
+
+func (choiceRenderer) Start(g *Game) {
+	g.Transport.Send(g.Channel, fmt.Sprintf("```Starting new %s MULTIPLE CHOICE quiz (%d questions) in %.f seconds:\n\"%s\"\nPick an option or type its letter, only your first pick counts.\nFirst to %d points wins.```", g.Name, g.Source.Len(), float64(g.Pause/time.Second), g.Quiz.Description, g.WinLimit))
+}
+
+func (choiceRenderer) Question(g *Game, r *Round) {
+	card := r.Card
+	card.Question, _ = splitChoices(card.Question)
+	g.sendQuestion(card)
+
+	if sent := g.Transport.SendChoices(g.Channel, r.Choices); sent != nil {
+		r.Prompt = sent.ID
+	}
+}
+
+func (choiceRenderer) Correct(g *Game, r *Round) {
+	var scorers []string
+	for _, player := range r.Order {
+		scorers = append(scorers, fmt.Sprintf("<@%s> %dp", player, g.Players[player]))
+	}
+
+	g.Transport.SendEmbed(g.Channel, roundEmbed(
+		fmt.Sprintf(UNICODE_CHECK_MARK+" Correct: %s", g.questionTitle(r.Card)),
+		0x22AA22,
+		r.Card,
+		append(picksFields(r), &discordgo.MessageEmbedField{
+			Name:   fmt.Sprintf("Scorers - %s to %d", g.Name, g.WinLimit),
+			Value:  strings.Join(scorers, ", "),
+			Inline: false,
+		})...,
+	))
+}
+
+func (choiceRenderer) TimedOut(g *Game, r *Round) {
+	g.Transport.SendEmbed(g.Channel, roundEmbed(
+		fmt.Sprintf(UNICODE_NO_ENTRY+" Timed out! %s", g.questionTitle(r.Card)),
+		0xAA2222,
+		r.Card,
+		picksFields(r)...,
+	))
+}
+
+// Field listing every player's pick, if anybody picked anything
+func picksFields(r *Round) []*discordgo.MessageEmbedField {
+	if len(r.Answers) == 0 {
+		return nil
+	}
+
+	players := make([]string, 0, len(r.Answers))
+	for player := range r.Answers {
+		players = append(players, player)
+	}
+	sort.Strings(players)
+
+	var picks []string
+	for _, player := range players {
+		mark := UNICODE_NO_ENTRY
+		if hasString(r.Order, player) {
+			mark = UNICODE_CHECK_MARK
+		}
+		picks = append(picks, fmt.Sprintf("%s <@%s>: %s", mark, player, r.Answers[player][0]))
+	}
+
+	return []*discordgo.MessageEmbedField{{
+		Name:   "Picks",
+		Value:  truncate(strings.Join(picks, "\n"), 1024),
+		Inline: false,
+	}}
+}
+
+// Options listed one per line with their letters
+func choiceList(choices []string) string {
+	lines := make([]string, len(choices))
+	for i, choice := range choices {
+		lines[i] = fmt.Sprintf("%c) %s", CHOICE_LETTERS[i], choice)
+	}
+
+	return strings.Join(lines, "\n")
+}
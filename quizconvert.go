@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// JSON Schema describing deck files
+const QUIZ_SCHEMA_FILE = "quiz.schema.json"
+
+// Separates answers, and in Anki notes also the answers on the first line of the back
+const ANSWER_SEPARATOR = ";"
+
+// Columns of CSV and TSV decks, in the order they're exported
+var deckColumns = []string{"question", "answers", "comment", "media", "hint", "tags", "timeout", "primary"}
+
+// Separators between answers on the back of Anki notes
+var ankiAnswerRegexp = regexp.MustCompile(`\s*[;,、，]\s*`)
+
+// Line breaks and tags in Anki fields
+var (
+	ankiBreakRegexp = regexp.MustCompile(`(?i)<br\s*/?>|</?div>|</p>`)
+	ankiTagRegexp   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// Names Anki uses for separators in #separator headers
+var ankiSeparators = map[string]rune{
+	"tab": '\t', "comma": ',', "semicolon": ';', "space": ' ', "pipe": '|', "colon": ':',
+}
+
+// Turn a CSV, TSV, Anki text export or Anki package file into a deck
+func importDeck(path string) (Quiz, error) {
+	quiz := Quiz{Description: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Quiz{}, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		quiz.Deck, err = readDelimited(bytes.NewReader(data), ',')
+	case ".tsv":
+		quiz.Deck, err = readDelimited(bytes.NewReader(data), '\t')
+	case ".txt":
+		quiz.Deck, err = readAnkiText(bytes.NewReader(data))
+	case ".apkg":
+		var notes []ankiNote
+		notes, err = readApkg(bytes.NewReader(data), int64(len(data)))
+		quiz.Deck = notesToCards(notes, true)
+	default:
+		return Quiz{}, fmt.Errorf("Unknown file type '%s', expected .csv, .tsv, .txt or .apkg", filepath.Ext(path))
+	}
+	if err != nil {
+		return Quiz{}, err
+	}
+	if len(quiz.Deck) == 0 {
+		return Quiz{}, fmt.Errorf("No cards found in %s", path)
+	}
+
+	// Files are sent from the quizzes folder, and nowhere else
+	for i, card := range quiz.Deck {
+		if card.Media == MEDIA_FILE && !filepath.IsLocal(card.Question) {
+			return Quiz{}, fmt.Errorf("Card %d (%s) is a file outside the quizzes folder", i+1, card.Question)
+		}
+	}
+
+	// Newer fields need the newer format
+	for _, card := range quiz.Deck {
+		if len(card.Media) > 0 || len(card.Hint) > 0 || len(card.Tags) > 0 || card.Timeout > 0 || len(card.Primary) > 0 {
+			quiz.Version = QUIZ_VERSION
+			break
+		}
+	}
+
+	return quiz, nil
+}
+
+// Read cards from CSV or TSV, with a header row naming deckColumns or with
+// question, answers and comment columns in that order
+func readDelimited(r io.Reader, comma rune) ([]Card, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = comma == '\t'
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := deckColumns[:3]
+	if hasString(records[0], "question") {
+		columns = records[0]
+		for _, column := range columns {
+			if !hasString(deckColumns, column) {
+				return nil, fmt.Errorf("Unknown column '%s'", column)
+			}
+		}
+		records = records[1:]
+	}
+
+	var cards []Card
+	for i, record := range records {
+		var card Card
+		for j, value := range record {
+			if j >= len(columns) {
+				break
+			}
+			value = strings.TrimSpace(value)
+
+			switch columns[j] {
+			case "question":
+				card.Question = value
+			case "answers":
+				card.Answers = splitAnswers(value, ANSWER_SEPARATOR)
+			case "comment":
+				card.Comment = value
+			case "media":
+				card.Media = value
+			case "hint":
+				card.Hint = value
+			case "tags":
+				if tags := strings.Fields(value); len(tags) > 0 {
+					card.Tags = tags
+				}
+			case "timeout":
+				if len(value) > 0 {
+					if card.Timeout, err = strconv.Atoi(value); err != nil {
+						return nil, fmt.Errorf("Row %d: invalid timeout '%s'", i+1, value)
+					}
+				}
+			case "primary":
+				card.Primary = value
+			}
+		}
+
+		if len(card.Question) > 0 && len(card.Answers) > 0 {
+			cards = append(cards, card)
+		}
+	}
+
+	return cards, nil
+}
+
+// Read cards from Anki's "Notes in Plain Text" export, honouring its
+// #separator, #html and #... column headers
+func readAnkiText(r io.Reader) ([]Card, error) {
+	separator, isHTML := '\t', true
+	skip := make(map[int]bool) // Columns that aren't note fields, counting from 0
+	tagsColumn := -1
+
+	var body strings.Builder
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "#") || body.Len() > 0 {
+			body.WriteString(line + "\n")
+			continue
+		}
+
+		key, value, _ := strings.Cut(strings.TrimPrefix(line, "#"), ":")
+		value = strings.TrimSpace(value)
+		switch key {
+		case "separator":
+			if sep, ok := ankiSeparators[strings.ToLower(value)]; ok {
+				separator = sep
+			} else if len([]rune(value)) == 1 {
+				separator = []rune(value)[0]
+			}
+		case "html":
+			isHTML = value == "true"
+		case "tags column":
+			if n, err := strconv.Atoi(value); err == nil {
+				tagsColumn = n - 1
+				skip[tagsColumn] = true
+			}
+		case "guid column", "notetype column", "deck column":
+			if n, err := strconv.Atoi(value); err == nil {
+				skip[n-1] = true
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(strings.NewReader(body.String()))
+	reader.Comma = separator
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var notes []ankiNote
+	for _, record := range records {
+		var note ankiNote
+		for i, value := range record {
+			switch {
+			case i == tagsColumn:
+				note.Tags = strings.Fields(value)
+			case !skip[i]:
+				note.Fields = append(note.Fields, value)
+			}
+		}
+		notes = append(notes, note)
+	}
+
+	return notesToCards(notes, isHTML), nil
+}
+
+// Turn Anki notes into cards, the first field being the question and the
+// first line of the second the answers, with everything else as comment
+func notesToCards(notes []ankiNote, isHTML bool) []Card {
+	var cards []Card
+	for _, note := range notes {
+		fields := make([]string, len(note.Fields))
+		for i, field := range note.Fields {
+			if isHTML {
+				field = stripHTML(field)
+			}
+			fields[i] = strings.TrimSpace(field)
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		var tags []string
+		if len(note.Tags) > 0 {
+			tags = note.Tags
+		}
+
+		back := strings.SplitN(fields[1], "\n", 2)
+		card := Card{
+			Question: fields[0],
+			Answers:  splitAnswers(back[0], ""),
+			Tags:     tags,
+		}
+
+		var comments []string
+		if len(back) > 1 {
+			comments = append(comments, strings.TrimSpace(back[1]))
+		}
+		for _, field := range fields[2:] {
+			if len(field) > 0 {
+				comments = append(comments, field)
+			}
+		}
+		card.Comment = strings.Join(comments, "\n")
+
+		if len(card.Question) > 0 && len(card.Answers) > 0 {
+			cards = append(cards, card)
+		}
+	}
+
+	return cards
+}
+
+// Split answers by given separator, or by any common one if it's empty
+func splitAnswers(s string, separator string) []string {
+	var parts []string
+	if len(separator) > 0 {
+		parts = strings.Split(s, separator)
+	} else {
+		parts = ankiAnswerRegexp.Split(s, -1)
+	}
+
+	var answers []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); len(part) > 0 {
+			answers = append(answers, part)
+		}
+	}
+
+	return answers
+}
+
+// Turn an HTML field into plain text, keeping line breaks
+func stripHTML(s string) string {
+	s = ankiBreakRegexp.ReplaceAllString(s, "\n")
+	s = ankiTagRegexp.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	return strings.ReplaceAll(s, "\u00a0", " ")
+}
+
+// Write a deck out as json, csv, tsv or txt (Anki's plain text notes)
+func exportDeck(w io.Writer, quiz Quiz, format string) error {
+	switch format {
+	case "json":
+		formatted, err := formatQuiz(quiz)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(formatted)
+		return err
+	case "csv", "tsv":
+		return writeDelimited(w, quiz, format == "tsv")
+	case "txt":
+		return writeAnkiText(w, quiz)
+	}
+
+	return fmt.Errorf("Unknown format '%s', expected json, csv, tsv or txt", format)
+}
+
+// Write a deck as CSV or TSV with a header row, leaving out unused columns
+func writeDelimited(w io.Writer, quiz Quiz, tabs bool) error {
+	rows := make([][]string, len(quiz.Deck))
+	used := make([]bool, len(deckColumns))
+	for i, card := range quiz.Deck {
+		var media, timeout string
+		if len(card.Media) > 0 || len(quiz.Type) > 0 {
+			media = quiz.media(card)
+		}
+		if card.Timeout > 0 {
+			timeout = strconv.Itoa(card.Timeout)
+		}
+
+		rows[i] = []string{
+			card.Question,
+			strings.Join(card.Answers, ANSWER_SEPARATOR),
+			card.Comment,
+			media,
+			card.Hint,
+			strings.Join(card.Tags, " "),
+			timeout,
+			card.Primary,
+		}
+		for j, value := range rows[i] {
+			used[j] = used[j] || len(value) > 0 || j < 2
+		}
+	}
+
+	// Only the columns some card uses
+	keep := func(row []string) []string {
+		var kept []string
+		for j, value := range row {
+			if used[j] {
+				kept = append(kept, value)
+			}
+		}
+		return kept
+	}
+
+	writer := csv.NewWriter(w)
+	if tabs {
+		writer.Comma = '\t'
+	}
+	if err := writer.Write(keep(deckColumns)); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.Write(keep(row)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// Write a deck as Anki plain text notes, with answers and comment on the back
+func writeAnkiText(w io.Writer, quiz Quiz) error {
+	field := func(s string) string {
+		s = html.EscapeString(strings.ReplaceAll(s, "\t", " "))
+		return strings.ReplaceAll(s, "\n", "<br>")
+	}
+
+	buf := bufio.NewWriter(w)
+	buf.WriteString("#separator:tab\n#html:true\n#tags column:3\n")
+	for _, card := range quiz.Deck {
+		back := strings.Join(card.Answers, ANSWER_SEPARATOR+" ")
+		if len(card.Comment) > 0 {
+			back += "\n" + card.Comment
+		}
+		fmt.Fprintf(buf, "%s\t%s\t%s\n", field(card.Question), field(back), field(strings.Join(card.Tags, " ")))
+	}
+
+	return buf.Flush()
+}
+
+// Run the conversion asked for on the command line, writing to the -o file
+// or stdout
+func runConvert() error {
+	// Only touch the output once everything worked, it may well be the input deck
+	var out bytes.Buffer
+	if err := convert(&out); err != nil {
+		return err
+	}
+
+	if len(Convert.Output) > 0 {
+		return writeFileAtomic(Convert.Output, out.Bytes())
+	}
+
+	_, err := out.WriteTo(os.Stdout)
+	return err
+}
+
+// Write out the schema, imported deck or exported deck asked for
+func convert(out io.Writer) error {
+	switch {
+	case Convert.Schema:
+		schema, err := os.ReadFile(RESOURCES_FOLDER + QUIZ_SCHEMA_FILE)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(schema)
+		return err
+	case len(Convert.Import) > 0:
+		quiz, err := importDeck(Convert.Import)
+		if err != nil {
+			return err
+		}
+		return exportDeck(out, quiz, "json")
+	}
+
+	if err := loadQuizList(); err != nil {
+		return err
+	}
+
+	// Kanji info is needed for deck filters like jouyou[grade<=3]
+	loadAllKanji()
+
+	quiz := LoadQuiz(Convert.Export, false)
+	if len(quiz.Deck) == 0 {
+		return fmt.Errorf("Failed to find valid quiz: %s", Convert.Export)
+	}
+
+	return exportDeck(out, quiz, Convert.Format)
+}
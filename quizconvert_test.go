@@ -0,0 +1,328 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/klauspost/compress/zstd"
+)
+
+const TestApkg = QUIZ_FOLDER + "_anki_test.apkg"
+
+func TestReadDelimited(t *testing.T) {
+	csvDeck := "question,answers,tags,timeout\n未来,みらい;ミライ,n4 noun,30\n\"a, b\",c,,\nno answers,,,\n"
+	cards, err := readDelimited(strings.NewReader(csvDeck), ',')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Card{
+		{Question: "未来", Answers: []string{"みらい", "ミライ"}, Tags: []string{"n4", "noun"}, Timeout: 30},
+		{Question: "a, b", Answers: []string{"c"}},
+	}
+	if diff := cmp.Diff(expected, cards); diff != "" {
+		t.Errorf("Unexpected CSV cards (-want +got):\n%s", diff)
+	}
+
+	// Without a header the columns are question, answers and comment, and
+	// stray quotes in TSV are kept
+	cards, err = readDelimited(strings.NewReader("犬\tいぬ\tbig \"dog\"\n"), '\t')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]Card{{Question: "犬", Answers: []string{"いぬ"}, Comment: "big \"dog\""}}, cards); diff != "" {
+		t.Errorf("Unexpected TSV cards (-want +got):\n%s", diff)
+	}
+
+	if _, err := readDelimited(strings.NewReader("question,answer\n"), ','); err == nil {
+		t.Error("Unknown columns should be rejected")
+	}
+}
+
+func TestReadAnkiText(t *testing.T) {
+	export := "#separator:tab\n#html:true\n#guid column:1\n#tags column:4\n" +
+		"abc\t犬\tいぬ、ケン<br>dog &amp; hound\tn5 animal\n" +
+		"def\t<b>猫</b>\t<div>ねこ</div><div>cat</div>\t\n"
+
+	cards, err := readAnkiText(strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Card{
+		{Question: "犬", Answers: []string{"いぬ", "ケン"}, Comment: "dog & hound", Tags: []string{"n5", "animal"}},
+		{Question: "猫", Answers: []string{"ねこ"}, Comment: "cat"},
+	}
+	if diff := cmp.Diff(expected, cards); diff != "" {
+		t.Errorf("Unexpected cards (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadApkg(t *testing.T) {
+	data, err := os.ReadFile(TestApkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(format string, notes []ankiNote, err error) {
+		if err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+
+		// Spread over several pages, with one long enough to overflow
+		cards := notesToCards(notes, true)
+		if len(cards) != 204 {
+			t.Fatalf("%s: expected 204 cards, got %d", format, len(cards))
+		}
+		expected := []Card{
+			{Question: "犬", Answers: []string{"いぬ"}, Comment: "dog", Tags: []string{"n5", "animal"}},
+			{Question: "猫", Answers: []string{"ねこ", "ビョウ"}, Comment: "cat & kitten", Tags: []string{"n5"}},
+			{Question: "長い", Answers: []string{"ながい"}},
+		}
+		if diff := cmp.Diff(expected, cards[:3], cmp.Comparer(func(x, y []string) bool { return strings.Join(x, ",") == strings.Join(y, ",") })); diff != "" {
+			t.Errorf("%s: unexpected cards (-want +got):\n%s", format, diff)
+		}
+		if long := cards[len(cards)-1]; long.Comment != strings.Repeat("とても長いコメント", 200) {
+			t.Errorf("%s: long comment cut short to %d bytes", format, len(long.Comment))
+		}
+	}
+
+	notes, err := readApkg(bytes.NewReader(data), int64(len(data)))
+	check("anki2", notes, err)
+
+	// Newer packages compress the collection and leave a placeholder for old versions
+	encoder, _ := zstd.NewWriter(nil)
+	compressed := encoder.EncodeAll(ankiCollection(t, data), nil)
+	encoder.Close()
+
+	apkg := writeApkg(map[string][]byte{"collection.anki2": []byte("placeholder"), "collection.anki21b": compressed})
+	notes, err = readApkg(bytes.NewReader(apkg), int64(len(apkg)))
+	check("anki21b", notes, err)
+}
+
+// The collection.anki2 database of an Anki package
+func ankiCollection(t *testing.T, data []byte) []byte {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := archive.Open("collection.anki2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	collection, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return collection
+}
+
+// Zip files up into an Anki package
+func writeApkg(files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, _ := writer.Create(name)
+		w.Write(content)
+	}
+	writer.Close()
+
+	return buf.Bytes()
+}
+
+func TestReadApkgCorrupt(t *testing.T) {
+	data, err := os.ReadFile(TestApkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readApkg(bytes.NewReader(data[:len(data)/2]), int64(len(data)/2)); err == nil {
+		t.Error("Expected an error for a truncated package")
+	}
+
+	// Collections cut short anywhere are turned down rather than crashing
+	collection := ankiCollection(t, data)
+	for n := 0; n < len(collection); n += 101 {
+		apkg := writeApkg(map[string][]byte{"collection.anki2": collection[:n]})
+		if _, err := readApkg(bytes.NewReader(apkg), int64(len(apkg))); err == nil {
+			t.Fatalf("Expected an error for a collection cut short at %d bytes", n)
+		}
+	}
+
+	// Pages pointing back at themselves
+	cycle := append([]byte(nil), collection...)
+	cycle[100] = 0x05                          // Interior page
+	binary.BigEndian.PutUint16(cycle[103:], 0) // No cells
+	binary.BigEndian.PutUint32(cycle[108:], 1) // Right-most child is itself
+	if _, err := readAnkiNotes(cycle); err == nil || !strings.Contains(err.Error(), "visited twice") {
+		t.Errorf("Expected an error for a page cycle, got %v", err)
+	}
+
+	// Random damage may or may not be noticed, but never crashes
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		damaged := append([]byte(nil), collection...)
+		for j := 0; j < 20; j++ {
+			damaged[100+rng.Intn(len(damaged)-100)] = byte(rng.Intn(256))
+		}
+		readAnkiNotes(damaged)
+	}
+}
+
+func TestExportDeck(t *testing.T) {
+	quiz := Quiz{
+		Description: "Test deck",
+		Type:        MEDIA_TEXT,
+		Deck: []Card{
+			{Question: "未来", Answers: []string{"みらい", "ミライ"}, Comment: "future\n\"quoted\"", Tags: []string{"n4"}},
+			{Question: "q\tb", Answers: []string{"a"}, Hint: "h", Timeout: 10, Primary: "a"},
+		},
+	}
+
+	// Decks come back the same from CSV and TSV, with the deck's type on each card
+	for _, format := range []string{"csv", "tsv"} {
+		var buf bytes.Buffer
+		if err := exportDeck(&buf, quiz, format); err != nil {
+			t.Fatal(err)
+		}
+		cards, err := readDelimited(&buf, map[string]rune{"csv": ',', "tsv": '\t'}[format])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := append([]Card(nil), quiz.Deck...)
+		for i := range expected {
+			expected[i].Media = MEDIA_TEXT
+		}
+		if diff := cmp.Diff(expected, cards); diff != "" {
+			t.Errorf("Unexpected %s cards (-want +got):\n%s", format, diff)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := exportDeck(&buf, quiz, "txt"); err != nil {
+		t.Fatal(err)
+	}
+	cards, err := readAnkiText(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 2 || cards[0].Comment != quiz.Deck[0].Comment || cards[1].Question != "q b" {
+		t.Errorf("Unexpected Anki cards: %+v", cards)
+	}
+
+	if err := exportDeck(&buf, quiz, "xml"); err == nil {
+		t.Error("Unknown formats should be rejected")
+	}
+}
+
+func TestImportDeckFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "files.csv")
+	if err := os.WriteFile(path, []byte("question,answers,media\nimages/cat.png,ねこ,file\n../resources/secret.png,a,file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files can only be sent from the quizzes folder
+	if _, err := importDeck(path); err == nil || !strings.Contains(err.Error(), "Card 2") {
+		t.Errorf("Expected the file outside the quizzes folder to be rejected, got %v", err)
+	}
+}
+
+func TestRunConvertOutput(t *testing.T) {
+	saved := Convert
+	t.Cleanup(func() { Convert = saved })
+
+	output := filepath.Join(t.TempDir(), "deck.json")
+	if err := os.WriteFile(output, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed conversions leave the output alone
+	Convert = saved
+	Convert.Import = filepath.Join(t.TempDir(), "missing.csv")
+	Convert.Output = output
+	if err := runConvert(); err == nil {
+		t.Error("Expected missing files to fail")
+	}
+	if data, _ := os.ReadFile(output); string(data) != "keep" {
+		t.Errorf("Output changed by a failed conversion: %q", data)
+	}
+
+	// Successful ones replace it
+	Convert = saved
+	Convert.Export = "n5"
+	Convert.Format = "json"
+	Convert.Output = output
+	if err := runConvert(); err != nil {
+		t.Fatal(err)
+	}
+	var quiz Quiz
+	if data, err := os.ReadFile(output); err != nil || json.Unmarshal(data, &quiz) != nil || len(quiz.Deck) == 0 {
+		t.Errorf("Expected the n5 deck to be written, got %d cards", len(quiz.Deck))
+	}
+}
+
+func TestQuizSchema(t *testing.T) {
+	raw, err := os.ReadFile(RESOURCES_FOLDER + QUIZ_SCHEMA_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema struct {
+		Properties map[string]struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"properties"`
+		Defs map[string]struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every field of the deck format is described, and nothing else
+	sections := []struct {
+		name       string
+		value      interface{}
+		properties map[string]interface{}
+	}{
+		{"quiz", Quiz{}, nil},
+		{"card", Card{}, schema.Defs["card"].Properties},
+		{"fuzzy", FuzzyRules{}, schema.Properties["fuzzy"].Properties},
+		{"render", RenderOptions{}, schema.Properties["render"].Properties},
+	}
+	sections[0].properties = make(map[string]interface{})
+	for key := range schema.Properties {
+		sections[0].properties[key] = nil
+	}
+
+	for _, section := range sections {
+		var fields, described []string
+		typ := reflect.TypeOf(section.value)
+		for i := 0; i < typ.NumField(); i++ {
+			fields = append(fields, strings.Split(typ.Field(i).Tag.Get("json"), ",")[0])
+		}
+		for key := range section.properties {
+			described = append(described, key)
+		}
+		sort.Strings(fields)
+		sort.Strings(described)
+
+		if diff := cmp.Diff(fields, described); diff != "" {
+			t.Errorf("Schema for %s doesn't match (-fields +schema):\n%s", section.name, diff)
+		}
+	}
+}
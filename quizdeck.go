@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Joins decks in a deck expression, like n5+n4
+const DECK_JOIN = "+"
+
+// Deck name followed by any number of bracketed filters
+var deckTermRegexp = regexp.MustCompile(`^([^\[\]]+)((?:\[[^\[\]]*\])*)$`)
+
+// Filter on a card's metadata, like tag:verb, or on its kanji, like grade<=3
+var deckFilterRegexp = regexp.MustCompile(`^(tag|media|kanken|jlpt|grade|type)\s*(<=|>=|!=|<|>|=|:)\s*(.+)$`)
+
+// Part of a deck expression, a deck and the filters its cards must pass
+type deckTerm struct {
+	Name    string
+	Filters []deckFilter
+}
+
+// Condition a card must meet to be played
+type deckFilter struct {
+	Field string // What is compared, tag or media of the card or an attribute of its kanji
+	Op    string // Comparison, = and : mean the same
+	Value string
+}
+
+// Check if a deck name is an expression combining or filtering decks
+func isDeckExpr(name string) bool {
+	return strings.ContainsAny(name, DECK_JOIN+"[")
+}
+
+// Names of the decks an expression is made of
+func deckNames(expr string) []string {
+	var names []string
+	for _, part := range strings.Split(expr, DECK_JOIN) {
+		if i := strings.Index(part, "["); i >= 0 {
+			part = part[:i]
+		}
+		names = append(names, strings.TrimSpace(part))
+	}
+
+	return names
+}
+
+// Split a deck expression into its decks and filters
+func parseDeckExpr(expr string) ([]deckTerm, error) {
+	var terms []deckTerm
+	for _, part := range strings.Split(expr, DECK_JOIN) {
+		match := deckTermRegexp.FindStringSubmatch(strings.TrimSpace(part))
+		if match == nil {
+			return nil, fmt.Errorf("Invalid deck '%s'", part)
+		}
+
+		term := deckTerm{Name: strings.TrimSpace(match[1])}
+		for _, group := range strings.Split(strings.Trim(match[2], "[]"), "][") {
+			for _, condition := range strings.Split(group, ",") {
+				if len(strings.TrimSpace(condition)) == 0 {
+					continue
+				}
+				filter, err := parseDeckFilter(condition)
+				if err != nil {
+					return nil, err
+				}
+				term.Filters = append(term.Filters, filter)
+			}
+		}
+		terms = append(terms, term)
+	}
+
+	return terms, nil
+}
+
+// Parse a single filter like grade<=3
+func parseDeckFilter(condition string) (deckFilter, error) {
+	match := deckFilterRegexp.FindStringSubmatch(strings.ToLower(strings.TrimSpace(condition)))
+	if match == nil {
+		return deckFilter{}, fmt.Errorf("Invalid filter '%s'", condition)
+	}
+
+	filter := deckFilter{Field: match[1], Op: match[2], Value: strings.TrimSpace(match[3])}
+	if filter.Op == ":" {
+		filter.Op = "="
+	}
+
+	switch filter.Field {
+	case "tag", "media", "type":
+		if filter.Op != "=" && filter.Op != "!=" {
+			return deckFilter{}, fmt.Errorf("Filter '%s' can only use = or !=", filter.Field)
+		}
+	default:
+		if _, ok := kanjiLevel(filter.Field, filter.Value); !ok {
+			return deckFilter{}, fmt.Errorf("Invalid %s level '%s'", filter.Field, filter.Value)
+		}
+	}
+
+	return filter, nil
+}
+
+// Load the decks of an expression, filter them and join them together
+// Decks are interleaved so that any part of the result has them in the same
+// proportion as the whole, and cards with the same question are merged
+func loadDeckExpr(expr string, doShuffle bool) (Quiz, error) {
+	terms, err := parseDeckExpr(expr)
+	if err != nil {
+		return Quiz{}, err
+	}
+
+	combined := Quiz{Version: QUIZ_VERSION}
+	var descriptions []string
+	var decks [][]Card
+	for _, term := range terms {
+		quiz, err := loadQuizFile(term.Name, doShuffle)
+		if err != nil {
+			return Quiz{}, err
+		}
+
+		// Cards keep how they were shown and timed in their own deck
+		var deck []Card
+		for _, card := range quiz.Deck {
+			if !term.matches(quiz, card) {
+				continue
+			}
+			card.Media = quiz.media(card)
+			if card.Timeout == 0 {
+				card.Timeout = quiz.Timeout
+			}
+			deck = append(deck, card)
+		}
+		if len(deck) == 0 {
+			return Quiz{}, fmt.Errorf("No cards in '%s' match", term.Name)
+		}
+		decks = append(decks, deck)
+
+		description := quiz.Description
+		if len(term.Filters) > 0 {
+			description += " " + term.filterString()
+		}
+		descriptions = append(descriptions, description)
+
+		combined.Romaji = combined.Romaji || quiz.Romaji
+		combined.LongVowels = combined.LongVowels || quiz.LongVowels
+		combined.SmallKana = combined.SmallKana || quiz.SmallKana
+		if combined.Fuzzy == nil {
+			combined.Fuzzy = quiz.Fuzzy
+		}
+		if combined.Render == nil {
+			combined.Render = quiz.Render
+		}
+	}
+
+	combined.Description = strings.Join(descriptions, " + ")
+	combined.Deck = mergeDecks(decks)
+
+	return combined, nil
+}
+
+// Interleave decks in proportion to their sizes, merging the answers of
+// cards that share a question into the first one
+func mergeDecks(decks [][]Card) []Card {
+	var total int
+	for _, deck := range decks {
+		total += len(deck)
+	}
+
+	merged := make([]Card, 0, total)
+	seen := make(map[string]int)
+	taken := make([]int, len(decks))
+	for n := 0; n < total; n++ {
+
+		// Take from the deck that's furthest behind its share
+		next := -1
+		for i, deck := range decks {
+			if taken[i] == len(deck) {
+				continue
+			}
+			if next < 0 || taken[i]*len(decks[next]) < taken[next]*len(deck) {
+				next = i
+			}
+		}
+
+		card := decks[next][taken[next]]
+		taken[next]++
+
+		if i, ok := seen[card.Question]; ok {
+			for _, ans := range card.Answers {
+				if !hasString(merged[i].Answers, ans) {
+					// Answers are shared with the cached deck, so never append in place
+					merged[i].Answers = append(slices.Clip(merged[i].Answers), ans)
+				}
+			}
+			continue
+		}
+		seen[card.Question] = len(merged)
+		merged = append(merged, card)
+	}
+
+	return merged
+}
+
+// Check if a card passes all of the term's filters
+func (dt deckTerm) matches(quiz Quiz, card Card) bool {
+	for _, filter := range dt.Filters {
+		if !filter.matches(quiz, card) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Filters written back in brackets, for descriptions
+func (dt deckTerm) filterString() string {
+	conditions := make([]string, len(dt.Filters))
+	for i, filter := range dt.Filters {
+		conditions[i] = filter.Field + filter.Op + filter.Value
+	}
+
+	return "[" + strings.Join(conditions, ",") + "]"
+}
+
+// Check if a card meets the condition, kanji attributes have to hold for
+// every kanji in the question and there has to be at least one
+func (df deckFilter) matches(quiz Quiz, card Card) bool {
+	switch df.Field {
+	case "tag":
+		var tagged bool
+		for _, tag := range card.Tags {
+			tagged = tagged || strings.ToLower(tag) == df.Value
+		}
+		return tagged == (df.Op == "=")
+	case "media":
+		return (quiz.media(card) == df.Value) == (df.Op == "=")
+	}
+
+	var found bool
+	for _, r := range card.Question {
+		if !unicode.Is(unicode.Han, r) || r == '々' {
+			continue
+		}
+		found = true
+
+		kanji, ok := KanjiMap[string(r)]
+		if !ok || !df.matchesKanji(kanji) {
+			return false
+		}
+	}
+
+	return found
+}
+
+// Check if a kanji meets the condition
+func (df deckFilter) matchesKanji(kanji Kanji) bool {
+	if df.Field == "type" {
+		var typed bool
+		for _, t := range kanji.Type {
+			typed = typed || strings.TrimSuffix(t, "※") == df.Value
+		}
+		return typed == (df.Op == "=")
+	}
+
+	var attribute string
+	switch df.Field {
+	case "kanken":
+		attribute = kanji.Kanken
+	case "jlpt":
+		attribute = kanji.JLPT
+	case "grade":
+		attribute = kanji.Grade
+	}
+
+	level, ok := kanjiLevel(df.Field, attribute)
+	if !ok {
+		return df.Op == "!="
+	}
+	want, _ := kanjiLevel(df.Field, df.Value)
+
+	switch df.Op {
+	case "<":
+		return level < want
+	case "<=":
+		return level <= want
+	case ">":
+		return level > want
+	case ">=":
+		return level >= want
+	case "!=":
+		return level != want
+	}
+
+	return level == want
+}
+
+// Number for a Kanken level, JLPT level or school grade, like 3 for 小３, N3
+// or ３級, and 2.5 for 準２級
+// Kanji on several Kanken levels count as the easiest one
+func kanjiLevel(field string, value string) (float64, bool) {
+	value = strings.ToLower(norm.NFKC.String(value))
+
+	var best float64
+	var found bool
+	for _, part := range strings.Split(value, "/") {
+		part = strings.TrimSpace(part)
+		part = strings.TrimPrefix(part, "小")
+		part = strings.TrimSuffix(part, "級")
+		if field == "jlpt" {
+			part = strings.TrimPrefix(part, "n")
+		}
+
+		var bonus float64
+		if field == "kanken" {
+			for _, prefix := range []string{"準", "pre-", "p"} {
+				if strings.HasPrefix(part, prefix) {
+					part, bonus = strings.TrimPrefix(part, prefix), 0.5
+					break
+				}
+			}
+		}
+
+		level, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			continue
+		}
+		if level += bonus; !found || level > best {
+			best, found = level, true
+		}
+	}
+
+	return best, found
+}
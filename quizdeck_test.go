@@ -0,0 +1,149 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseDeckExpr(t *testing.T) {
+	terms, err := parseDeckExpr("n5+jouyou[grade<=3][tag:Verb,kanken>=準2級]")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []deckTerm{
+		{Name: "n5"},
+		{Name: "jouyou", Filters: []deckFilter{
+			{Field: "grade", Op: "<=", Value: "3"},
+			{Field: "tag", Op: "=", Value: "verb"},
+			{Field: "kanken", Op: ">=", Value: "準2級"},
+		}},
+	}
+	if diff := cmp.Diff(expected, terms); diff != "" {
+		t.Errorf("Unexpected terms (-want +got):\n%s", diff)
+	}
+
+	for _, expr := range []string{"n5[", "n5[grade<=x]", "n5[tag<3]", "n5[color:red]", "n5+"} {
+		if _, err := parseDeckExpr(expr); err == nil {
+			t.Errorf("Expression %q should be invalid", expr)
+		}
+	}
+
+	if diff := cmp.Diff([]string{"n5", "jouyou"}, deckNames("n5+jouyou[grade<=3]")); diff != "" {
+		t.Errorf("Unexpected names (-want +got):\n%s", diff)
+	}
+}
+
+func TestKanjiLevel(t *testing.T) {
+	tests := []struct {
+		field    string
+		value    string
+		expected float64
+		ok       bool
+	}{
+		{"grade", "小３", 3, true},
+		{"grade", "3", 3, true},
+		{"jlpt", "N2", 2, true},
+		{"jlpt", "n2", 2, true},
+		{"kanken", "１０級", 10, true},
+		{"kanken", "準２級", 2.5, true},
+		{"kanken", "pre-2", 2.5, true},
+		{"kanken", "１級 / 準１級", 1.5, true},
+		{"kanken", "対象外", 0, false},
+		{"grade", "", 0, false},
+	}
+
+	for _, test := range tests {
+		if level, ok := kanjiLevel(test.field, test.value); level != test.expected || ok != test.ok {
+			t.Errorf("kanjiLevel(%q, %q) = %v, %t, expected %v, %t", test.field, test.value, level, ok, test.expected, test.ok)
+		}
+	}
+}
+
+func TestDeckFilters(t *testing.T) {
+	saved := KanjiMap
+	defer func() { KanjiMap = saved }()
+	KanjiMap = map[string]Kanji{
+		"一": {Grade: "小１", JLPT: "N5", Kanken: "１０級"},
+		"人": {Grade: "小１", JLPT: "N5", Kanken: "１０級"},
+		"鬱": {Kanken: "２級", JLPT: "N1"},
+	}
+
+	quiz := Quiz{Deck: []Card{
+		{Question: "一人", Tags: []string{"Noun"}},
+		{Question: "一人々", Tags: []string{"noun"}},
+		{Question: "鬱", Tags: []string{"noun"}},
+		{Question: "ひとり"},
+		{Question: "一鬱"},
+	}}
+
+	tests := []struct {
+		expr     string
+		expected []string
+	}{
+		{"x[grade<=1]", []string{"一人", "一人々"}},
+		{"x[jlpt>=5]", []string{"一人", "一人々"}},
+		{"x[jlpt<5]", []string{"鬱"}},
+		{"x[kanken<=2]", []string{"鬱"}},
+		{"x[grade!=1]", []string{"鬱"}},
+		{"x[tag:noun]", []string{"一人", "一人々", "鬱"}},
+		{"x[tag!=noun]", []string{"ひとり", "一鬱"}},
+		{"x[tag:noun,jlpt=1]", []string{"鬱"}},
+	}
+
+	for _, test := range tests {
+		terms, err := parseDeckExpr(test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var matched []string
+		for _, card := range quiz.Deck {
+			if terms[0].matches(quiz, card) {
+				matched = append(matched, card.Question)
+			}
+		}
+		if diff := cmp.Diff(test.expected, matched); diff != "" {
+			t.Errorf("Unexpected cards for %s (-want +got):\n%s", test.expr, diff)
+		}
+	}
+}
+
+func TestMergeDecks(t *testing.T) {
+	big := []Card{{Question: "a1"}, {Question: "shared", Answers: []string{"x"}}, {Question: "a3"}, {Question: "a4"}, {Question: "a5"}, {Question: "a6"}}
+	small := []Card{{Question: "b1"}, {Question: "shared", Answers: []string{"x", "y"}}, {Question: "b3"}}
+
+	var questions []string
+	merged := mergeDecks([][]Card{big, small})
+	for _, card := range merged {
+		questions = append(questions, card.Question)
+	}
+
+	// Two cards from the big deck for every one from the small one
+	expected := []string{"a1", "b1", "shared", "a3", "a4", "a5", "b3", "a6"}
+	if diff := cmp.Diff(expected, questions); diff != "" {
+		t.Errorf("Unexpected order (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"x", "y"}, merged[2].Answers); diff != "" {
+		t.Errorf("Unexpected merged answers (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoadDeckExpr(t *testing.T) {
+	loadQuizList()
+
+	n5, n4 := LoadQuiz("n5", false), LoadQuiz("n4", false)
+	combined := LoadQuiz("n5+n4", true)
+	if len(combined.Deck) == 0 || len(combined.Deck) > len(n5.Deck)+len(n4.Deck) {
+		t.Errorf("Unexpected combined deck size %d", len(combined.Deck))
+	}
+	if !strings.Contains(combined.Description, n5.Description) || !strings.Contains(combined.Description, n4.Description) {
+		t.Errorf("Unexpected description: %s", combined.Description)
+	}
+
+	if quiz := LoadQuiz("n5+nosuchdeck", false); len(quiz.Deck) > 0 {
+		t.Error("Expressions with unknown decks shouldn't load")
+	}
+}
@@ -0,0 +1,859 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// QuestionSource hands out the cards to be asked during a game
+type QuestionSource interface {
+	Next() (Card, bool) // Next card to ask, false when out of cards
+	Len() int           // Number of cards left to ask
+	Rest() []Card       // Cards that haven't been asked yet
+}
+
+// AnswerJudge decides whether an answer is correct for a card
+// Returns the normalized form of the accepted answer it matched
+type AnswerJudge interface {
+	Judge(card Card, answer string) (string, bool)
+	Key(answer string) string // Normalized form answers are compared in
+}
+
+// ScoringPolicy keeps track of correct answers within a round
+type ScoringPolicy interface {
+	// Prepare a new round before its question is sent out
+	Start(g *Game, r *Round)
+
+	// Register a correct answer, returns whether it counted towards the score
+	// and whether the round should now close after the answer window
+	Score(g *Game, r *Round, player, key, content string) (counted, closing bool)
+
+	// Points earned by each player in a finished round
+	Points(r *Round) map[string]int
+}
+
+// RoundRenderer presents the game to its players
+type RoundRenderer interface {
+	Start(g *Game)                       // Announce the game
+	History(g *Game, r *Round) string    // Entry for the game's history footer
+	Question(g *Game, r *Round)          // Send out the question
+	Hint(g *Game, r *Round, hint string) // Help out when nobody's answered yet
+	Correct(g *Game, r *Round)           // Show the round's scorers
+	TimedOut(g *Game, r *Round)          // Show the answers nobody got
+	Finish(g *Game)                      // Show the final scoreboard
+}
+
+// ResultRecorder can be implemented by sources that want to know how each
+// of their cards went
+type ResultRecorder interface {
+	Record(card Card, correct bool)
+}
+
+// UpcomingSource can be implemented by sources that know which cards they'll
+// hand out next, so their images can be drawn ahead of time
+type UpcomingSource interface {
+	Upcoming(n int) []Card // Up to n cards in the order Next returns them
+}
+
+// Round holds the state of a single question being asked
+type Round struct {
+	Card    Card
+	Number  int                  // Position of the question within the game
+	Timeout time.Duration        // Time to wait for correct answers
+	Order   []string             // Players in the order they first scored
+	Answers map[string][]string  // Accepted answers per player
+	Given   map[string]time.Time // When each answer was first given
+	Matched map[string]string    // Loosely matched answers and the card answer they were taken for
+	Hints   int                  // Number of hints shown so far
+	Choices []string             // Options to pick from in multiple choice games
+	Prompt  string               // Message the options were sent in
+}
+
+// Check whether anybody scored in the round
+func (r *Round) Scored() bool {
+	return len(r.Order) > 0
+}
+
+// Remember which card answer a loosely matched answer was taken for, so that
+// players can see what actually counted
+func (r *Round) noteMatch(judge AnswerJudge, key, content string) {
+	content = strings.TrimSpace(content)
+	if judge.Key(content) == key {
+		return
+	}
+
+	for _, ans := range r.Card.Answers {
+		if judge.Key(ans) == key {
+			r.Matched[content] = ans
+			return
+		}
+	}
+}
+
+// Game is a single quiz session, put together from pluggable pieces so that
+// game modes only need to provide whatever they do differently
+type Game struct {
+	Transport Transport
+	Channel   string
+	Guild     string // Guild of the channel, empty for DM
+	Name      string // Deck name shown to players
+	Prefix    string // Command prefix in the game's guild
+	Starter   string // Player who started the game, empty if anyone may stop it
+	Quiz      Quiz   // Deck settings, the cards themselves are handed out by Source
+
+	Source    QuestionSource
+	Judge     AnswerJudge
+	Scoring   ScoringPolicy
+	Render    RoundRenderer
+	Image     RenderOptions // How questions are drawn on images
+	Prerender int           // Upcoming questions to draw ahead of time
+
+	WinLimit     int           // Score needed to win, 0 for no limit
+	Timeout      time.Duration // Time to wait per round, or for the whole game if Timed (0 for no limit)
+	IdleTimeout  time.Duration // Time to wait for each answer if Timed, 0 for no limit
+	TimeoutLimit int           // Rounds in a row without answers before aborting
+	Wait         time.Duration // Delay before closing a round after it starts closing
+	Pause        time.Duration // Delay before each question
+	Timed        bool          // Time trial where each answer moves on to the next question
+	Review       bool          // Store failed cards as the channel's and players' review decks
+	Reviewing    bool          // Playing a review deck
+	ReviewUser   string        // Player whose personal review deck is being played, if any
+	ReviewDeck   string        // Deck the questions came from, to keep review decks apart
+	Ranked       bool          // Results count towards records and announcements
+	Hints        bool          // Show hints during rounds, for fewer points
+
+	Players map[string]int // Total score per player
+	Correct map[string]int // Questions answered correctly per player
+	Firsts  map[string]int // Questions answered correctly first per player
+	History []string       // Asked (or in timed games, missed) questions
+	Failed  []Card         // Cards nobody got right
+
+	Participants map[string]bool   // Players who've answered at all
+	Missed       map[string][]Card // Cards each participant didn't get right
+	Asked        int               // Number of questions sent out
+	Answered     int               // Number of answers given in timed games
+	Elapsed      time.Duration     // Time taken by timed games
+
+	c    chan *discordgo.MessageCreate
+	quit chan struct{}
+
+	stopLock sync.Mutex
+	seen     map[string]time.Time // When each player was last active
+	votes    map[string]bool      // Players who voted to stop
+}
+
+// Create a game with regular quiz rules for the given deck
+func newGame(t Transport, quizChannel string, quizname string, quiz Quiz) *Game {
+
+	g := &Game{
+		Transport:    t,
+		Channel:      quizChannel,
+		Guild:        t.ChannelGuild(quizChannel),
+		Name:         quizname,
+		Source:       &deckSource{deck: quiz.Deck},
+		Judge:        newJudge(quiz, quiz.Romaji && !getGuildConfig(t.ChannelGuild(quizChannel)).NoRomaji),
+		Scoring:      firstScoring{},
+		Render:       quizRenderer{},
+		WinLimit:     15,
+		Timeout:      20 * time.Second,
+		TimeoutLimit: 5,
+		Prerender:    PRERENDER_AHEAD,
+		Review:       true,
+		Reviewing:    quizname == "review",
+		ReviewDeck:   quizname,
+		Ranked:       quizname != "review" && !isDeckExpr(quizname) && !isTerminal(t), // combined decks and local games aren't ranked
+		Players:      make(map[string]int),
+		Correct:      make(map[string]int),
+		Firsts:       make(map[string]int),
+		Participants: make(map[string]bool),
+		Missed:       make(map[string][]Card),
+		seen:         make(map[string]time.Time),
+		votes:        make(map[string]bool),
+	}
+
+	g.Prefix = guildPrefix(g.Guild)
+
+	// Replace default timeout with custom if specified
+	if quiz.Timeout > 0 {
+		g.Timeout = time.Duration(quiz.Timeout) * time.Second
+	}
+
+	// Decks and servers may draw their questions differently
+	g.Image = renderOptions(g.Guild, quiz)
+
+	// Servers may prefer shorter or longer games
+	if winLimit := getGuildConfig(g.Guild).WinLimit; winLimit > 0 {
+		g.WinLimit = winLimit
+	}
+
+	// Cards are owned by the source from here on
+	g.Quiz = quiz
+	g.Quiz.Deck = nil
+
+	return g
+}
+
+// Points for a question answered before any hints, one less for every hint shown
+const HINT_POINTS = 3
+
+// Stand-in for characters not revealed by a hint
+const HINT_MASK = '○'
+
+// Optional rules picked when starting a game, like kq!quiz n5 romaji
+type GameOptions struct {
+	Romaji  bool // Accept readings typed in romaji
+	Hints   bool // Show hints when nobody answers
+	Reverse bool // Ask for the questions by their meaning or reading
+}
+
+// Pick game options out of command input, they can go anywhere after the
+// command and deck name
+func parseGameOptions(input []string) (opts GameOptions, rest []string) {
+	for i, arg := range input {
+		switch {
+		case i >= 2 && arg == "romaji":
+			opts.Romaji = true
+		case i >= 2 && arg == "hints":
+			opts.Hints = true
+		case i >= 2 && arg == "reverse":
+			opts.Reverse = true
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	return opts, rest
+}
+
+// Apply game options on top of the deck's own settings
+func (g *Game) applyOptions(opts GameOptions) {
+	// Romaji is quicker to type than kana, so it's not ranked next to IME players
+	if opts.Romaji && !getGuildConfig(g.Guild).NoRomaji {
+		g.Judge = newJudge(g.Quiz, true)
+		g.Ranked = false
+	}
+
+	if opts.Hints {
+		g.Hints = true
+		g.Ranked = false // custom rules aren't comparable
+	}
+
+	// Reversed answers are the original questions, written in kanji
+	if opts.Reverse {
+		g.Judge = readingJudge{variants: true}
+		g.Ranked = false
+	}
+}
+
+// Mark a quiz as started in the given channel and load up its deck, with the
+// game options applied
+// Returns nil if the game can't be played
+func loadGame(t Transport, quizChannel string, quizname string, doShuffle bool, opts GameOptions) *Game {
+
+	// Mark the quiz as started
+	if err := startQuiz(t, quizChannel); err != nil {
+		// Quiz already running, nothing to do here
+		return nil
+	}
+
+	if isDeckDisabled(t.ChannelGuild(quizChannel), quizname) {
+		t.Send(quizChannel, "Quiz is disabled on this server: "+quizname)
+		stopQuiz(t, quizChannel)
+		return nil
+	}
+
+	var quiz Quiz
+	if quizname == "review" {
+		quiz = getReview(quizChannel)
+	} else {
+		quiz = LoadQuiz(quizname, doShuffle)
+	}
+	if len(quiz.Deck) == 0 {
+		t.Send(quizChannel, "Failed to find valid quiz: "+quizname)
+		stopQuiz(t, quizChannel)
+		return nil
+	}
+
+	if opts.Reverse {
+		quiz = reverseQuiz(quiz)
+		if len(quiz.Deck) == 0 {
+			t.Send(quizChannel, "Quiz can't be played in reverse: "+quizname)
+			stopQuiz(t, quizChannel)
+			return nil
+		}
+	}
+
+	g := newGame(t, quizChannel, quizname, quiz)
+	g.applyOptions(opts)
+
+	// Review decks are kept apart by deck and by which way around it's played
+	if quizname == "review" {
+		g.ReviewDeck = reviewSource(quizChannel)
+	} else if opts.Reverse {
+		g.ReviewDeck += REVIEW_REVERSE_SUFFIX
+	}
+
+	return g
+}
+
+// Run the game loop until it's finished, the channel must already be marked as started
+func (g *Game) Run() {
+
+	g.c = make(chan *discordgo.MessageCreate, 100)
+	g.quit = make(chan struct{}, 100)
+
+	// The starter is around when the game begins
+	if len(g.Starter) > 0 {
+		g.markSeen(g.Starter)
+	}
+
+	// Allow stopping the game from outside its messages
+	Ongoing.Lock()
+	Ongoing.Games[g.Channel] = g
+	Ongoing.Unlock()
+
+	killHandler := g.Transport.Subscribe(g.Channel, func(m *discordgo.MessageCreate) {
+		g.markSeen(m.Author.ID)
+
+		// Handle quiz aborts
+		if strings.ToLower(strings.TrimSpace(m.Content)) == g.Prefix+"stop" {
+			if _, reply := g.requestStop(m.Author.ID, g.Transport.Permission(g.Channel, m.Author.ID)); len(reply) > 0 {
+				g.Transport.Send(g.Channel, reply)
+			}
+			return
+		}
+
+		// Relay the message to the quiz loop
+		g.c <- m
+	})
+
+	// Questions are worth more with hints, so it takes more points to win
+	if g.Hints {
+		g.WinLimit *= HINT_POINTS
+	}
+
+	g.Render.Start(g)
+
+	if g.Timed {
+		g.playTimed()
+	} else {
+		g.playRounds()
+	}
+
+	// Clean up
+	killHandler()
+
+	Ongoing.Lock()
+	delete(Ongoing.Games, g.Channel)
+	Ongoing.Unlock()
+
+	// Sleep for a little breathing room
+	time.Sleep(1 * time.Second)
+
+	g.Render.Finish(g)
+
+	// Keep track of everybody's long-term progress
+	recordStats(g)
+	recordResults(g)
+
+	// Store review questions for the channel and everybody who took part
+	if g.Review {
+		review := g.Quiz
+		review.Deck = g.Failed
+
+		if len(g.ReviewUser) > 0 {
+			putUserReview(g.ReviewUser, g.ReviewDeck, copyQuiz(review))
+		} else {
+			putReview(g.Channel, g.ReviewDeck, copyQuiz(review))
+			mergeUserReviews(g.ReviewDeck, g.Quiz, g.Missed)
+		}
+	}
+
+	stopQuiz(g.Transport, g.Channel)
+}
+
+// Play round after round until somebody wins or the players lose interest
+func (g *Game) playRounds() {
+
+	var timeoutCount int
+
+outer:
+	for g.Source.Len() > 0 {
+		g.prerender()
+		time.Sleep(g.Pause)
+
+		// Grab new card from the quiz
+		r, ok := g.nextRound()
+		if !ok {
+			break
+		}
+
+		// Add card to quiz history
+		g.History = append(g.History, g.Render.History(g, r))
+
+		// Drain premature "answers" from channel buffer
+		for len(g.c) > 0 {
+			<-g.c
+		}
+
+		// Send out quiz question
+		g.Render.Question(g, r)
+
+		// Set timeout for no correct answers
+		timeoutChan := time.NewTimer(r.Timeout)
+
+		// Hints come in at even intervals within the timeout
+		hints := g.hints(r.Card)
+		var hintChan <-chan time.Time
+		if len(hints) > 0 {
+			hintChan = time.After(r.Timeout / time.Duration(len(hints)+1))
+		}
+
+	inner:
+		for {
+
+			select {
+			case <-g.quit:
+				// Quit order received, but store remaining questions for reviews
+				if g.Reviewing {
+					// Did this question get answered
+					if !r.Scored() {
+						// Store question for later review deck
+						g.Failed = append(g.Failed, r.Card)
+					}
+
+					// Store unused review questions
+					g.Failed = append(g.Failed, g.Source.Rest()...)
+				}
+				break outer
+			case <-timeoutChan.C:
+				if r.Scored() {
+					break inner
+				}
+
+				g.record(r, false)
+				g.Render.TimedOut(g, r)
+
+				// Store question for later review deck
+				g.Failed = append(g.Failed, r.Card)
+
+				// Mark latest question as failed in quiz history as well
+				g.History[len(g.History)-1] = "*" + g.History[len(g.History)-1]
+
+				timeoutCount++
+				if timeoutCount >= g.TimeoutLimit {
+					g.Transport.Send(g.Channel, "```Too many timeouts in a row reached, aborting quiz.```")
+
+					if g.Reviewing {
+						// Store unused review questions
+						g.Failed = append(g.Failed, g.Source.Rest()...)
+					}
+
+					break outer
+				}
+				break inner
+			case <-hintChan:
+				hintChan = nil
+				if r.Scored() {
+					break
+				}
+
+				g.Render.Hint(g, r, hints[r.Hints])
+				r.Hints++
+
+				if r.Hints < len(hints) {
+					hintChan = time.After(r.Timeout / time.Duration(len(hints)+1))
+				}
+			case msg := <-g.c:
+				g.Participants[msg.Author.ID] = true
+
+				// Handle passing on question
+				if isPass(msg.Content) {
+
+					// Abort the question
+					timeoutChan.Reset(0)
+
+				} else if key, okay := g.Judge.Judge(r.Card, msg.Content); okay {
+					counted, closing := g.Scoring.Score(g, r, msg.Author.ID, key, msg.Content)
+					if closing {
+						timeoutChan.Reset(g.Wait)
+					}
+
+					// Reset timeouts since we're active
+					if counted {
+						timeoutCount = 0
+						r.noteMatch(g.Judge, key, msg.Content)
+					}
+				}
+			}
+		}
+
+		if r.Scored() {
+			g.award(r)
+
+			g.record(r, true)
+			g.Render.Correct(g, r)
+
+			if g.hasWinner() {
+				break outer
+			}
+		}
+	}
+}
+
+// Play a time trial where every answer moves on to the next question
+func (g *Game) playTimed() {
+
+	// Breathing room to read start info
+	g.prerender()
+	time.Sleep(g.Pause)
+
+	// Set start time and quiz timeout
+	startTime := time.Now()
+	var timeoutChan <-chan time.Time
+	if g.Timeout > 0 {
+		timeoutChan = time.After(g.Timeout)
+	}
+
+outer:
+	for g.Source.Len() > 0 {
+
+		// Grab new card from the quiz
+		r, ok := g.nextRound()
+		if !ok {
+			break
+		}
+
+		// Send out quiz question, and get the next ones ready while it's
+		// being answered
+		g.Render.Question(g, r)
+		g.prerender()
+
+		// Give up on players who've wandered off
+		var idleChan <-chan time.Time
+		if g.IdleTimeout > 0 {
+			idleChan = time.After(g.IdleTimeout)
+		}
+
+		select {
+		case <-g.quit:
+			break outer
+		case <-timeoutChan:
+			break outer
+		case <-idleChan:
+			break outer
+		case msg := <-g.c:
+			g.Participants[msg.Author.ID] = true
+
+			// Increase total question count
+			g.Answered++
+
+			// Increase score if correct answer
+			if key, okay := g.Judge.Judge(r.Card, msg.Content); okay {
+				g.Scoring.Score(g, r, msg.Author.ID, key, msg.Content)
+				r.noteMatch(g.Judge, key, msg.Content)
+				g.award(r)
+
+				g.record(r, true)
+				g.Render.Correct(g, r)
+			} else {
+				// Add wrong answer to quiz history
+				g.History = append(g.History, g.Render.History(g, r))
+				g.Failed = append(g.Failed, r.Card)
+
+				g.record(r, false)
+				g.Render.TimedOut(g, r)
+			}
+		}
+	}
+
+	g.Elapsed = time.Since(startTime)
+	if g.Timeout > 0 && g.Elapsed > g.Timeout {
+		g.Elapsed = g.Timeout
+	}
+}
+
+// Grab the next card from the source and prepare a round for it
+func (g *Game) nextRound() (*Round, bool) {
+	card, ok := g.Source.Next()
+	if !ok {
+		return nil, false
+	}
+
+	g.Asked++
+
+	r := &Round{
+		Card:    card,
+		Number:  g.Asked,
+		Timeout: g.Timeout,
+		Answers: make(map[string][]string),
+		Given:   make(map[string]time.Time),
+		Matched: make(map[string]string),
+	}
+
+	// Cards may need more or less time than the rest of the deck
+	if card.Timeout > 0 && !g.Timed {
+		r.Timeout = time.Duration(card.Timeout) * time.Second
+	}
+
+	g.Scoring.Start(g, r)
+
+	return r, true
+}
+
+// Add the points of a finished round to the players' totals
+func (g *Game) award(r *Round) {
+	for player, points := range g.Scoring.Points(r) {
+		if g.Hints {
+			points *= HINT_POINTS - r.Hints
+		}
+		g.Players[player] += points
+	}
+
+	for _, player := range r.Order {
+		g.Correct[player]++
+	}
+	g.Firsts[r.Order[0]]++
+}
+
+// Keep track of the cards participants missed, and let the source know how
+// a finished round went if it cares
+func (g *Game) record(r *Round, correct bool) {
+	for player := range g.Participants {
+		if !hasString(r.Order, player) {
+			g.Missed[player] = append(g.Missed[player], r.Card)
+		}
+	}
+
+	if recorder, ok := g.Source.(ResultRecorder); ok {
+		recorder.Record(r.Card, correct)
+	}
+}
+
+// Check whether any player has reached the win limit
+func (g *Game) hasWinner() bool {
+	if g.WinLimit <= 0 {
+		return false
+	}
+
+	for _, score := range g.Players {
+		if score >= g.WinLimit {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Players with the top score once it's past the win limit
+func (g *Game) Winners() (winners []string) {
+	if g.WinLimit <= 0 || g.Reviewing {
+		return nil
+	}
+
+	rankingList := ranking(g.Players)
+	for _, p := range rankingList {
+		if p.Score >= g.WinLimit && p.Score == rankingList[0].Score {
+			winners = append(winners, p.Name)
+		}
+	}
+
+	return winners
+}
+
+// Title shown for a question in round results, empty when the answer would be spoiled
+func (g *Game) questionTitle(card Card) string {
+	if g.Quiz.media(card) != MEDIA_IMAGE && len(card.Answers) > 0 {
+		return ""
+	}
+
+	return truncate(card.Question, 100)
+}
+
+// Hints to show one by one while nobody has answered a card, starting with
+// its length or the card's own hint, then its first character
+func (g *Game) hints(card Card) []string {
+	if !g.Hints {
+		return nil
+	}
+
+	answer := []rune(card.primaryAnswer())
+	mask := func(shown int) string {
+		masked := make([]rune, len(answer))
+		for i, r := range answer {
+			if i < shown || unicode.IsSpace(r) {
+				masked[i] = r
+			} else {
+				masked[i] = HINT_MASK
+			}
+		}
+		return string(masked)
+	}
+
+	var hints []string
+	if len(card.Hint) > 0 {
+		hints = append(hints, card.Hint)
+	} else if len(answer) > 0 {
+		hints = append(hints, mask(0))
+	}
+
+	// Showing the first character of a single character answer gives it away
+	if len(answer) > 1 {
+		hints = append(hints, mask(1))
+	}
+
+	return hints
+}
+
+// Entry to represent a card in the quiz history
+func (g *Game) historyEntry(card Card) string {
+	if g.Quiz.media(card) != MEDIA_IMAGE && len(card.Answers) > 0 {
+		return card.primaryAnswer()
+	}
+
+	return card.Question
+}
+
+// Start drawing the images of upcoming questions in the background, so that
+// they're ready by the time they're asked
+func (g *Game) prerender() {
+	upcoming, ok := g.Source.(UpcomingSource)
+	if !ok || g.Prerender <= 0 || fontTtf == nil {
+		return
+	}
+
+	for _, card := range upcoming.Upcoming(g.Prerender) {
+		if g.Quiz.media(card) == MEDIA_IMAGE {
+			Images.Prepare(card.Question, g.Image)
+		}
+	}
+}
+
+// Send out a card's question based on its media type
+func (g *Game) sendQuestion(card Card) {
+	switch g.Quiz.media(card) {
+	case MEDIA_TEXT:
+		g.Transport.Send(g.Channel, fmt.Sprintf("```\n%s```", card.Question))
+	case MEDIA_URL:
+		g.Transport.Send(g.Channel, card.Question)
+	case MEDIA_FILE:
+		g.Transport.SendFile(g.Channel, filepath.Join(QUIZ_FOLDER, card.Question))
+	default:
+		g.Transport.SendImage(g.Channel, card.Question, g.Image)
+	}
+}
+
+// Cards handed out from a loaded deck, either from the back of a shuffled
+// deck or in order from the front
+type deckSource struct {
+	deck       []Card
+	sequential bool
+}
+
+func (d *deckSource) Next() (card Card, ok bool) {
+	if len(d.deck) == 0 {
+		return card, false
+	}
+
+	if d.sequential {
+		card, d.deck = d.deck[0], d.deck[1:]
+	} else {
+		card, d.deck = d.deck[len(d.deck)-1], d.deck[:len(d.deck)-1]
+	}
+
+	return card, true
+}
+
+func (d *deckSource) Len() int {
+	return len(d.deck)
+}
+
+func (d *deckSource) Rest() []Card {
+	return d.deck
+}
+
+func (d *deckSource) Upcoming(n int) []Card {
+	n = min(n, len(d.deck))
+	if d.sequential {
+		return d.deck[:n]
+	}
+
+	upcoming := make([]Card, n)
+	for i := range upcoming {
+		upcoming[i] = d.deck[len(d.deck)-1-i]
+	}
+
+	return upcoming
+}
+
+// Accepts any of the card's answers regardless of case, width or kana type
+type readingJudge struct {
+	romaji     bool // Also accept readings typed in romaji
+	longVowels bool // Treat ー the same as the vowel it lengthens
+	smallKana  bool // Treat small kana the same as full size ones
+	variants   bool // Accept old and alternative forms of kanji
+}
+
+func (rj readingJudge) Judge(card Card, answer string) (string, bool) {
+	answer = rj.Key(answer)
+
+	var spellings []string
+	if rj.romaji {
+		for _, spelling := range romajiToKana(answer) {
+			spellings = append(spellings, rj.Key(spelling))
+		}
+	}
+
+	for _, ans := range card.Answers {
+		ans = rj.Key(ans)
+		if ans == answer || hasString(spellings, ans) {
+			return ans, true
+		}
+	}
+
+	return "", false
+}
+
+func (rj readingJudge) Key(answer string) string {
+	if rj.variants {
+		answer = foldVariants(answer)
+	}
+
+	answer = normalizeKana(answer, rj.longVowels)
+	if rj.smallKana {
+		answer = foldSmallKana(answer)
+	}
+
+	return answer
+}
+
+// Check if message is a request to pass on the current question
+func isPass(content string) bool {
+	return content == ".." || content == "。。"
+}
+
+// Parse provided winLimit with sane defaults
+func parseWinLimit(winLimitGiven string, winLimit int, deckSize int) int {
+	if i, err := strconv.Atoi(winLimitGiven); err == nil {
+		if i > deckSize {
+			i = deckSize
+		}
+
+		if i > 100 {
+			winLimit = 100
+		} else if i < 1 {
+			winLimit = 1
+		} else {
+			winLimit = i
+		}
+	}
+
+	return winLimit
+}
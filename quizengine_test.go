@@ -0,0 +1,584 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Message recorded by the in-memory transport
+type fakeMessage struct {
+	Channel string
+	Text    string
+	Image   string
+	File    string
+	Choices []string
+	Embed   *discordgo.MessageEmbed
+}
+
+// In-memory transport to play games without Discord
+type fakeTransport struct {
+	sync.Mutex
+	handlers map[string]func(m *discordgo.MessageCreate)
+	sent     chan fakeMessage
+}
+
+func newFakeTransport() *fakeTransport {
+	return &fakeTransport{
+		handlers: make(map[string]func(m *discordgo.MessageCreate)),
+		sent:     make(chan fakeMessage, 100),
+	}
+}
+
+func (ft *fakeTransport) Send(cid string, msg string) *discordgo.Message {
+	ft.sent <- fakeMessage{Channel: cid, Text: msg}
+	return &discordgo.Message{ChannelID: cid, Content: msg}
+}
+
+func (ft *fakeTransport) SendImage(cid string, text string, opts RenderOptions) *discordgo.Message {
+	ft.sent <- fakeMessage{Channel: cid, Image: text}
+	return &discordgo.Message{ChannelID: cid}
+}
+
+func (ft *fakeTransport) SendFile(cid string, path string) *discordgo.Message {
+	ft.sent <- fakeMessage{Channel: cid, File: path}
+	return &discordgo.Message{ChannelID: cid}
+}
+
+func (ft *fakeTransport) SendChoices(cid string, choices []string) *discordgo.Message {
+	ft.sent <- fakeMessage{Channel: cid, Choices: choices}
+	return &discordgo.Message{ChannelID: cid, ID: "choices"}
+}
+
+func (ft *fakeTransport) SendEmbed(cid string, embed *discordgo.MessageEmbed) *discordgo.Message {
+	ft.sent <- fakeMessage{Channel: cid, Embed: embed}
+	return &discordgo.Message{ChannelID: cid}
+}
+
+func (ft *fakeTransport) Subscribe(cid string, handler func(m *discordgo.MessageCreate)) func() {
+	ft.Lock()
+	ft.handlers[cid] = handler
+	ft.Unlock()
+
+	return func() {
+		ft.Lock()
+		delete(ft.handlers, cid)
+		ft.Unlock()
+	}
+}
+
+func (ft *fakeTransport) SetStatus(status string) {}
+
+func (ft *fakeTransport) ChannelGuild(cid string) string {
+	return ""
+}
+
+func (ft *fakeTransport) IsMember(guildID, userID string) bool {
+	return false
+}
+
+func (ft *fakeTransport) Permission(cid, userID string) Permission {
+	if userID == "mod" {
+		return PERM_MODERATOR
+	}
+	return PERM_EVERYONE
+}
+
+// Post a message from a user in the given channel
+func (ft *fakeTransport) say(cid, user, content string) {
+	ft.Lock()
+	handler := ft.handlers[cid]
+	ft.Unlock()
+
+	if handler != nil {
+		handler(&discordgo.MessageCreate{Message: &discordgo.Message{
+			ChannelID: cid,
+			Content:   content,
+			Author:    &discordgo.User{ID: user},
+		}})
+	}
+}
+
+// Wait for the next message sent by the game
+func (ft *fakeTransport) next(t *testing.T) fakeMessage {
+	t.Helper()
+
+	select {
+	case msg := <-ft.sent:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for message")
+	}
+
+	return fakeMessage{}
+}
+
+// Quick game on a small text deck with no waiting around
+func newTestGame(t *testing.T, ft *fakeTransport, cid string, quizname string) *Game {
+	quiz := Quiz{
+		Description: "Test deck",
+		Type:        "text",
+		Deck: []Card{
+			{Question: "q1", Answers: []string{"イチ"}},
+			{Question: "q2", Answers: []string{"に", "ふた"}},
+			{Question: "q3", Answers: []string{"さん"}},
+		},
+	}
+
+	if err := startQuiz(ft, cid); err != nil {
+		t.Fatal(err)
+	}
+
+	g := newGame(ft, cid, quizname, quiz)
+	g.Timeout = 100 * time.Millisecond
+
+	return g
+}
+
+// Start the game and return a channel closed when it's finished
+func runTestGame(g *Game) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		g.Run()
+		close(done)
+	}()
+
+	return done
+}
+
+func TestGameWinner(t *testing.T) {
+	t.Parallel()
+
+	ft := newFakeTransport()
+	g := newTestGame(t, ft, "winner", "test")
+	g.Timeout = 5 * time.Second
+	g.WinLimit = 2
+	done := runTestGame(g)
+
+	if msg := ft.next(t); !strings.Contains(msg.Text, "First to 2 points wins") {
+		t.Errorf("Unexpected start message: %+v", msg)
+	}
+
+	// Cards come from the back of the deck
+	if msg := ft.next(t); msg.Text != "```\nq3```" {
+		t.Errorf("Unexpected question: %+v", msg)
+	}
+	ft.say("winner", "alice", "wrong")
+	ft.say("winner", "alice", "サン")
+	if msg := ft.next(t); msg.Embed == nil || msg.Embed.Fields[0].Value != "<@alice> 1p" {
+		t.Errorf("Unexpected round result: %+v", msg)
+	}
+
+	ft.next(t)
+	ft.say("winner", "alice", "ふた")
+	ft.next(t)
+
+	msg := ft.next(t)
+	<-done
+	if msg.Embed == nil || msg.Embed.Fields[0].Name != "Winner" || msg.Embed.Fields[0].Value != "<@alice>: 2 points\n" {
+		t.Errorf("Unexpected scoreboard: %+v", msg.Embed)
+	}
+	if msg.Embed.Footer.Text != "さん　に" {
+		t.Errorf("Unexpected history: %s", msg.Embed.Footer.Text)
+	}
+	if hasQuiz("winner") {
+		t.Error("Quiz should be stopped")
+	}
+}
+
+func TestGameTimeouts(t *testing.T) {
+	t.Parallel()
+
+	ft := newFakeTransport()
+	g := newTestGame(t, ft, "timeouts", "test")
+	g.TimeoutLimit = 2
+	done := runTestGame(g)
+
+	ft.next(t)
+
+	// Pass on the first question, let the second one time out
+	ft.next(t)
+	ft.say("timeouts", "carol", "..")
+	if msg := ft.next(t); msg.Embed == nil || !strings.HasPrefix(msg.Embed.Title, UNICODE_NO_ENTRY) {
+		t.Errorf("Expected pass to time out: %+v", msg)
+	}
+
+	ft.next(t)
+	if msg := ft.next(t); msg.Embed == nil || msg.Embed.Description != "**に, ふた**" {
+		t.Errorf("Expected question to time out: %+v", msg)
+	}
+	if msg := ft.next(t); !strings.Contains(msg.Text, "Too many timeouts") {
+		t.Errorf("Expected quiz to abort: %+v", msg)
+	}
+
+	msg := ft.next(t)
+	<-done
+	if msg.Embed == nil || msg.Embed.Footer.Text != "*さん　*に" {
+		t.Errorf("Unexpected scoreboard: %+v", msg.Embed)
+	}
+
+	review := getReview("timeouts")
+	if len(review.Deck) != 2 || review.Type != "text" {
+		t.Errorf("Unexpected review deck: %+v", review)
+	}
+
+	// Looking at the review deck doesn't use it up
+	if review := getReview("timeouts"); len(review.Deck) != 2 {
+		t.Errorf("Review deck should stay in place: %+v", review)
+	}
+
+	// Participants get the cards they missed in their own review deck
+	if review := getUserReview("carol", "test"); len(review.Deck) != 2 {
+		t.Errorf("Unexpected personal review deck: %+v", review)
+	}
+}
+
+func TestGameStopReview(t *testing.T) {
+	t.Parallel()
+
+	ft := newFakeTransport()
+	g := newTestGame(t, ft, "stop", "review")
+	g.Timeout = 5 * time.Second
+	done := runTestGame(g)
+
+	ft.next(t)
+	ft.next(t)
+	ft.say("stop", "alice", "kq!stop")
+	ft.next(t)
+	<-done
+
+	// Unanswered and unused cards go back into the review deck
+	review := getReview("stop")
+	if len(review.Deck) != 3 {
+		t.Errorf("Expected whole deck back for review: %+v", review)
+	}
+}
+
+func TestGameMulti(t *testing.T) {
+	t.Parallel()
+
+	ft := newFakeTransport()
+	g := newTestGame(t, ft, "multi", "test")
+	g.Source = &deckSource{deck: []Card{{Question: "q", Answers: []string{"a", "b", "c"}}}}
+	g.Scoring = multiScoring{limit: 2}
+	g.Render = multiRenderer{}
+	g.Timeout = 5 * time.Second
+	g.Wait = time.Second
+	done := runTestGame(g)
+
+	ft.next(t)
+	ft.next(t)
+	ft.say("multi", "alice", "A")
+	ft.say("multi", "alice", "b")
+	ft.say("multi", "bob", "c")
+	ft.say("multi", "alice", "c")
+	ft.next(t)
+	<-done
+
+	if g.Players["alice"] != 2 || g.Players["bob"] != 1 {
+		t.Errorf("Unexpected multi scores: %+v", g.Players)
+	}
+}
+
+func TestGameGauntlet(t *testing.T) {
+	t.Parallel()
+
+	ft := newFakeTransport()
+	g := newTestGame(t, ft, "gauntlet", "test")
+	g.Timed = true
+	g.Timeout = 5 * time.Second
+	g.Render = gauntletRenderer{player: &discordgo.User{ID: "alice"}}
+	done := runTestGame(g)
+
+	ft.next(t)
+	ft.next(t)
+	ft.say("gauntlet", "alice", "さん")
+	ft.next(t)
+	ft.say("gauntlet", "alice", "wrong")
+	ft.next(t)
+	ft.say("gauntlet", "alice", "いち")
+
+	msg := ft.next(t)
+	<-done
+	if msg.Embed == nil || !strings.HasPrefix(msg.Embed.Description, "1.33 points") {
+		t.Errorf("Unexpected gauntlet score: %+v", msg.Embed)
+	}
+
+	// Mistakes of text decks show their answer
+	if msg.Embed.Footer.Text != "Mistakes: に" {
+		t.Errorf("Unexpected mistakes: %s", msg.Embed.Footer.Text)
+	}
+}
+
+func TestGameIdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	ft := newFakeTransport()
+	g := newTestGame(t, ft, "idle", "test")
+	g.Timed = true
+	g.Timeout = 0
+	g.IdleTimeout = 200 * time.Millisecond
+	g.Render = gauntletRenderer{player: &discordgo.User{ID: "alice"}}
+	done := runTestGame(g)
+
+	ft.next(t)
+	ft.next(t)
+
+	// Only the wait for each answer is limited, not the whole game
+	time.Sleep(150 * time.Millisecond)
+	ft.say("idle", "alice", "さん")
+	time.Sleep(150 * time.Millisecond)
+	ft.say("idle", "alice", "に")
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the game to end once nobody answered")
+	}
+	if g.Answered != 2 || g.Correct["alice"] != 2 {
+		t.Errorf("Expected 2 correct answers, got %d of %d", g.Correct["alice"], g.Answered)
+	}
+}
+
+func TestGameStopPermissions(t *testing.T) {
+	t.Parallel()
+
+	g := newGame(newFakeTransport(), "permissions", "test", Quiz{})
+	g.Starter = "alice"
+	g.quit = make(chan struct{}, 10)
+
+	g.markSeen("alice")
+	g.markSeen("bob")
+	g.markSeen("carol")
+
+	// Others can't stop a quiz while its starter is around
+	if stopped, reply := g.requestStop("bob", PERM_EVERYONE); stopped || !strings.Contains(reply, "<@alice>") {
+		t.Errorf("Unexpected stop by bob: %t %q", stopped, reply)
+	}
+
+	// Moderators can
+	if stopped, _ := g.requestStop("mod", PERM_MODERATOR); !stopped {
+		t.Error("Moderator should stop the quiz")
+	}
+
+	// Once the starter is gone, a majority of the active players is needed
+	g.stopLock.Lock()
+	g.seen["alice"] = time.Now().Add(-STOP_VOTE_ABSENCE)
+	g.stopLock.Unlock()
+
+	if stopped, reply := g.requestStop("bob", PERM_EVERYONE); stopped || reply != "Vote to stop the quiz: 1/2" {
+		t.Errorf("Unexpected vote by bob: %t %q", stopped, reply)
+	}
+	if stopped, _ := g.requestStop("carol", PERM_EVERYONE); !stopped {
+		t.Error("Vote should stop the quiz")
+	}
+}
+
+func TestGameCardMedia(t *testing.T) {
+	t.Parallel()
+
+	ft := newFakeTransport()
+	g := newTestGame(t, ft, "media", "test")
+	g.Source = &deckSource{deck: []Card{
+		{Question: "q", Answers: []string{"いち"}, Media: MEDIA_IMAGE},
+		{Question: "pics/two.png", Answers: []string{"に", "ふた"}, Media: MEDIA_FILE, Primary: "ふた"},
+	}}
+	g.TimeoutLimit = 2
+	done := runTestGame(g)
+
+	ft.next(t)
+	if msg := ft.next(t); msg.File != filepath.Join(QUIZ_FOLDER, "pics/two.png") {
+		t.Errorf("Expected local image file: %+v", msg)
+	}
+	if msg := ft.next(t); msg.Embed == nil || strings.Contains(msg.Embed.Title, "two.png") {
+		t.Errorf("File name shouldn't be shown: %+v", msg)
+	}
+
+	// Cards can override the deck's text type
+	if msg := ft.next(t); msg.Image != "q" {
+		t.Errorf("Expected rendered image: %+v", msg)
+	}
+	ft.next(t)
+	ft.next(t)
+
+	msg := ft.next(t)
+	<-done
+	if msg.Embed == nil || msg.Embed.Footer.Text != "*ふた　*q" {
+		t.Errorf("Unexpected history: %+v", msg.Embed)
+	}
+}
+
+func TestGameHints(t *testing.T) {
+	t.Parallel()
+
+	ft := newFakeTransport()
+	g := newTestGame(t, ft, "hints", "test")
+	g.Source = &deckSource{deck: []Card{
+		{Question: "q1", Answers: []string{"ねこ"}},
+		{Question: "q2", Answers: []string{"いぬ"}, Hint: "Barks"},
+	}}
+	g.applyOptions(GameOptions{Hints: true})
+	g.Timeout = 1500 * time.Millisecond
+	g.WinLimit = 2
+	done := runTestGame(g)
+
+	if msg := ft.next(t); !strings.Contains(msg.Text, "First to 6 points wins") {
+		t.Errorf("Win limit should be scaled with hints: %+v", msg)
+	}
+
+	// Cards with a hint of their own show it first
+	ft.next(t)
+	if msg := ft.next(t); msg.Text != "```Hint: Barks```" {
+		t.Errorf("Expected the card's hint: %+v", msg)
+	}
+	if msg := ft.next(t); msg.Text != "```Hint: い○```" {
+		t.Errorf("Expected first character: %+v", msg)
+	}
+	ft.say("hints", "dave", "いぬ")
+	ft.next(t)
+	if g.Players["dave"] != 1 {
+		t.Errorf("Expected 1 point after two hints: %+v", g.Players)
+	}
+
+	ft.next(t)
+	if msg := ft.next(t); msg.Text != "```Hint: ○○```" {
+		t.Errorf("Expected answer length: %+v", msg)
+	}
+	ft.say("hints", "dave", "ねこ")
+	ft.next(t)
+	ft.next(t)
+	<-done
+
+	if g.Players["dave"] != 3 || g.Ranked {
+		t.Errorf("Expected 2 points after one hint in an unranked game: %+v", g.Players)
+	}
+}
+
+func TestGameChoice(t *testing.T) {
+	t.Parallel()
+
+	ft := newFakeTransport()
+	g := newTestGame(t, ft, "choice", "test")
+	g.Judge = choiceJudge{}
+	g.Scoring = choiceScoring{pool: []string{"いち", "に", "さん", "よん", "ご"}}
+	g.Render = choiceRenderer{}
+	g.Source = &deckSource{deck: []Card{
+		{Question: "Pick one\n\na) いぬ\nb) ねこ\nc) とり", Answers: []string{"ねこ"}},
+		{Question: "q1", Answers: []string{"イチ"}},
+	}}
+	g.Timeout = 5 * time.Second
+	done := runTestGame(g)
+
+	ft.next(t)
+	ft.next(t)
+	msg := ft.next(t)
+	if len(msg.Choices) != 4 || !hasString(msg.Choices, "イチ") {
+		t.Fatalf("Expected the answer among four options: %+v", msg)
+	}
+
+	// Only the first pick counts, and clicks on old questions don't count at all
+	right := string(CHOICE_LETTERS[indexOfString(msg.Choices, "イチ")])
+	wrong := string(CHOICE_LETTERS[(indexOfString(msg.Choices, "イチ")+1)%4])
+	ft.say("choice", "erin", wrong)
+	ft.say("choice", "erin", right)
+	ft.say("choice", "frank", "old:"+right)
+	ft.say("choice", "frank", "choices:"+right)
+	if msg := ft.next(t); msg.Embed == nil || !strings.Contains(msg.Embed.Fields[0].Value, "⛔ <@erin>") || !strings.Contains(msg.Embed.Fields[0].Value, "✅ <@frank>") {
+		t.Errorf("Unexpected picks: %+v", msg.Embed)
+	}
+
+	// Options written into the question are used as they are
+	if msg := ft.next(t); msg.Text != "```\nPick one```" {
+		t.Errorf("Expected options taken out of the question: %+v", msg)
+	}
+	if msg := ft.next(t); len(msg.Choices) != 3 || msg.Choices[1] != "ねこ" {
+		t.Errorf("Expected options from the question: %+v", msg)
+	}
+	ft.say("choice", "erin", "B")
+	ft.next(t)
+
+	ft.next(t)
+	<-done
+	if g.Players["erin"] != 1 || g.Players["frank"] != 1 {
+		t.Errorf("Unexpected scores: %+v", g.Players)
+	}
+}
+
+// Position of a string in a slice, or -1 if it isn't there
+func indexOfString(slice []string, s string) int {
+	for i, v := range slice {
+		if v == s {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func TestGameSequentialRange(t *testing.T) {
+	loadQuizList()
+	ft := newFakeTransport()
+
+	// Malformed ranges are turned down without starting a game
+	for _, invalid := range []string{"5", "x-10", "1.5-10"} {
+		runQuizSequential(ft, "sequential", "alice", "n5", invalid, 0, 0, GameOptions{})
+		if msg := ft.next(t); !strings.HasPrefix(msg.Text, "Invalid range") {
+			t.Errorf("Expected a usage error for '%s', got %+v", invalid, msg)
+		}
+	}
+	Ongoing.Lock()
+	running := Ongoing.ChannelID["sequential"]
+	Ongoing.Unlock()
+	if running {
+		t.Fatal("Game left running after an invalid range")
+	}
+
+	// Valid ranges start from the given card
+	done := make(chan struct{})
+	go func() {
+		runQuizSequential(ft, "sequential", "alice", "n5", "3-10", 0, 0, GameOptions{})
+		close(done)
+	}()
+
+	msg := ft.next(t)
+	for len(msg.Image) == 0 {
+		msg = ft.next(t)
+	}
+	if expected := LoadQuiz("n5", false).Deck[3].Question; msg.Image != expected {
+		t.Errorf("Expected to start with %s, got %+v", expected, msg)
+	}
+	ft.say("sequential", "alice", "kq!stop")
+	for {
+		select {
+		case <-ft.sent:
+			continue
+		case <-done:
+		}
+		break
+	}
+}
+
+func TestGameOptionsRanked(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   GameOptions
+		ranked bool
+	}{
+		{"plain", GameOptions{}, true},
+		{"romaji", GameOptions{Romaji: true}, false},
+		{"hints", GameOptions{Hints: true}, false},
+		{"reverse", GameOptions{Reverse: true}, false},
+	}
+
+	for _, test := range tests {
+		g := newGame(newFakeTransport(), "options", "test", Quiz{})
+		g.applyOptions(test.opts)
+		if g.Ranked != test.ranked {
+			t.Errorf("Expected %s games to have ranked %v", test.name, test.ranked)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Lines of unchanged context around each change in a diff
+const DIFF_CONTEXT = 3
+
+// QuizFix is a proposed rewrite of a deck file
+type QuizFix struct {
+	File     string // Path of the deck file
+	Original []byte // File contents the fix was made from
+	Fixed    []byte // File contents with the fix
+}
+
+// Propose a fix for the problems validators can repair in the deck file at
+// given path, only touching the cards that change so that the rest of the file
+// keeps its layout and order
+// Returns nil if there's nothing to fix
+func fixQuizFile(path string) (*QuizFix, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var quiz Quiz
+	if err := json.Unmarshal(raw, &quiz); err != nil {
+		return nil, fmt.Errorf("Unmarshalling json: %w", err)
+	}
+	spans, err := cardSpans(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(spans) != len(quiz.Deck) {
+		return nil, fmt.Errorf("Found %d cards, expected %d", len(spans), len(quiz.Deck))
+	}
+
+	fixed, hasError := checkDuplicates(quiz)
+	if !hasError {
+		return nil, nil
+	}
+
+	// Merged cards take the place of the first card with their question, and
+	// the others are dropped along with the separator before them, which is
+	// always there since the first card of a deck can't be a duplicate
+	merged := make(map[string]Card)
+	for _, card := range fixed.Deck {
+		merged[card.Question] = card
+	}
+
+	var b bytes.Buffer
+	last := 0 // Where the part of raw that's not written yet starts
+	for i, card := range quiz.Deck {
+		start, end := spans[i][0], spans[i][1]
+
+		replacement, first := merged[card.Question]
+		if !first {
+			b.Write(raw[last:spans[i-1][1]])
+			last = end
+			continue
+		}
+		delete(merged, card.Question)
+
+		if reflect.DeepEqual(card, replacement) {
+			continue
+		}
+		line, err := formatCard(replacement)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(raw[last:start])
+		b.Write(line)
+		last = end
+	}
+	b.Write(raw[last:])
+
+	return &QuizFix{File: path, Original: raw, Fixed: b.Bytes()}, nil
+}
+
+// Byte ranges of the cards in a deck file, in deck order
+func cardSpans(raw []byte) ([][2]int, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("Deck isn't a JSON object")
+	}
+
+	var spans [][2]int
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key != "deck" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return nil, fmt.Errorf("Deck isn't a JSON array")
+		}
+		for dec.More() {
+			// The decoder stops right after the previous token, so skip
+			// the separator to find where the card starts
+			start := int(dec.InputOffset())
+			for start < len(raw) && strings.IndexByte(" \t\r\n,", raw[start]) >= 0 {
+				start++
+			}
+
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+			spans = append(spans, [2]int{start, int(dec.InputOffset())})
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	return spans, nil
+}
+
+// Diff shows the fix as a unified diff
+func (fix QuizFix) Diff() string {
+	return unifiedDiff(fix.File, splitLines(fix.Original), splitLines(fix.Fixed))
+}
+
+// Apply writes the fix to the deck file, unless the file changed since the
+// fix was made
+func (fix QuizFix) Apply() error {
+	current, err := os.ReadFile(fix.File)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, fix.Original) {
+		return fmt.Errorf("%s changed since the fix was made", fix.File)
+	}
+
+	return writeFileAtomic(fix.File, fix.Fixed)
+}
+
+// Split text into lines, without the line breaks
+func splitLines(data []byte) []string {
+	lines := strings.Split(string(data), "\n")
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// One line of a diff: ' ' for unchanged, '-' for removed and '+' for added
+type diffLine struct {
+	Op   byte
+	Text string
+}
+
+// Line by line difference between a and b, using Myers' algorithm
+func diffLines(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+
+	// Furthest reaching x for every diagonal k after each step, covering
+	// diagonals -d to d only
+	var trace [][]int
+	found := false
+	for d := 0; d <= n+m && !found; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				found = true
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+
+	// Walk back from the end, collecting lines in reverse
+	var lines []diffLine
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1] // Diagonals -(d-1) to d-1
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := prev[prevK+d-1]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			lines = append(lines, diffLine{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			lines = append(lines, diffLine{'+', b[y]})
+		} else {
+			x--
+			lines = append(lines, diffLine{'-', a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		lines = append(lines, diffLine{' ', a[x]})
+	}
+
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+
+	return lines
+}
+
+// Unified diff between two versions of a file, empty if they're the same
+func unifiedDiff(name string, a, b []string) string {
+	lines := diffLines(a, b)
+
+	var out strings.Builder
+	for i := 0; i < len(lines); {
+		if lines[i].Op == ' ' {
+			i++
+			continue
+		}
+
+		// Gather changes until there's enough unchanged lines between them
+		start := max(i-DIFF_CONTEXT, 0)
+		end := i
+		for j := i; j < len(lines) && j <= end+2*DIFF_CONTEXT; j++ {
+			if lines[j].Op != ' ' {
+				end = j
+			}
+		}
+		end = min(end+DIFF_CONTEXT+1, len(lines))
+
+		// Line numbers where the hunk starts in each version
+		oldStart, newStart := 1, 1
+		for _, line := range lines[:start] {
+			if line.Op != '+' {
+				oldStart++
+			}
+			if line.Op != '-' {
+				newStart++
+			}
+		}
+		var oldCount, newCount int
+		for _, line := range lines[start:end] {
+			if line.Op != '+' {
+				oldCount++
+			}
+			if line.Op != '-' {
+				newCount++
+			}
+		}
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", name, name)
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, line := range lines[start:end] {
+			fmt.Fprintf(&out, "%c%s\n", line.Op, line.Text)
+		}
+		i = end
+	}
+
+	return out.String()
+}
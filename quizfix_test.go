@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := strings.Split("1 2 3 4 5 6 7 8 9 10 11 12 13 14 15", " ")
+	b := strings.Split("1 2 x 4 5 6 7 8 9 10 12 13 14 15 16", " ")
+
+	expected := `--- deck.json
++++ deck.json
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++x
+ 4
+ 5
+ 6
+@@ -8,8 +8,8 @@
+ 8
+ 9
+ 10
+-11
+ 12
+ 13
+ 14
+ 15
++16
+`
+	if diff := cmp.Diff(expected, unifiedDiff("deck.json", a, b)); diff != "" {
+		t.Errorf("Unexpected diff (-want +got):\n%s", diff)
+	}
+
+	if diff := unifiedDiff("deck.json", a, a); len(diff) != 0 {
+		t.Errorf("Expected no diff for the same lines, got:\n%s", diff)
+	}
+	if diff := unifiedDiff("deck.json", nil, []string{"new"}); diff != "--- deck.json\n+++ deck.json\n@@ -0,0 +1,1 @@\n+new\n" {
+		t.Errorf("Unexpected diff for a new file:\n%s", diff)
+	}
+}
+
+func TestFixQuizFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deck.json")
+
+	// Other layouts and line breaks are left alone
+	original := "{\r\n    \"description\": \"Spread out\",\r\n    \"deck\": [\r\n" +
+		"        {\r\n            \"question\": \"a\",\r\n            \"answers\": [ \"1\" ]\r\n        },\r\n" +
+		"        { \"question\": \"b\", \"answers\": [ \"2\" ] },\r\n" +
+		"        {\r\n            \"question\": \"a\",\r\n            \"answers\": [ \"3\" ]\r\n        }\r\n" +
+		"    ]\r\n}\r\n"
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fix, err := fixQuizFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "{\r\n    \"description\": \"Spread out\",\r\n    \"deck\": [\r\n" +
+		"        { \"question\": \"a\", \"answers\": [ \"1\", \"3\" ] },\r\n" +
+		"        { \"question\": \"b\", \"answers\": [ \"2\" ] }\r\n" +
+		"    ]\r\n}\r\n"
+	if diff := cmp.Diff(expected, string(fix.Fixed)); diff != "" {
+		t.Errorf("Unexpected fix (-want +got):\n%s", diff)
+	}
+
+	// Nothing to fix the second time around
+	if err := fix.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if fix, err := fixQuizFile(path); fix != nil || err != nil {
+		t.Errorf("Expected nothing to fix, got %v and %v", fix, err)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Write a quiz as JSON in the layout decks are kept in, one field per line and
+// one card per line, so that formatting it again gives the same bytes
+func formatQuiz(quiz Quiz) ([]byte, error) {
+	raw, err := marshalJSON(quiz)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteString("{")
+	for n := 0; dec.More(); n++ {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n\t")
+		if err := writeInline(&b, key); err != nil {
+			return nil, err
+		}
+		b.WriteString(": ")
+
+		if key != "deck" {
+			if err := copyInline(&b, dec); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// Cards get a line each
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		b.WriteString("[")
+		var cards int
+		for ; dec.More(); cards++ {
+			if cards > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n\t\t")
+			if err := copyInline(&b, dec); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		if cards > 0 {
+			b.WriteString("\n\t")
+		}
+		b.WriteString("]")
+	}
+	b.WriteString("\n}\n")
+
+	return b.Bytes(), nil
+}
+
+// Copy the next JSON value from the decoder on a single line, with spaces
+// inside brackets and after colons, like { "question": "未来", "answers": [ "みらい" ] }
+func copyInline(b *bytes.Buffer, dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return writeInline(b, tok)
+	}
+
+	closing := "]"
+	if delim == '{' {
+		closing = "}"
+	}
+
+	b.WriteString(delim.String())
+	var n int
+	for ; dec.More(); n++ {
+		if n > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(" ")
+
+		if delim == '{' {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if err := writeInline(b, key); err != nil {
+				return err
+			}
+			b.WriteString(": ")
+		}
+
+		if err := copyInline(b, dec); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	if n > 0 {
+		b.WriteString(" ")
+	}
+	b.WriteString(closing)
+
+	return nil
+}
+
+// Write a single JSON token that isn't a bracket
+func writeInline(b *bytes.Buffer, tok json.Token) error {
+	raw, err := marshalJSON(tok)
+	if err != nil {
+		return fmt.Errorf("Formatting %v: %w", tok, err)
+	}
+	b.Write(raw)
+
+	return nil
+}
+
+// Marshal to JSON without escaping HTML characters, which are common in decks
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Write a single card on one line, the way formatQuiz lays out cards
+func formatCard(card Card) ([]byte, error) {
+	raw, err := marshalJSON(card)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	if err := copyInline(&b, json.NewDecoder(bytes.NewReader(raw))); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
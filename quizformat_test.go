@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFormatQuiz(t *testing.T) {
+	formatted := `{
+	"version": 2,
+	"description": "A <test> deck",
+	"type": "text",
+	"fuzzy": { "articles": true, "typos": 0.2 },
+	"deck": [
+		{ "question": "未来", "answers": [ "みらい" ] },
+		{ "question": "On-yomi for 回", "answers": [ "え", "かい" ], "comment": "line one\nline \"two\"", "tags": [ "n4", "noun" ], "timeout": 30 }
+	]
+}
+`
+
+	var quiz Quiz
+	if err := json.Unmarshal([]byte(formatted), &quiz); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := formatQuiz(quiz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(formatted, string(result)); diff != "" {
+		t.Errorf("Formatting doesn't round trip (-want +got):\n%s", diff)
+	}
+
+	if result, _ := formatQuiz(Quiz{Description: "Empty"}); string(result) != "{\n\t\"description\": \"Empty\",\n\t\"deck\": []\n}\n" {
+		t.Errorf("Unexpected empty deck: %q", result)
+	}
+}
+
+func TestFormatQuizzes(t *testing.T) {
+	loadQuizList()
+
+	// Every deck comes out the same after being formatted once
+	for _, name := range GetQuizlist() {
+		quiz := LoadQuiz(name, false)
+		first, err := formatQuiz(quiz)
+		if err != nil {
+			t.Fatalf("Formatting %s: %s", name, err)
+		}
+
+		var reread Quiz
+		if err := json.Unmarshal(first, &reread); err != nil {
+			t.Fatalf("Formatted %s doesn't parse: %s", name, err)
+		}
+		if second, _ := formatQuiz(reread); string(first) != string(second) {
+			t.Errorf("Formatting %s doesn't round trip", name)
+		}
+		if !cmp.Equal(quiz, reread) {
+			t.Errorf("Formatting %s changes the deck", name)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Rules for loosely matching English answers, opted into per deck with
+// e.g. "fuzzy": {"articles": true, "plurals": true, "punctuation": true, "typos": 0.2, "alternates": true}
+type FuzzyRules struct {
+	Articles    bool    `json:"articles,omitempty"`    // Ignore a, an and the
+	Plurals     bool    `json:"plurals,omitempty"`     // Ignore plural endings
+	Punctuation bool    `json:"punctuation,omitempty"` // Ignore punctuation
+	Typos       float64 `json:"typos,omitempty"`       // Edits allowed per character of the answer
+	Alternates  bool    `json:"alternates,omitempty"`  // Parts in parentheses are optional
+}
+
+// Parenthesized parts of an answer, like "(to) run"
+var parenthesesRegexp = regexp.MustCompile(`\s*\([^)]*\)\s*`)
+
+// Judge accepting answers that are close enough to one of the card's answers,
+// after the usual reading comparison
+type fuzzyJudge struct {
+	readingJudge
+	rules FuzzyRules
+}
+
+func (fj fuzzyJudge) Judge(card Card, answer string) (string, bool) {
+	if key, ok := fj.readingJudge.Judge(card, answer); ok {
+		return key, true
+	}
+
+	given := fj.rules.normalize(answer)
+	if len(given) == 0 {
+		return "", false
+	}
+
+	for _, ans := range card.Answers {
+		for _, variant := range fj.rules.variants(ans) {
+			expected := fj.rules.normalize(variant)
+			if len(expected) == 0 {
+				continue
+			}
+
+			allowed := int(float64(len([]rune(expected))) * fj.rules.Typos)
+			if expected == given || allowed > 0 && levenshtein(expected, given) <= allowed {
+				return fj.Key(ans), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Ways an answer can be written, with and without its parenthesized parts
+func (rules FuzzyRules) variants(answer string) []string {
+	if !rules.Alternates || !strings.Contains(answer, "(") {
+		return []string{answer}
+	}
+
+	without := strings.TrimSpace(parenthesesRegexp.ReplaceAllString(answer, " "))
+	with := strings.NewReplacer("(", "", ")", "").Replace(answer)
+
+	return []string{answer, without, with}
+}
+
+// Bring an answer into a comparable form following the rules
+func (rules FuzzyRules) normalize(s string) string {
+	s = normalizeKana(s, false)
+
+	if rules.Punctuation {
+		s = strings.Map(func(r rune) rune {
+			switch {
+			case r == '\'' || r == '’':
+				return -1
+			case unicode.IsPunct(r) || unicode.IsSymbol(r):
+				return ' '
+			}
+			return r
+		}, s)
+	}
+
+	var words []string
+	for _, word := range strings.Fields(s) {
+		if rules.Articles && (word == "a" || word == "an" || word == "the") {
+			continue
+		}
+		if rules.Plurals {
+			word = singular(word)
+		}
+		words = append(words, word)
+	}
+
+	return strings.Join(words, " ")
+}
+
+// Crude singular form of an English word, only meant to be compared with
+// other words reduced the same way
+func singular(word string) string {
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case len(word) > 4 && (strings.HasSuffix(word, "ches") || strings.HasSuffix(word, "shes")):
+		return word[:len(word)-2]
+	case len(word) > 3 && (strings.HasSuffix(word, "ses") || strings.HasSuffix(word, "xes") || strings.HasSuffix(word, "zes")):
+		return word[:len(word)-2]
+	case len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss"):
+		return word[:len(word)-1]
+	}
+
+	return word
+}
+
+// Number of single character edits needed to turn a into b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minint(minint(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// Judge for a deck, with romaji readings accepted if asked for
+func newJudge(quiz Quiz, romaji bool) AnswerJudge {
+	judge := readingJudge{romaji: romaji, longVowels: quiz.LongVowels, smallKana: quiz.SmallKana}
+	if quiz.Fuzzy != nil {
+		return fuzzyJudge{readingJudge: judge, rules: *quiz.Fuzzy}
+	}
+
+	return judge
+}
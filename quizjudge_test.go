@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFuzzyJudge(t *testing.T) {
+	judge := fuzzyJudge{rules: FuzzyRules{
+		Articles:    true,
+		Plurals:     true,
+		Punctuation: true,
+		Typos:       0.2,
+		Alternates:  true,
+	}}
+
+	tests := []struct {
+		answers []string
+		given   string
+		key     string
+		ok      bool
+	}{
+		{[]string{"snake"}, "snake", "snake", true},
+		{[]string{"snake"}, "Snakes", "snake", true},
+		{[]string{"snake"}, "a snake", "snake", true},
+		{[]string{"the sun"}, "sun", "the sun", true},
+		{[]string{"city"}, "cities", "city", true},
+		{[]string{"box"}, "boxes", "box", true},
+		{[]string{"don't"}, "dont", "don't", true},
+		{[]string{"well-known"}, "well known", "well-known", true},
+		{[]string{"(to) run"}, "run", "(to) run", true},
+		{[]string{"(to) run"}, "to run", "(to) run", true},
+		{[]string{"elephant"}, "elephent", "elephant", true},
+		{[]string{"elephant"}, "elphnt", "", false},
+		{[]string{"cat"}, "cot", "", false},
+		{[]string{"cat"}, "", "", false},
+		{[]string{"dog", "hound"}, "hounds", "hound", true},
+	}
+
+	for _, test := range tests {
+		key, ok := judge.Judge(Card{Answers: test.answers}, test.given)
+		if key != test.key || ok != test.ok {
+			t.Errorf("Judge(%q, %q) = %q, %v, expected %q, %v", test.answers, test.given, key, ok, test.key, test.ok)
+		}
+	}
+
+	// Nothing loose about it without rules
+	if _, ok := (fuzzyJudge{}).Judge(Card{Answers: []string{"snake"}}, "snakes"); ok {
+		t.Errorf("Judge without rules accepted a plural")
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"flaw", "lawn", 2},
+		{"ねこ", "ねご", 1},
+	}
+
+	for _, test := range tests {
+		if distance := levenshtein(test.a, test.b); distance != test.distance {
+			t.Errorf("levenshtein(%q, %q) = %d, expected %d", test.a, test.b, distance, test.distance)
+		}
+	}
+}
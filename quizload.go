@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
 	"log"
 	"os"
 	"sync"
@@ -10,6 +11,17 @@ import (
 
 const QUIZ_FOLDER = "./quizzes/"
 
+// Newest deck format understood, decks without a version are the original format
+const QUIZ_VERSION = 2
+
+// Ways a question can be shown, for whole decks in "type" and for single cards in "media"
+const (
+	MEDIA_IMAGE = "image" // Question drawn on an image, the default
+	MEDIA_TEXT  = "text"  // Question as plain text
+	MEDIA_URL   = "url"   // Link for Discord to embed
+	MEDIA_FILE  = "file"  // Local image file, relative to the quizzes folder
+)
+
 // Quiz List filename container
 var Quizzes struct {
 	sync.RWMutex
@@ -18,10 +30,16 @@ var Quizzes struct {
 
 // Quiz struct to hold entire quiz data
 type Quiz struct {
-	Description string `json:"description"`
-	Type        string `json:"type,omitempty"`
-	Timeout     int    `json:"timeout,omitempty"`
-	Deck        []Card `json:"deck"`
+	Version     int            `json:"version,omitempty"` // Deck format, see QUIZ_VERSION
+	Description string         `json:"description"`
+	Type        string         `json:"type,omitempty"`
+	Timeout     int            `json:"timeout,omitempty"`
+	Romaji      bool           `json:"romaji,omitempty"`      // Accept readings typed in romaji
+	LongVowels  bool           `json:"long_vowels,omitempty"` // Treat ー the same as the vowel it lengthens
+	SmallKana   bool           `json:"small_kana,omitempty"`  // Treat small kana like ゃ the same as full size ones
+	Fuzzy       *FuzzyRules    `json:"fuzzy,omitempty"`       // Accept English answers that are close enough
+	Render      *RenderOptions `json:"render,omitempty"`      // How to draw questions on images
+	Deck        []Card         `json:"deck"`
 }
 
 // Card struct to hold question-answer set
@@ -29,6 +47,32 @@ type Card struct {
 	Question string   `json:"question"`
 	Answers  []string `json:"answers"`
 	Comment  string   `json:"comment,omitempty"`
+	Media    string   `json:"media,omitempty"`   // How to show the question, the deck's type if empty
+	Hint     string   `json:"hint,omitempty"`    // Help for players who are stuck
+	Tags     []string `json:"tags,omitempty"`    // Like JLPT level or part of speech
+	Timeout  int      `json:"timeout,omitempty"` // Seconds to answer, the deck's timeout if 0
+	Primary  string   `json:"primary,omitempty"` // Answer to show in history, the first one if empty
+}
+
+// How a card's question is shown, one of the MEDIA_* types
+func (q Quiz) media(card Card) string {
+	switch {
+	case len(card.Media) > 0:
+		return card.Media
+	case len(q.Type) > 0:
+		return q.Type
+	}
+
+	return MEDIA_IMAGE
+}
+
+// Answer that stands for the card in quiz history
+func (c Card) primaryAnswer() string {
+	if len(c.Primary) > 0 || len(c.Answers) == 0 {
+		return c.Primary
+	}
+
+	return c.Answers[0]
 }
 
 // English Dictionary slice
@@ -44,23 +88,29 @@ func loadQuizList() error {
 	}
 	defer file.Close()
 
-	Quizzes.Lock()
-	// Clear old map first
-	Quizzes.Map = make(map[string]string)
-	err = json.NewDecoder(file).Decode(&Quizzes.Map)
-	Quizzes.Unlock()
+	// Keep serving the old list if the new one is broken
+	quizMap := make(map[string]string)
+	err = json.NewDecoder(file).Decode(&quizMap)
 	if err != nil {
 		log.Println("ERROR, Unmarshalling Quiz List json:", err)
 		return err
 	}
 
-	// Disregard quizzes that don't have any existing files (sorry)
-	for quiz, filename := range Quizzes.Map {
+	// Disregard quizzes that don't have any existing files (sorry), except
+	// ones combining other decks like "n5+n4"
+	for quiz, filename := range quizMap {
+		if isDeckExpr(filename) {
+			continue
+		}
 		if _, err := os.Stat(QUIZ_FOLDER + filename); os.IsNotExist(err) {
-			delete(Quizzes.Map, quiz)
+			delete(quizMap, quiz)
 		}
 	}
 
+	Quizzes.Lock()
+	Quizzes.Map = quizMap
+	Quizzes.Unlock()
+
 	return nil
 }
 
@@ -108,31 +158,72 @@ func GetQuizlist() []string {
 	return quizlist
 }
 
-// Returns a slice of shuffled Questions from a given quiz
-func LoadQuiz(name string, doShuffle bool) (quiz Quiz) {
+// Returns the names of all loaded quizzes that aren't disabled in given guild
+func guildQuizlist(guildID string) []string {
+	disabled := getGuildConfig(guildID).Disabled
+
+	var quizlist []string
+	for _, name := range GetQuizlist() {
+		if !hasString(disabled, name) {
+			quizlist = append(quizlist, name)
+		}
+	}
+
+	return quizlist
+}
+
+// Returns a slice of shuffled Questions from a given quiz, or from the decks
+// combined in an expression like n5+n4 or jouyou[grade<=3]
+func LoadQuiz(name string, doShuffle bool) Quiz {
 
 	Quizzes.RLock()
 	filename, ok := Quizzes.Map[name]
 	Quizzes.RUnlock()
 
-	if ok {
-		file, err := os.Open(QUIZ_FOLDER + filename)
-		if err != nil {
-			log.Printf("ERROR, Reading json '%s': %s\n", name, err)
-			return
-		}
-		defer file.Close()
+	// Quiz list entries can be expressions too
+	expr := name
+	if ok && isDeckExpr(filename) {
+		expr = filename
+	} else if !ok && !isDeckExpr(name) {
+		return Quiz{}
+	}
 
-		err = json.NewDecoder(file).Decode(&quiz)
-		if err != nil {
-			log.Printf("ERROR, Unmarshalling json '%s': %s\n", name, err)
-			return Quiz{}
-		}
+	var quiz Quiz
+	var err error
+	if isDeckExpr(expr) {
+		quiz, err = loadDeckExpr(expr, doShuffle)
+	} else {
+		quiz, err = loadQuizFile(name, doShuffle)
+	}
+	if err != nil {
+		log.Printf("ERROR, Loading quiz '%s': %s\n", name, err)
+		return Quiz{}
+	}
+
+	return quiz
+}
+
+// Load a single deck from the quiz list, parsed once and cached
+func loadQuizFile(name string, doShuffle bool) (quiz Quiz, err error) {
+
+	Quizzes.RLock()
+	filename, ok := Quizzes.Map[name]
+	Quizzes.RUnlock()
+
+	if !ok || isDeckExpr(filename) {
+		return Quiz{}, fmt.Errorf("Unknown deck '%s'", name)
+	}
+
+	quiz, err = cachedQuizFile(filename)
+	if err != nil {
+		return Quiz{}, err
 	}
 
+	// The cached deck is shared, so games get their own copy to shuffle
+	quiz.Deck = append([]Card(nil), quiz.Deck...)
 	if doShuffle {
 		shuffle(quiz.Deck)
 	}
 
-	return
+	return quiz, nil
 }
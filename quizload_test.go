@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLoadQuizzes(t *testing.T) {
+	loadQuizList()
+
+	// Every deck in the original format keeps loading
+	for _, name := range GetQuizlist() {
+		if name == TestQuiz {
+			continue
+		}
+		if quiz := LoadQuiz(name, false); len(quiz.Deck) == 0 {
+			t.Errorf("Deck '%s' didn't load", name)
+		}
+	}
+}
+
+func TestQuizVersion2(t *testing.T) {
+	raw := `{
+	"version": 2,
+	"description": "Test deck",
+	"type": "text",
+	"deck": [
+		{ "question": "q1", "answers": [ "a", "b" ] },
+		{ "question": "q2.png", "answers": [ "c", "d" ], "media": "file", "hint": "c...", "tags": [ "n5", "noun" ], "timeout": 30, "primary": "d" }
+	]
+}`
+
+	var quiz Quiz
+	if err := json.Unmarshal([]byte(raw), &quiz); err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := quiz.Deck[0], quiz.Deck[1]
+	if quiz.media(first) != MEDIA_TEXT || first.primaryAnswer() != "a" {
+		t.Errorf("Unexpected defaults: %s %s", quiz.media(first), first.primaryAnswer())
+	}
+	if quiz.media(second) != MEDIA_FILE || second.primaryAnswer() != "d" {
+		t.Errorf("Unexpected overrides: %s %s", quiz.media(second), second.primaryAnswer())
+	}
+	if second.Hint != "c..." || len(second.Tags) != 2 || second.Timeout != 30 {
+		t.Errorf("Unexpected card: %+v", second)
+	}
+
+	if (Quiz{}).media(Card{}) != MEDIA_IMAGE {
+		t.Error("Decks without a type should be rendered images")
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Time to wait after the last change to a file before reading it, so that
+// editors are done writing it
+const QUIZ_RELOAD_DELAY = 500 * time.Millisecond
+
+// Decks parsed so far by file name, each kept until a good edit replaces it
+var QuizCache struct {
+	sync.RWMutex
+	Map    map[string]*cachedQuiz
+	Report func(msg string) // Tells the owner about decks that failed to parse
+}
+
+// Parsed deck along with the state of its file
+type cachedQuiz struct {
+	Quiz    Quiz      // Last version that parsed fine, empty if none did
+	ModTime time.Time // File modification time when last parsed, good or not
+	Err     error     // Why the last parse failed, nil if it didn't
+}
+
+// Deck from the given file in the quizzes folder, parsed again only if the
+// file changed since last time
+func cachedQuizFile(filename string) (Quiz, error) {
+	info, statErr := os.Stat(QUIZ_FOLDER + filename)
+
+	QuizCache.RLock()
+	cached, ok := QuizCache.Map[filename]
+	QuizCache.RUnlock()
+
+	if ok && (statErr != nil || cached.ModTime.Equal(info.ModTime())) {
+		if len(cached.Quiz.Deck) == 0 {
+			return Quiz{}, cached.Err
+		}
+		return cached.Quiz, nil
+	}
+	if statErr != nil {
+		return Quiz{}, statErr
+	}
+
+	return refreshQuizFile(filename)
+}
+
+// Parse a deck file again, keeping the last good version if it's broken and
+// telling the owner why
+func refreshQuizFile(filename string) (Quiz, error) {
+	info, err := os.Stat(QUIZ_FOLDER + filename)
+	if err != nil {
+		return Quiz{}, err
+	}
+	quiz, err := parseQuizFile(QUIZ_FOLDER + filename)
+
+	QuizCache.Lock()
+	cached, ok := QuizCache.Map[filename]
+	if !ok {
+		cached = &cachedQuiz{}
+		QuizCache.Map[filename] = cached
+	}
+	reported := cached.Err != nil && cached.ModTime.Equal(info.ModTime())
+	cached.ModTime = info.ModTime()
+	cached.Err = err
+	if err == nil {
+		cached.Quiz = quiz
+	}
+	good := cached.Quiz
+	QuizCache.Unlock()
+
+	if err == nil {
+		if ok {
+			log.Printf("NOTICE, Reloaded quiz file '%s'\n", filename)
+		}
+		return quiz, nil
+	}
+
+	log.Printf("ERROR, Parsing quiz file '%s': %s\n", filename, err)
+	if !reported && len(good.Deck) > 0 {
+		reportQuizError(fmt.Sprintf("Quiz file `%s` is broken, still using the last good version: %s", filename, err))
+	} else if !reported {
+		reportQuizError(fmt.Sprintf("Quiz file `%s` is broken: %s", filename, err))
+	}
+
+	if len(good.Deck) > 0 {
+		return good, nil
+	}
+
+	return Quiz{}, err
+}
+
+// Read and check a deck file
+func parseQuizFile(path string) (quiz Quiz, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Quiz{}, fmt.Errorf("Reading json: %w", err)
+	}
+	defer file.Close()
+
+	err = json.NewDecoder(file).Decode(&quiz)
+	if err != nil {
+		return Quiz{}, fmt.Errorf("Unmarshalling json: %w", err)
+	}
+
+	if quiz.Version > QUIZ_VERSION {
+		return Quiz{}, fmt.Errorf("Version %d, only up to %d is supported", quiz.Version, QUIZ_VERSION)
+	}
+	if len(quiz.Deck) == 0 {
+		return Quiz{}, fmt.Errorf("Deck has no cards")
+	}
+
+	for i, card := range quiz.Deck {
+		if len(card.Question) == 0 {
+			return Quiz{}, fmt.Errorf("Card %d has no question", i+1)
+		}
+		if len(card.Answers) == 0 {
+			return Quiz{}, fmt.Errorf("Card %d (%s) has no answers", i+1, card.Question)
+		}
+		if quiz.media(card) == MEDIA_FILE && !filepath.IsLocal(card.Question) {
+			return Quiz{}, fmt.Errorf("Card %d (%s) is a file outside the quizzes folder", i+1, card.Question)
+		}
+	}
+
+	return quiz, nil
+}
+
+// Watch the quizzes folder and the quiz list for changes, reloading whatever
+// changed once it's been written
+func watchQuizzes() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	// Folders rather than files, since editors often replace files on save
+	for _, dir := range []string{QUIZ_FOLDER, RESOURCES_FOLDER} {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		pending := make(map[string]*time.Timer)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+					continue
+				}
+
+				path := event.Name
+				if timer, ok := pending[path]; ok {
+					timer.Reset(QUIZ_RELOAD_DELAY)
+				} else {
+					pending[path] = time.AfterFunc(QUIZ_RELOAD_DELAY, func() { reloadChanged(path) })
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Println("ERROR, Watching quiz files:", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Reload a changed file if it's the quiz list or a deck on it
+func reloadChanged(path string) {
+	dir, filename := filepath.Clean(filepath.Dir(path)), filepath.Base(path)
+
+	switch dir {
+	case filepath.Clean(RESOURCES_FOLDER):
+		if filename != "quizlist.json" {
+			return
+		}
+		if err := loadQuizList(); err != nil {
+			reportQuizError(fmt.Sprintf("Quiz list is broken, still using the last good version: %s", err))
+			return
+		}
+		log.Println("NOTICE, Reloaded quiz list")
+	case filepath.Clean(QUIZ_FOLDER):
+		if !isListedFile(filename) {
+			return
+		}
+		refreshQuizFile(filename)
+	}
+}
+
+// Check if a file in the quizzes folder is on the quiz list
+func isListedFile(filename string) bool {
+	Quizzes.RLock()
+	defer Quizzes.RUnlock()
+
+	for _, listed := range Quizzes.Map {
+		if listed == filename {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Tell the owner about a broken file, if there's anybody to tell
+func reportQuizError(msg string) {
+	QuizCache.RLock()
+	report := QuizCache.Report
+	QuizCache.RUnlock()
+
+	if report != nil {
+		report(msg)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestQuizCache(t *testing.T) {
+	const filename = "_quizregistry_test.json"
+	path := QUIZ_FOLDER + filename
+	defer os.Remove(path)
+
+	var reports []string
+	QuizCache.Lock()
+	QuizCache.Report = func(msg string) { reports = append(reports, msg) }
+	QuizCache.Unlock()
+	defer func() {
+		QuizCache.Lock()
+		QuizCache.Report = nil
+		delete(QuizCache.Map, filename)
+		QuizCache.Unlock()
+	}()
+
+	// Every write gets its own modification time, like edits would
+	modified := time.Now().Add(-time.Hour)
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modified = modified.Add(time.Minute)
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{ "description": "v1", "deck": [ { "question": "q", "answers": [ "a" ] } ] }`)
+	if quiz, err := cachedQuizFile(filename); err != nil || quiz.Description != "v1" {
+		t.Fatalf("Unexpected first load: %v %v", quiz.Description, err)
+	}
+
+	// Broken edits keep the last good version and are reported once
+	write(`{ "description": "v2", "deck": [ { "question": "q" `)
+	for i := 0; i < 2; i++ {
+		if quiz, err := cachedQuizFile(filename); err != nil || quiz.Description != "v1" {
+			t.Errorf("Unexpected load of broken file: %v %v", quiz.Description, err)
+		}
+	}
+	if len(reports) != 1 {
+		t.Errorf("Expected one report, got %v", reports)
+	}
+
+	write(`{ "description": "v3", "deck": [ { "question": "q", "answers": [] } ] }`)
+	if quiz, _ := refreshQuizFile(filename); quiz.Description != "v1" || len(reports) != 2 {
+		t.Errorf("Cards without answers should be rejected: %v %v", quiz.Description, reports)
+	}
+
+	write(`{ "description": "v3", "deck": [ { "question": "../resources/secret.png", "answers": [ "a" ], "media": "file" } ] }`)
+	if quiz, _ := refreshQuizFile(filename); quiz.Description != "v1" || len(reports) != 3 {
+		t.Errorf("Files outside the quizzes folder should be rejected: %v %v", quiz.Description, reports)
+	}
+
+	write(`{ "description": "v4", "deck": [ { "question": "q", "answers": [ "a" ] } ] }`)
+	if quiz, err := cachedQuizFile(filename); err != nil || quiz.Description != "v4" {
+		t.Errorf("Unexpected load of fixed file: %v %v", quiz.Description, err)
+	}
+}
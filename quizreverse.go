@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Most cards sharing a prompt that get merged into one reversed card, any
+// more and the prompt is too vague to be worth asking
+const REVERSE_MERGE_LIMIT = 3
+
+// Old and alternative forms of kanji, accepted in place of the usual ones
+var kanjiVariants = map[rune]rune{
+	'國': '国', '學': '学', '體': '体', '髙': '高', '﨑': '崎', '邊': '辺',
+	'邉': '辺', '澤': '沢', '濱': '浜', '櫻': '桜', '廣': '広', '眞': '真',
+	'齋': '斎', '齊': '斉', '藝': '芸', '會': '会', '圓': '円', '氣': '気',
+	'實': '実', '變': '変', '發': '発', '戰': '戦', '鐵': '鉄', '聲': '声',
+	'齒': '歯', '龍': '竜', '來': '来', '兒': '児', '亞': '亜', '惡': '悪',
+	'驛': '駅', '圖': '図', '當': '当', '萬': '万', '與': '与',
+	'舊': '旧', '寫': '写', '賣': '売', '讀': '読', '樂': '楽', '醫': '医',
+	'燒': '焼', '螢': '蛍', '戀': '恋', '關': '関', '黑': '黒', '繪': '絵',
+}
+
+// Replace kanji variants with their usual forms
+func foldVariants(s string) string {
+	return strings.Map(func(r rune) rune {
+		if v, ok := kanjiVariants[r]; ok {
+			return v
+		}
+		return r
+	}, s)
+}
+
+// Turn a deck around, asking for the questions by their English meaning or,
+// without one, their reading
+// Cards sharing a prompt are merged into one accepting all of their questions,
+// or skipped if too many of them do
+func reverseQuiz(quiz Quiz) Quiz {
+	reversed := quiz
+	reversed.Type = MEDIA_TEXT
+	reversed.Romaji = false
+	reversed.LongVowels = false
+	reversed.SmallKana = false
+	reversed.Fuzzy = nil
+	reversed.Deck = nil
+
+	// Questions that aren't text can't be typed as answers
+	var deck []Card
+	for _, card := range quiz.Deck {
+		if media := quiz.media(card); media != MEDIA_URL && media != MEDIA_FILE && len(card.Question) > 0 {
+			deck = append(deck, card)
+		}
+	}
+
+	// Meanings shared by too many cards fall back to readings
+	prompts := make([]string, len(deck))
+	glosses := make(map[string]int)
+	for i, card := range deck {
+		prompts[i] = reverseGloss(card)
+		glosses[normalizeKana(prompts[i], false)]++
+	}
+	for i, card := range deck {
+		if len(prompts[i]) == 0 || glosses[normalizeKana(prompts[i], false)] > REVERSE_MERGE_LIMIT {
+			prompts[i] = reverseReading(card)
+		}
+	}
+
+	// Group cards by prompt, in the order they first appear
+	var keys []string
+	groups := make(map[string][]Card)
+	shown := make(map[string]string)
+	for i, card := range deck {
+		if len(prompts[i]) == 0 {
+			continue
+		}
+		key := normalizeKana(prompts[i], false)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+			shown[key] = prompts[i]
+		}
+		groups[key] = append(groups[key], card)
+	}
+
+	for _, key := range keys {
+		if len(groups[key]) > REVERSE_MERGE_LIMIT {
+			continue
+		}
+		reversed.Deck = append(reversed.Deck, mergeReversed(shown[key], groups[key]))
+	}
+
+	return reversed
+}
+
+// Reversed card asking for all questions of the given cards
+func mergeReversed(prompt string, cards []Card) Card {
+	card := Card{
+		Question: prompt,
+		Media:    MEDIA_TEXT,
+		Primary:  cards[0].Question,
+	}
+
+	var notes []string
+	for _, c := range cards {
+		if !hasString(card.Answers, c.Question) {
+			card.Answers = append(card.Answers, c.Question)
+		}
+		for _, tag := range c.Tags {
+			if !hasString(card.Tags, tag) {
+				card.Tags = append(card.Tags, tag)
+			}
+		}
+
+		note := c.Question + ": " + strings.Join(c.Answers, ", ")
+		if len(c.Comment) > 0 && c.Comment != prompt {
+			note += "\n" + c.Comment
+		}
+		notes = append(notes, note)
+	}
+	card.Comment = strings.Join(notes, "\n")
+
+	return card
+}
+
+// First line of the card's comment if it's an English meaning, empty if not
+func reverseGloss(card Card) string {
+	gloss := strings.TrimSpace(strings.SplitN(card.Comment, "\n", 2)[0])
+	if len(gloss) == 0 || strings.Contains(gloss, card.Question) {
+		return ""
+	}
+
+	for _, r := range gloss {
+		if r < unicode.MaxASCII && unicode.IsLetter(r) {
+			return gloss
+		}
+	}
+
+	return ""
+}
+
+// First answer of the card written only in kana, empty if there's none
+func reverseReading(card Card) string {
+	for _, ans := range card.Answers {
+		if isKana(ans) && !strings.Contains(card.Question, ans) {
+			return ans
+		}
+	}
+
+	return ""
+}
+
+// Check if text is made up of only kana
+func isKana(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+
+	for _, r := range s {
+		if !unicode.In(r, unicode.Hiragana, unicode.Katakana) && r != 'ー' {
+			return false
+		}
+	}
+
+	return true
+}
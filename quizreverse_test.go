@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReverseQuiz(t *testing.T) {
+	quiz := Quiz{
+		Description: "Test deck",
+		Deck: []Card{
+			{Question: "犬", Answers: []string{"いぬ"}, Comment: "dog"},
+			{Question: "猫", Answers: []string{"ねこ"}, Comment: "cat\nfeline"},
+			{Question: "学校", Answers: []string{"がっこう"}, Comment: "School"},
+			{Question: "学園", Answers: []string{"がくえん"}, Comment: "school"},
+			{Question: "国", Answers: []string{"くに", "コク"}},
+			{Question: "壱", Answers: []string{"イチ"}},
+			{Question: "一", Answers: []string{"イチ", "ひと"}},
+			{Question: "市", Answers: []string{"いち", "シ"}},
+			{Question: "位置", Answers: []string{"いち"}},
+			{Question: "https://example.com/a.png", Answers: []string{"え"}, Media: MEDIA_URL},
+			{Question: "かな", Answers: []string{"かな"}},
+		},
+	}
+
+	reversed := reverseQuiz(quiz)
+
+	var prompts []string
+	answers := make(map[string][]string)
+	for _, card := range reversed.Deck {
+		prompts = append(prompts, card.Question)
+		answers[card.Question] = card.Answers
+	}
+
+	// Shared meanings are merged, readings shared by too many cards skipped
+	expected := []string{"dog", "cat", "School", "くに"}
+	if diff := cmp.Diff(expected, prompts); diff != "" {
+		t.Errorf("Unexpected prompts (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"学校", "学園"}, answers["School"]); diff != "" {
+		t.Errorf("Unexpected merged answers (-want +got):\n%s", diff)
+	}
+	if reversed.Deck[0].Primary != "犬" || reversed.media(reversed.Deck[0]) != MEDIA_TEXT {
+		t.Errorf("Unexpected card: %+v", reversed.Deck[0])
+	}
+
+	judge := readingJudge{variants: true}
+	for _, answer := range []string{"国", "國"} {
+		if _, ok := judge.Judge(reversed.Deck[3], answer); !ok {
+			t.Errorf("Answer %q should be accepted", answer)
+		}
+	}
+	if _, ok := judge.Judge(reversed.Deck[3], "くに"); ok {
+		t.Error("The reading shown shouldn't be accepted")
+	}
+}
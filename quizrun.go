@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -10,984 +11,497 @@ import (
 )
 
 // Run kanji quiz loop in given channel
-func runQuiz(s *discordgo.Session, quizChannel string, quizname string, winLimitGiven string, waitTimeGiven int, pauseTimeGiven int) {
+func runQuiz(t Transport, quizChannel string, starter string, quizname string, winLimitGiven string, waitTimeGiven int, pauseTimeGiven int, opts GameOptions) {
 
-	// Mark the quiz as started
-	if err := startQuiz(s, quizChannel); err != nil {
-		// Quiz already running, nothing to do here
+	g := loadGame(t, quizChannel, quizname, true, opts)
+	if g == nil {
 		return
 	}
+	g.Starter = starter
 
-	winLimit := 15                                                // winner score
-	timeout := 20                                                 // seconds to wait per round
-	timeoutLimit := 5                                             // count before aborting
-	pauseTime := time.Duration(pauseTimeGiven) * time.Millisecond // delay before next question
+	// Review decks are played until the end
+	if g.Reviewing {
+		g.WinLimit = g.Source.Len()
+	}
+	g.WinLimit = parseWinLimit(winLimitGiven, g.WinLimit, g.Source.Len())
 
-	// Set delay before closing round
-	waitTime := time.Duration(waitTimeGiven) * time.Millisecond
+	g.Wait = time.Duration(waitTimeGiven) * time.Millisecond   // delay before closing round
+	g.Pause = time.Duration(pauseTimeGiven) * time.Millisecond // delay before next question
 
-	var quiz Quiz
-	if quizname == "review" {
-		quiz = getReview(quizChannel)
-		winLimit = len(quiz.Deck)
-	} else {
-		quiz = LoadQuiz(quizname, true)
-	}
-	if len(quiz.Deck) == 0 {
-		msgSend(s, quizChannel, "Failed to find valid quiz: "+quizname)
-		stopQuiz(s, quizChannel)
-		return
-	}
+	g.Run()
+}
 
-	// Parse provided winLimit with sane defaults
-	if i, err := strconv.Atoi(winLimitGiven); err == nil {
-		if i > len(quiz.Deck) {
-			i = len(quiz.Deck)
-		}
+// Run multi quiz loop in given channel
+func runMultiQuiz(t Transport, quizChannel string, starter string, quizname string, winLimitGiven string, waitTimeGiven int, pauseTimeGiven int, opts GameOptions) {
 
-		if i > 100 {
-			winLimit = 100
-		} else if i < 1 {
-			winLimit = 1
-		} else {
-			winLimit = i
-		}
+	g := loadGame(t, quizChannel, quizname, true, opts)
+	if g == nil {
+		return
 	}
+	g.Starter = starter
 
-	// Replace default timeout with custom if specified
-	if quiz.Timeout > 0 {
-		timeout = quiz.Timeout
+	// Review decks are played until the end
+	if g.Reviewing {
+		g.WinLimit = g.Source.Len()
 	}
+	g.WinLimit = parseWinLimit(winLimitGiven, g.WinLimit, g.Source.Len())
 
-	c := make(chan *discordgo.MessageCreate, 100)
-	quitChan := make(chan struct{}, 100)
-
-	killHandler := s.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
-		// Ignore all messages created by self and bots
-		if m.Author.ID == s.State.User.ID || m.Author.Bot {
-			return
-		}
-
-		// Only react on current quiz channel
-		if m.ChannelID != quizChannel {
-			return
-		}
-
-		// Handle quiz aborts
-		if strings.ToLower(strings.TrimSpace(m.Content)) == CMD_PREFIX+"stop" {
-			quitChan <- struct{}{}
-			return
-		}
-
-		// Relay the message to the quiz loop
-		c <- m
-	})
-
-	msgSend(s, quizChannel, fmt.Sprintf("```Starting new %s quiz (%d questions) in %.f seconds:\n\"%s\"\nFirst to %d points wins.```", quizname, len(quiz.Deck), float64(pauseTime/time.Second), quiz.Description, winLimit))
+	g.Timeout = 13 * time.Second                               // seconds to wait per round, before bonus time
+	g.Wait = time.Duration(waitTimeGiven) * time.Millisecond   // delay before closing round
+	g.Pause = time.Duration(pauseTimeGiven) * time.Millisecond // delay before next question
+	g.Scoring = multiScoring{limit: 3}                         // possible points per question
+	g.Render = multiRenderer{}
 
-	var quizHistory []string
-	var failed []Card
-	var questionTitle string
-	players := make(map[string]int)
-	var timeoutCount int
-
-outer:
-	for len(quiz.Deck) > 0 {
-		time.Sleep(pauseTime)
-
-		// Grab new word from the quiz
-		var current Card
-		current, quiz.Deck = quiz.Deck[len(quiz.Deck)-1], quiz.Deck[:len(quiz.Deck)-1]
-
-		// Replace readings with hiragana-only version
-		answers := make([]string, len(current.Answers))
-		for i, ans := range current.Answers {
-			answers[i] = k2h(ans)
-		}
-
-		// Add word to quiz history
-		if (quiz.Type == "text" || quiz.Type == "url") && len(current.Answers) > 0 {
-			quizHistory = append(quizHistory, current.Answers[0])
-			questionTitle = ""
-		} else {
-			quizHistory = append(quizHistory, current.Question)
-			questionTitle = truncate(current.Question, 100)
-		}
-
-		// Round's score keeper
-		scoreKeeper := make(map[string]int)
-
-		// Drain premature "answers" from channel buffer
-		for len(c) > 0 {
-			<-c
-		}
-
-		// Send out quiz question
-		if quiz.Type == "text" {
-			msgSend(s, quizChannel, fmt.Sprintf("```\n%s```", current.Question))
-		} else if quiz.Type == "url" {
-			msgSend(s, quizChannel, current.Question)
-		} else {
-			imgSend(s, quizChannel, current.Question)
-		}
-
-		// Set timeout for no correct answers
-		timeoutChan := time.NewTimer(time.Duration(timeout) * time.Second)
-
-	inner:
-		for {
-
-			select {
-			case <-quitChan:
-				// Quit order received, but store remaining questions for reviews
-				if quizname == "review" {
-					// Did this question get answered
-					if len(scoreKeeper) == 0 {
-						// Store question for later review deck
-						failed = append(failed, current)
-					}
-
-					// Store unused review questions
-					failed = append(failed, quiz.Deck...)
-				}
-				break outer
-			case <-timeoutChan.C:
-				if len(scoreKeeper) > 0 {
-					break inner
-				}
-
-				embed := &discordgo.MessageEmbed{
-					Type:        "rich",
-					Title:       fmt.Sprintf(UNICODE_NO_ENTRY+" Timed out! %s", questionTitle),
-					Description: fmt.Sprintf("**%s**", truncate(strings.Join(current.Answers, ", "), 2000)),
-					Color:       0xAA2222,
-				}
-
-				if len(current.Comment) > 0 {
-					embed.Fields = []*discordgo.MessageEmbedField{
-						&discordgo.MessageEmbedField{
-							Name:   "Comment",
-							Value:  truncate(current.Comment, 1024),
-							Inline: false,
-						}}
-				}
-
-				embedSend(s, quizChannel, embed)
-
-				// Store question for later review deck
-				failed = append(failed, current)
-
-				// Mark latest question as failed in quiz history as well
-				quizHistory[len(quizHistory)-1] = "*" + quizHistory[len(quizHistory)-1]
-
-				timeoutCount++
-				if timeoutCount >= timeoutLimit {
-					msgSend(s, quizChannel, "```Too many timeouts in a row reached, aborting quiz.```")
-
-					if quizname == "review" {
-						// Store unused review questions
-						failed = append(failed, quiz.Deck...)
-					}
-
-					break outer
-				}
-				break inner
-			case msg := <-c:
-				// Handle passing on question
-				if msg.Content == ".." || msg.Content == "。。" {
-
-					// Abort the question
-					timeoutChan.Reset(0)
-
-				} else if hasString(answers, k2h(msg.Content)) {
-					if len(scoreKeeper) == 0 {
-						timeoutChan.Reset(waitTime)
-					}
-
-					// Make sure we don't add the same user again
-					if _, exists := scoreKeeper[msg.Author.ID]; !exists {
-						scoreKeeper[msg.Author.ID] = len(scoreKeeper) + 1
-					}
-
-					// Reset timeouts since we're active
-					timeoutCount = 0
-				}
-			}
-		}
-
-		if len(scoreKeeper) > 0 {
-
-			winnerExists := false
-			var fastest string
-			var scorers []string
-			for player, position := range scoreKeeper {
-				players[player]++
-				if position == 1 {
-					fastest = fmt.Sprintf("<@%s> %dp", player, players[player])
-				} else {
-					scorers = append(scorers, fmt.Sprintf("<@%s> %dp", player, players[player]))
-				}
-				if players[player] >= winLimit {
-					winnerExists = true
-				}
-			}
-
-			scorers = append([]string{fastest}, scorers...)
-
-			embed := &discordgo.MessageEmbed{
-				Type:        "rich",
-				Title:       fmt.Sprintf(UNICODE_CHECK_MARK+" Correct: %s", questionTitle),
-				Description: fmt.Sprintf("**%s**", truncate(strings.Join(current.Answers, ", "), 2000)),
-				Color:       0x22AA22,
-				Fields: []*discordgo.MessageEmbedField{
-					&discordgo.MessageEmbedField{
-						Name:   fmt.Sprintf("Scorers - %s to %d", quizname, winLimit),
-						Value:  strings.Join(scorers, ", "),
-						Inline: false,
-					}},
-			}
+	g.Run()
+}
 
-			if len(current.Comment) > 0 {
-				embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
-					Name:   "Comment",
-					Value:  truncate(current.Comment, 1024),
-					Inline: false,
-				})
-			}
+// Run private gauntlet quiz
+func runGauntlet(t Transport, m *discordgo.MessageCreate, quizname, timeLimitGiven string, opts GameOptions) {
 
-			embedSend(s, quizChannel, embed)
+	// Only react in private messages
+	if len(m.GuildID) != 0 {
+		// Not a private channel
+		t.Send(m.ChannelID, fmt.Sprintf(UNICODE_NO_ENTRY_SIGN+" Game mode `%sgauntlet` is only for DM!", guildPrefix(m.GuildID)))
+		return
+	}
 
-			if winnerExists {
-				break outer
-			}
-		}
+	opts.Hints = false // every answer moves on, so there's no waiting for hints
 
+	g := loadGame(t, m.ChannelID, quizname, true, opts)
+	if g == nil {
+		return
 	}
+	g.Starter = m.Author.ID
 
-	// Clean up
-	killHandler()
-
-	// Produce scoreboard
-	fields := make([]*discordgo.MessageEmbedField, 0, 2)
-	var winners string
-	var participants string
+	timeout := 120 // seconds to run complete gauntlet
 
-	for _, p := range ranking(players) {
-		if p.Score >= winLimit && quizname != "review" {
-			winners += fmt.Sprintf("<@%s>: %d points\n", p.Name, p.Score)
-		} else {
-			participants += fmt.Sprintf("<@%s>: %d point(s)\n", p.Name, p.Score)
+	// Parse provided time limit with sane defaults
+	if i, err := strconv.Atoi(timeLimitGiven); err == nil {
+		if i > 20 {
+			timeout = 20 * 60
+		} else if i > 0 {
+			timeout = i * 60
 		}
 	}
 
-	if len(winners) > 0 {
-		fields = append(fields, &discordgo.MessageEmbedField{
-			Name:   "Winner",
-			Value:  winners,
-			Inline: false,
-		})
-	}
+	g.Timed = true
+	g.Timeout = time.Duration(timeout) * time.Second
+	g.Pause = 5 * time.Second
+	g.WinLimit = 0
+	g.Ranked = g.Ranked && timeLimitGiven == "" // custom rules aren't comparable
+	g.Render = gauntletRenderer{player: m.Author}
 
-	if len(participants) > 0 {
-		fields = append(fields, &discordgo.MessageEmbedField{
-			Name:   "Participants",
-			Value:  participants,
-			Inline: false,
-		})
-	}
+	g.Run()
+}
 
-	if len(failed) > 0 {
-		fields = append(fields, &discordgo.MessageEmbedField{
-			Name:   "Note",
-			Value:  fmt.Sprintf("Try `%squiz review` to replay the %d failed question(s)\n", CMD_PREFIX, len(failed)),
-			Inline: false,
-		})
+// Scramble quiz
+func runScramble(t Transport, quizChannel string, starter string, difficulty string) {
+
+	// Mark the quiz as started
+	if err := startQuiz(t, quizChannel); err != nil {
+		// Quiz already running, nothing to do here
+		return
 	}
 
-	// Sleep for a little breathing room
-	time.Sleep(1 * time.Second)
+	minLength := 3 // default word length minimum
+	maxLength := 7 // default word length maximum
 
-	embed := &discordgo.MessageEmbed{
-		Type:        "rich",
-		Title:       "Final Quiz Scoreboard: " + quizname,
-		Description: "-------------------------------",
-		Color:       0x33FF33,
-		Fields:      fields,
-		Footer:      &discordgo.MessageEmbedFooter{Text: truncate(strings.Join(quizHistory, "　"), 2000)},
+	// Parse provided difficulty with sane defaults
+	if level, okay := Settings.Difficulty[difficulty]; okay {
+		minLength, maxLength = level[0], level[1]
 	}
 
-	embedSend(s, quizChannel, embed)
-
-	// Store review questions in memory
-	quiz.Deck = failed
-	putReview(quizChannel, copyQuiz(quiz))
+	g := newGame(t, quizChannel, "Scramble", Quiz{Description: "Unscramble the English word"})
+	g.Starter = starter
+	g.Source = newScrambleSource(minLength, maxLength)
+	g.Render = scrambleRenderer{}
+	g.WinLimit = 10
+	g.Timeout = 30 * time.Second
+	g.Wait = time.Duration(Settings.Speed["quiz"][0]) * time.Millisecond
+	g.Pause = time.Duration(Settings.Speed["quiz"][1]) * time.Millisecond
+	g.Review = false
 
-	stopQuiz(s, quizChannel)
+	g.Run()
 }
 
-// Run multi quiz loop in given channel
-func runMultiQuiz(s *discordgo.Session, quizChannel string, quizname string, winLimitGiven string, waitTimeGiven int, pauseTimeGiven int) {
+// Run sequential kanji quiz loop in given channel
+func runQuizSequential(t Transport, quizChannel string, starter string, quizname string, startIndex string, waitTimeGiven int, pauseTimeGiven int, opts GameOptions) {
 
-	// Mark the quiz as started
-	if err := startQuiz(s, quizChannel); err != nil {
-		// Quiz already running, nothing to do here
+	// Parse provided start index, like 101 in 101-200, where a missing start
+	// means the beginning of the deck
+	start, _, found := strings.Cut(startIndex, "-")
+	idx, err := strconv.Atoi(start)
+	if len(start) == 0 {
+		idx, err = 0, nil
+	}
+	if !found || err != nil || idx < 0 {
+		t.Send(quizChannel, fmt.Sprintf("Invalid range '%s', expected something like 1-100", startIndex))
 		return
 	}
 
-	winLimit := 15                                                // winner score
-	timeout := 13                                                 // seconds to wait per round
-	timeoutLimit := 5                                             // count before aborting
-	pauseTime := time.Duration(pauseTimeGiven) * time.Millisecond // delay before next question
-	pointLimit := 3                                               // possible points per question
-
-	// Set delay before closing round
-	waitTime := time.Duration(waitTimeGiven) * time.Millisecond
-
-	quiz := LoadQuiz(quizname, true)
-	if len(quiz.Deck) == 0 {
-		msgSend(s, quizChannel, "Failed to find quiz: "+quizname)
-		stopQuiz(s, quizChannel)
+	g := loadGame(t, quizChannel, quizname, false, opts)
+	if g == nil {
 		return
 	}
+	g.Starter = starter
 
-	// Parse provided winLimit with sane defaults
-	if i, err := strconv.Atoi(winLimitGiven); err == nil {
-		if i > len(quiz.Deck) {
-			i = len(quiz.Deck)
-		}
-
-		if i > 100 {
-			winLimit = 100
-		} else if i < 1 {
-			winLimit = 1
-		} else {
-			winLimit = i
-		}
+	deck := g.Source.Rest()
+	if idx > len(deck) {
+		idx = len(deck)
 	}
 
-	c := make(chan *discordgo.MessageCreate, 100)
-	quitChan := make(chan struct{}, 100)
+	// Flash forward deck up to given index
+	g.Source = &deckSource{deck: deck[idx:], sequential: true}
 
-	killHandler := s.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
-		// Ignore all messages created by self and bots
-		if m.Author.ID == s.State.User.ID || m.Author.Bot {
-			return
-		}
+	// Maximum possible points
+	total := len(deck) - idx
+	if g.Hints {
+		total *= HINT_POINTS
+	}
 
-		// Only react on current quiz channel
-		if m.ChannelID != quizChannel {
-			return
-		}
+	g.WinLimit = 0
+	g.Wait = time.Duration(waitTimeGiven) * time.Millisecond   // delay before closing round
+	g.Pause = time.Duration(pauseTimeGiven) * time.Millisecond // delay before next question
+	g.Render = sequentialRenderer{
+		start: idx,
+		total: total,
+	}
 
-		// Handle quiz aborts
-		if strings.ToLower(strings.TrimSpace(m.Content)) == CMD_PREFIX+"stop" {
-			quitChan <- struct{}{}
-			return
-		}
+	g.Run()
+}
 
-		// Relay the message to the quiz loop
-		c <- m
-	})
+// Every player with a correct answer gets a point, and the round closes
+// after the first one
+type firstScoring struct{}
 
-	msgSend(s, quizChannel, fmt.Sprintf("```Starting new %s MULTI quiz (%d questions) in %.f seconds:\n\"%s\"\nFirst to %d points wins.```", quizname, len(quiz.Deck), float64(pauseTime/time.Second), quiz.Description, winLimit))
+func (firstScoring) Start(g *Game, r *Round) {}
 
-	var quizHistory []string
-	var questionTitle string
-	players := make(map[string]int)
-	var timeoutCount int
+func (firstScoring) Score(g *Game, r *Round, player, key, content string) (counted, closing bool) {
+	closing = !r.Scored()
 
-outer:
-	for len(quiz.Deck) > 0 {
-		time.Sleep(pauseTime)
+	// Make sure we don't add the same user again
+	if _, exists := r.Answers[player]; !exists {
+		r.Order = append(r.Order, player)
+	}
+	r.Answers[player] = append(r.Answers[player], content)
 
-		// Grab new word from the quiz
-		var current Card
-		current, quiz.Deck = quiz.Deck[len(quiz.Deck)-1], quiz.Deck[:len(quiz.Deck)-1]
-		answerMap := make(map[string]time.Time)
+	return true, closing
+}
 
-		// Populate answer map with lowercase/hiragana-reading version
-		for _, ans := range current.Answers {
-			// Initialize with zero time
-			answerMap[k2h(strings.ToLower(ans))] = time.Time{}
-		}
-		answersLeft := len(answerMap)
+func (firstScoring) Points(r *Round) map[string]int {
+	points := make(map[string]int, len(r.Order))
+	for _, player := range r.Order {
+		points[player] = 1
+	}
 
-		// Add word to quiz history
-		if (quiz.Type == "text" || quiz.Type == "url") && len(current.Answers) > 0 {
-			quizHistory = append(quizHistory, current.Answers[0])
-			questionTitle = ""
-		} else {
-			quizHistory = append(quizHistory, current.Question)
-			questionTitle = truncate(current.Question, 100)
-		}
+	return points
+}
 
-		// Round's score keeper
-		scoreKeeper := make(map[string]int)
-		scoreKeeperAnswers := make(map[string][]string)
+// Every answer given within the window after it was first given scores,
+// up to a limit per player
+type multiScoring struct {
+	limit int
+}
 
-		// Drain premature "answers" from channel buffer
-		for len(c) > 0 {
-			<-c
-		}
+func (multiScoring) Start(g *Game, r *Round) {
 
-		// Send out quiz question
-		if quiz.Type == "text" {
-			msgSend(s, quizChannel, fmt.Sprintf("```\n%s```", current.Question))
-		} else if quiz.Type == "url" {
-			msgSend(s, quizChannel, current.Question)
-		} else {
-			imgSend(s, quizChannel, current.Question)
+	// Initialize every answer with zero time
+	for _, ans := range r.Card.Answers {
+		if key, ok := g.Judge.Judge(r.Card, ans); ok {
+			r.Given[key] = time.Time{}
 		}
+	}
 
-		// Set timeout for no correct answers
-		bonusTime := minint(len(current.Answers)*2, 12)
-		timeoutChan := time.NewTimer(time.Duration(timeout+bonusTime) * time.Second)
-
-	inner:
-		for {
-
-			select {
-			case <-quitChan:
-				break outer
-			case <-timeoutChan.C:
-				if len(scoreKeeper) > 0 {
-					break inner
-				}
-
-				embed := &discordgo.MessageEmbed{
-					Type:        "rich",
-					Title:       fmt.Sprintf(UNICODE_NO_ENTRY+" Timed out! %s", questionTitle),
-					Description: fmt.Sprintf("**%s**", truncate(strings.Join(current.Answers, ", "), 2000)),
-					Color:       0xAA2222,
-				}
-
-				if len(current.Comment) > 0 {
-					embed.Fields = []*discordgo.MessageEmbedField{
-						&discordgo.MessageEmbedField{
-							Name:   "Comment",
-							Value:  truncate(current.Comment, 1024),
-							Inline: false,
-						}}
-				}
-
-				embedSend(s, quizChannel, embed)
-
-				// Mark latest question as failed in quiz history
-				quizHistory[len(quizHistory)-1] = "*" + quizHistory[len(quizHistory)-1]
-
-				timeoutCount++
-				if timeoutCount >= timeoutLimit {
-					msgSend(s, quizChannel, "```Too many timeouts in a row reached, aborting quiz.```")
-					break outer
-				}
-				break inner
-			case msg := <-c:
-				// Handle passing on question
-				if msg.Content == ".." || msg.Content == "。。" {
-
-					// Abort the question
-					timeoutChan.Reset(0)
-
-				} else if ts, okay := answerMap[k2h(strings.ToLower(msg.Content))]; okay {
-
-					// Only count answers that are given within the window
-					if ts.IsZero() {
-						answerMap[k2h(strings.ToLower(msg.Content))] = time.Now()
-						answersLeft--
-
-						// Finish early if all answers given
-						if answersLeft <= 0 {
-							timeoutChan.Reset(waitTime)
-						}
-					} else if time.Since(ts) > waitTime {
-						break
-					}
-
-					scoreKeeper[msg.Author.ID]++
-					scoreKeeperAnswers[msg.Author.ID] = append(scoreKeeperAnswers[msg.Author.ID], msg.Content)
-
-					// Reset timeouts since we're active
-					timeoutCount = 0
-				}
-			}
-		}
-
-		if len(scoreKeeper) > 0 {
-
-			winnerExists := false
-			for player, score := range scoreKeeper {
-				players[player] += minint(score, pointLimit)
-				if players[player] >= winLimit {
-					winnerExists = true
-				}
-			}
-
-			var participants string
-			for _, p := range ranking(scoreKeeper) {
-				participants += fmt.Sprintf(
-					"<@%s> +%d (%dp): %s\n",
-					p.Name,
-					minint(p.Score, pointLimit),
-					players[p.Name],
-					strings.Join(scoreKeeperAnswers[p.Name], ", "),
-				)
-			}
-
-			embed := &discordgo.MessageEmbed{
-				Type:        "rich",
-				Title:       fmt.Sprintf(UNICODE_CHECK_MARK+" Correct: %s", questionTitle),
-				Description: fmt.Sprintf("**%s**", truncate(strings.Join(current.Answers, ", "), 2000)),
-				Color:       0x22AA22,
-				Fields: []*discordgo.MessageEmbedField{
-					&discordgo.MessageEmbedField{
-						Name:   fmt.Sprintf("Scorers - %s to %d", quizname, winLimit),
-						Value:  participants,
-						Inline: false,
-					}},
-			}
+	// Give extra time for questions with many answers
+	bonusTime := minint(len(r.Card.Answers)*2, 12)
+	r.Timeout += time.Duration(bonusTime) * time.Second
+}
 
-			if len(current.Comment) > 0 {
-				embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
-					Name:   "Comment",
-					Value:  truncate(current.Comment, 1024),
-					Inline: false,
-				})
-			}
+func (multiScoring) Score(g *Game, r *Round, player, key, content string) (counted, closing bool) {
 
-			embedSend(s, quizChannel, embed)
+	// Only count answers that are given within the window
+	if ts := r.Given[key]; ts.IsZero() {
+		r.Given[key] = time.Now()
 
-			if winnerExists {
-				break outer
+		// Finish early if all answers given
+		closing = true
+		for _, ts := range r.Given {
+			if ts.IsZero() {
+				closing = false
+				break
 			}
 		}
-
+	} else if time.Since(ts) > g.Wait {
+		return false, false
 	}
 
-	// Clean up
-	killHandler()
-
-	// Produce scoreboard
-	fields := make([]*discordgo.MessageEmbedField, 0, 2)
-	var winners string
-	var participants string
-	rankingList := ranking(players)
-
-	for _, p := range rankingList {
-		if p.Score >= winLimit && len(rankingList) > 0 && p.Score == rankingList[0].Score {
-			winners += fmt.Sprintf("<@%s>: %d points\n", p.Name, p.Score)
-		} else {
-			participants += fmt.Sprintf("<@%s>: %d point(s)\n", p.Name, p.Score)
-		}
+	if _, exists := r.Answers[player]; !exists {
+		r.Order = append(r.Order, player)
 	}
+	r.Answers[player] = append(r.Answers[player], content)
 
-	if len(winners) > 0 {
-		fields = append(fields, &discordgo.MessageEmbedField{
-			Name:   "Winner",
-			Value:  winners,
-			Inline: false,
-		})
-	}
+	return true, closing
+}
 
-	if len(participants) > 0 {
-		fields = append(fields, &discordgo.MessageEmbedField{
-			Name:   "Participants",
-			Value:  participants,
-			Inline: false,
-		})
+func (m multiScoring) Points(r *Round) map[string]int {
+	points := make(map[string]int, len(r.Order))
+	for _, player := range r.Order {
+		points[player] = minint(len(r.Answers[player]), m.limit)
 	}
 
-	// Sleep for a little breathing room
-	time.Sleep(1 * time.Second)
+	return points
+}
 
-	embed := &discordgo.MessageEmbed{
-		Type:        "rich",
-		Title:       "Final Quiz Scoreboard: " + quizname,
-		Description: "-------------------------------",
-		Color:       0x33FF33,
-		Fields:      fields,
-		Footer:      &discordgo.MessageEmbedFooter{Text: truncate(strings.Join(quizHistory, "　"), 2000)},
-	}
+// Regular quiz presentation with an embed after every round
+type quizRenderer struct{}
 
-	embedSend(s, quizChannel, embed)
+func (quizRenderer) Start(g *Game) {
+	g.Transport.Send(g.Channel, fmt.Sprintf("```Starting new %s quiz (%d questions) in %.f seconds:\n\"%s\"\nFirst to %d points wins.```", g.Name, g.Source.Len(), float64(g.Pause/time.Second), g.Quiz.Description, g.WinLimit))
+}
 
-	stopQuiz(s, quizChannel)
+func (quizRenderer) History(g *Game, r *Round) string {
+	return g.historyEntry(r.Card)
 }
 
-// Run private gauntlet quiz
-func runGauntlet(s *discordgo.Session, m *discordgo.MessageCreate, quizname, timeLimitGiven string) {
+func (quizRenderer) Question(g *Game, r *Round) {
+	g.sendQuestion(r.Card)
+}
 
-	quizChannel := m.ChannelID
+func (quizRenderer) Hint(g *Game, r *Round, hint string) {
+	g.Transport.Send(g.Channel, fmt.Sprintf("```Hint: %s```", hint))
+}
 
-	// Only react in private messages
-	if len(m.GuildID) != 0 {
-		// Not a private channel
-		msgSend(s, quizChannel, fmt.Sprintf(UNICODE_NO_ENTRY_SIGN+" Game mode `%sgauntlet` is only for DM!", CMD_PREFIX))
-		return
+func (quizRenderer) Correct(g *Game, r *Round) {
+	var scorers []string
+	for _, player := range r.Order {
+		scorers = append(scorers, fmt.Sprintf("<@%s> %dp", player, g.Players[player]))
 	}
 
-	// Mark the quiz as started
-	if err := startQuiz(s, quizChannel); err != nil {
-		// Quiz already running, nothing to do here
-		return
-	}
+	g.Transport.SendEmbed(g.Channel, roundEmbed(
+		fmt.Sprintf(UNICODE_CHECK_MARK+" Correct: %s", g.questionTitle(r.Card)),
+		0x22AA22,
+		r.Card,
+		append(matchedFields(r), &discordgo.MessageEmbedField{
+			Name:   fmt.Sprintf("Scorers - %s to %d", g.Name, g.WinLimit),
+			Value:  strings.Join(scorers, ", "),
+			Inline: false,
+		})...,
+	))
+}
 
-	timeout := 120 // seconds to run complete gauntlet
+func (quizRenderer) TimedOut(g *Game, r *Round) {
+	g.Transport.SendEmbed(g.Channel, roundEmbed(
+		fmt.Sprintf(UNICODE_NO_ENTRY+" Timed out! %s", g.questionTitle(r.Card)),
+		0xAA2222,
+		r.Card,
+	))
+}
 
-	quiz := LoadQuiz(quizname, true)
-	if len(quiz.Deck) == 0 {
-		msgSend(s, quizChannel, "Failed to find quiz: "+quizname)
-		stopQuiz(s, quizChannel)
-		return
-	}
+func (quizRenderer) Finish(g *Game) {
+	g.Transport.SendEmbed(g.Channel, scoreboardEmbed(g))
+}
 
-	// Parse provided time limit with sane defaults
-	if i, err := strconv.Atoi(timeLimitGiven); err == nil {
-		if i > 20 {
-			timeout = 20 * 60
-		} else if i > 0 {
-			timeout = i * 60
-		}
-	}
+// Multi quiz presentation listing everybody's answers
+type multiRenderer struct {
+	quizRenderer
+}
 
-	c := make(chan *discordgo.MessageCreate, 100)
-	quitChan := make(chan struct{}, 100)
+func (multiRenderer) Start(g *Game) {
+	g.Transport.Send(g.Channel, fmt.Sprintf("```Starting new %s MULTI quiz (%d questions) in %.f seconds:\n\"%s\"\nFirst to %d points wins.```", g.Name, g.Source.Len(), float64(g.Pause/time.Second), g.Quiz.Description, g.WinLimit))
+}
 
-	killHandler := s.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
-		// Ignore all messages created by self and bots
-		if m.Author.ID == s.State.User.ID || m.Author.Bot {
-			return
-		}
+func (multiRenderer) Correct(g *Game, r *Round) {
+	points := g.Scoring.Points(r)
 
-		// Only react on current quiz channel
-		if m.ChannelID != quizChannel {
-			return
-		}
+	var participants string
+	for _, p := range ranking(points) {
+		participants += fmt.Sprintf(
+			"<@%s> +%d (%dp): %s\n",
+			p.Name,
+			p.Score,
+			g.Players[p.Name],
+			strings.Join(r.Answers[p.Name], ", "),
+		)
+	}
+
+	g.Transport.SendEmbed(g.Channel, roundEmbed(
+		fmt.Sprintf(UNICODE_CHECK_MARK+" Correct: %s", g.questionTitle(r.Card)),
+		0x22AA22,
+		r.Card,
+		append(matchedFields(r), &discordgo.MessageEmbedField{
+			Name:   fmt.Sprintf("Scorers - %s to %d", g.Name, g.WinLimit),
+			Value:  participants,
+			Inline: false,
+		})...,
+	))
+}
 
-		// Handle quiz aborts
-		if strings.ToLower(strings.TrimSpace(m.Content)) == CMD_PREFIX+"stop" {
-			quitChan <- struct{}{}
-			return
-		}
+// Sequential quiz presentation numbering the questions
+type sequentialRenderer struct {
+	quizRenderer
+	start int // Deck index of the first question
+	total int // Number of questions from the start index
+}
 
-		// Relay the message to the quiz loop
-		c <- m
-	})
+func (sequentialRenderer) Start(g *Game) {
+	g.Transport.Send(g.Channel, fmt.Sprintf("```Starting new %s quiz (%d questions) in %.f seconds:\n\"%s\"\nType %sstop to give up.```", g.Name, g.Source.Len(), float64(g.Pause/time.Second), g.Quiz.Description, g.Prefix))
+}
 
-	msgSend(s, quizChannel, fmt.Sprintf("```Starting new %s quiz (%d questions) in 5 seconds:\n\"%s\"\nAnswer as many as you can within %d seconds.```", quizname, len(quiz.Deck), quiz.Description, timeout))
+func (sr sequentialRenderer) Correct(g *Game, r *Round) {
+	var scorers []string
+	for _, player := range r.Order {
+		scorers = append(scorers, fmt.Sprintf("<@%s> %dp", player, g.Players[player]))
+	}
 
-	var correct, total int
-	var quizHistory []string
+	g.Transport.SendEmbed(g.Channel, roundEmbed(
+		fmt.Sprintf(UNICODE_CHECK_MARK+" #%d Correct: %s", sr.start+r.Number-1, g.questionTitle(r.Card)),
+		0x22AA22,
+		r.Card,
+		append(matchedFields(r), &discordgo.MessageEmbedField{
+			Name:   fmt.Sprintf("Scorers - %s to %d", g.Name, sr.total),
+			Value:  strings.Join(scorers, ", "),
+			Inline: false,
+		})...,
+	))
+}
 
-	// Breathing room to read start info
-	time.Sleep(5 * time.Second)
+func (sr sequentialRenderer) Finish(g *Game) {
+	var extra []*discordgo.MessageEmbedField
 
-	// Set start time and quiz timeout
-	startTime := time.Now()
-	timeoutChan := time.NewTimer(time.Duration(timeout) * time.Second)
+	if g.Source.Len() > 0 {
+		extra = append(extra, &discordgo.MessageEmbedField{
+			Name:   "Resuming",
+			Value:  fmt.Sprintf("Try `%squiz %s %d-` to continue from the last question\n", g.Prefix, g.Name, sr.start+g.Asked-1),
+			Inline: false,
+		})
+	}
 
-outer:
-	for len(quiz.Deck) > 0 {
+	g.Transport.SendEmbed(g.Channel, scoreboardEmbed(g, extra...))
+}
 
-		// Grab new word from the quiz
-		var current Card
-		current, quiz.Deck = quiz.Deck[len(quiz.Deck)-1], quiz.Deck[:len(quiz.Deck)-1]
+// Scramble presentation keeping the unscrambled word in the history
+type scrambleRenderer struct {
+	quizRenderer
+}
 
-		// Replace readings with hiragana-only version
-		answers := make([]string, len(current.Answers))
-		for i, ans := range current.Answers {
-			answers[i] = k2h(ans)
-		}
+func (scrambleRenderer) History(g *Game, r *Round) string {
+	return r.Card.primaryAnswer()
+}
 
-		// Send out quiz question
-		if quiz.Type == "text" {
-			msgSend(s, quizChannel, fmt.Sprintf("```\n%s```", current.Question))
-		} else if quiz.Type == "url" {
-			msgSend(s, quizChannel, current.Question)
-		} else {
-			imgSend(s, quizChannel, current.Question)
-		}
+// Gauntlet presentation with a private score and a public announcement
+type gauntletRenderer struct {
+	quizRenderer
+	player *discordgo.User // Player running the gauntlet
+}
 
-		select {
-		case <-quitChan:
-			timeout = int(time.Since(startTime) / time.Second)
-			break outer
-		case <-timeoutChan.C:
-			break outer
-		case msg := <-c:
-			// Increase total question count
-			total++
-
-			// Increase score if correct answer
-			if hasString(answers, k2h(msg.Content)) {
-				correct++
-			} else {
-				// Add wrong answer to quiz history
-				if quiz.Type == "text" && len(current.Answers) > 0 {
-					quizHistory = append(quizHistory, current.Answers[0])
-				} else {
-					quizHistory = append(quizHistory, current.Question)
-				}
-			}
-		}
-	}
+func (gauntletRenderer) Start(g *Game) {
+	g.Transport.Send(g.Channel, fmt.Sprintf("```Starting new %s quiz (%d questions) in %.f seconds:\n\"%s\"\nAnswer as many as you can within %d seconds.```", g.Name, g.Source.Len(), float64(g.Pause/time.Second), g.Quiz.Description, g.Timeout/time.Second))
+}
 
-	// Clean up
-	killHandler()
+// Answers aren't revealed during a gauntlet to keep things moving
+func (gauntletRenderer) Correct(g *Game, r *Round) {}
 
-	// Sleep for a little breathing room
-	time.Sleep(1 * time.Second)
+func (gauntletRenderer) TimedOut(g *Game, r *Round) {}
 
-	var score float64
-	if total > 0 {
-		score = float64(correct*correct) / float64(total)
-	}
+func (gr gauntletRenderer) Finish(g *Game) {
+	score := gauntletScore(g.Players[gr.player.ID], g.Answered)
+	seconds := int(g.Elapsed / time.Second)
 
 	// Produce scoreboard
 	embed := &discordgo.MessageEmbed{
 		Type:        "rich",
-		Title:       "Final Gauntlet Score: " + quizname,
-		Description: fmt.Sprintf("%.2f points in %d seconds", score, timeout),
+		Title:       "Final Gauntlet Score: " + g.Name,
+		Description: fmt.Sprintf("%.2f points in %d seconds", score, seconds),
 		Color:       0x33FF33,
-		Footer:      &discordgo.MessageEmbedFooter{Text: "Mistakes: " + truncate(strings.Join(quizHistory, "　"), 2000)},
+		Footer:      &discordgo.MessageEmbedFooter{Text: "Mistakes: " + truncate(strings.Join(g.History, "　"), 2000)},
 	}
 
-	embedSend(s, quizChannel, embed)
+	if g.Review && len(g.Failed) > 0 {
+		embed.Fields = []*discordgo.MessageEmbedField{
+			&discordgo.MessageEmbedField{
+				Name:   "Note",
+				Value:  fmt.Sprintf("Try `%squiz review` to replay the %d failed question(s)\n", g.Prefix, len(g.Failed)),
+				Inline: false,
+			}}
+	}
 
-	stopQuiz(s, quizChannel)
+	g.Transport.SendEmbed(g.Channel, embed)
 
-	// Produce public scoreboard if no time limit specified
-	if len(getStorage("output")) != 0 && timeLimitGiven == "" {
+	// Produce public scoreboards if no time limit specified
+	if g.Ranked {
 
 		embed := &discordgo.MessageEmbed{
 			Type:        "rich",
-			Title:       UNICODE_STOPWATCH + " New Gauntlet Score: " + quizname,
-			Description: fmt.Sprintf("%s: %.2f points in %d seconds", m.Author.Mention(), score, timeout),
+			Title:       UNICODE_STOPWATCH + " New Gauntlet Score: " + g.Name,
+			Description: fmt.Sprintf("%s: %.2f points in %d seconds", gr.player.Mention(), score, seconds),
 			Color:       0xFFAAAA,
 		}
 
-		embedSend(s, getStorage("output"), embed)
+		for _, output := range gauntletOutputs(g.Transport, gr.player.ID) {
+			g.Transport.SendEmbed(output, embed)
+		}
 	}
 }
 
-// Scramble quiz
-func runScramble(s *discordgo.Session, quizChannel string, difficulty string) {
-
-	// Mark the quiz as started
-	if err := startQuiz(s, quizChannel); err != nil {
-		// Quiz already running, nothing to do here
-		return
+// Gauntlet score rewarding both speed and accuracy
+func gauntletScore(correct, total int) float64 {
+	if total == 0 {
+		return 0
 	}
 
-	quizname := "Scramble"
-	winLimit := 10                                                           // winner score
-	timeout := 30                                                            // seconds to wait per round
-	timeoutLimit := 5                                                        // count before aborting
-	minLength := 3                                                           // default word length minimum
-	maxLength := 7                                                           // default word length maximum
-	pauseTime := time.Duration(Settings.Speed["quiz"][1]) * time.Millisecond // delay before next question
-
-	// Set delay before closing round
-	waitTime := time.Duration(Settings.Speed["quiz"][0]) * time.Millisecond
+	return float64(correct*correct) / float64(total)
+}
 
-	// Parse provided winLimit with sane defaults
-	if level, okay := Settings.Difficulty[difficulty]; okay {
-		minLength, maxLength = level[0], level[1]
+// Build an embed revealing a card's answers, with its comment at the end
+func roundEmbed(title string, color int, card Card, fields ...*discordgo.MessageEmbedField) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Type:        "rich",
+		Title:       title,
+		Description: fmt.Sprintf("**%s**", truncate(strings.Join(card.Answers, ", "), 2000)),
+		Color:       color,
+		Fields:      fields,
 	}
 
-	c := make(chan *discordgo.MessageCreate, 100)
-	quitChan := make(chan struct{}, 100)
-
-	killHandler := s.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
-		// Ignore all messages created by self and bots
-		if m.Author.ID == s.State.User.ID || m.Author.Bot {
-			return
-		}
-
-		// Only react on current quiz channel
-		if m.ChannelID != quizChannel {
-			return
-		}
-
-		// Handle quiz aborts
-		if strings.ToLower(strings.TrimSpace(m.Content)) == CMD_PREFIX+"stop" {
-			quitChan <- struct{}{}
-			return
-		}
-
-		// Relay the message to the quiz loop
-		c <- m
-	})
-
-	// Create an index order, then shuffle it
-	order := make([]int, len(Dictionary))
-	for i := range order {
-		order[i] = i
+	if len(card.Comment) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Comment",
+			Value:  truncate(card.Comment, 1024),
+			Inline: false,
+		})
 	}
-	shuffle(order)
-
-	msgSend(s, quizChannel, fmt.Sprintf("```Starting new %s quiz (%d questions) in %.f seconds:\n\"%s\"\nFirst to %d points wins.```", quizname, len(Dictionary), float64(pauseTime/time.Second), "Unscramble the English word", winLimit))
-
-	var quizHistory []string
-	players := make(map[string]int)
-	var timeoutCount int
-
-outer:
-	for _, idx := range order {
-
-		// Pick a group of scramble words from the Dictionary
-		group := Dictionary[idx]
-
-		// Grab a representative word to work with
-		word := group[0]
-
-		// Skip words that are too short/long
-		if len(word) < minLength || len(word) > maxLength {
-			continue outer
-		}
-
-		var question string
-
-		// Attempt to shuffle thrice to get something random enough
-		for i := 0; i < 3; i++ {
-			shuffled := []rune(word)
-			shuffle(shuffled)
-			if !hasString(group, string(shuffled)) {
-				question = string(shuffled)
-				break
-			}
-		}
 
-		// If we're still left with a proper word, give up and pick a new one
-		if len(question) == 0 {
-			continue outer
-		}
-
-		// Add word to quiz history
-		quizHistory = append(quizHistory, word)
-
-		// Round's score keeper
-		scoreKeeper := make(map[string]int)
-
-		// Give players time to breathe between rounds
-		time.Sleep(pauseTime)
-
-		// Drain premature "answers" from channel buffer
-		for len(c) > 0 {
-			<-c
-		}
-
-		// Send out quiz question
-		imgSend(s, quizChannel, question)
-
-		// Set timeout for no correct answers
-		timeoutChan := time.NewTimer(time.Duration(timeout) * time.Second)
-
-	inner:
-		for {
-
-			select {
-			case <-quitChan:
-				break outer
-			case <-timeoutChan.C:
-				if len(scoreKeeper) > 0 {
-					break inner
-				}
-
-				embed := &discordgo.MessageEmbed{
-					Type:        "rich",
-					Title:       fmt.Sprintf(UNICODE_NO_ENTRY+" Timed out! %s", truncate(question, 100)),
-					Description: fmt.Sprintf("**%s**", strings.Join(group, ", ")),
-					Color:       0xAA2222,
-				}
-
-				embedSend(s, quizChannel, embed)
-
-				// Mark latest question as failed in quiz history
-				quizHistory[len(quizHistory)-1] = "*" + quizHistory[len(quizHistory)-1]
-
-				timeoutCount++
-				if timeoutCount >= timeoutLimit {
-					msgSend(s, quizChannel, "```Too many timeouts in a row reached, aborting quiz.```")
-					break outer
-				}
-				break inner
-			case msg := <-c:
-				if len(msg.Content) != len(word) {
-					break
-				}
-
-				answer := strings.ToLower(msg.Content)
-
-				// Check to see the answer is part of the valid set
-				if !hasString(group, answer) {
-					break
-				}
-
-				if len(scoreKeeper) == 0 {
-					timeoutChan.Reset(waitTime)
-				}
-
-				// Make sure we don't add the same user again
-				if _, exists := scoreKeeper[msg.Author.ID]; !exists {
-					scoreKeeper[msg.Author.ID] = len(scoreKeeper) + 1
-				}
-
-				// Reset timeouts since we're active
-				timeoutCount = 0
-			}
-		}
-
-		if len(scoreKeeper) > 0 {
-
-			winnerExists := false
-			var fastest string
-			var scorers []string
-			for player, position := range scoreKeeper {
-				players[player]++
-				if position == 1 {
-					fastest = fmt.Sprintf("<@%s> %dp", player, players[player])
-				} else {
-					scorers = append(scorers, fmt.Sprintf("<@%s> %dp", player, players[player]))
-				}
-				if players[player] >= winLimit {
-					winnerExists = true
-				}
-			}
-
-			scorers = append([]string{fastest}, scorers...)
-
-			embed := &discordgo.MessageEmbed{
-				Type:        "rich",
-				Title:       fmt.Sprintf(UNICODE_CHECK_MARK+" Correct: %s", truncate(question, 100)),
-				Description: fmt.Sprintf("**%s**", truncate(strings.Join(group, ", "), 2000)),
-				Color:       0x22AA22,
-				Fields: []*discordgo.MessageEmbedField{
-					&discordgo.MessageEmbedField{
-						Name:   fmt.Sprintf("Scorers - %s to %d", quizname, winLimit),
-						Value:  strings.Join(scorers, ", "),
-						Inline: false,
-					}},
-			}
-
-			embedSend(s, quizChannel, embed)
+	return embed
+}
 
-			if winnerExists {
-				break outer
-			}
-		}
+// Field listing answers that were loosely matched to one of the card's
+// answers, if there were any
+func matchedFields(r *Round) []*discordgo.MessageEmbedField {
+	if len(r.Matched) == 0 {
+		return nil
+	}
 
+	var matches []string
+	for given, ans := range r.Matched {
+		matches = append(matches, fmt.Sprintf("%s → %s", given, ans))
 	}
+	sort.Strings(matches)
 
-	// Clean up
-	killHandler()
+	return []*discordgo.MessageEmbedField{{
+		Name:   "Accepted as",
+		Value:  truncate(strings.Join(matches, "\n"), 1024),
+		Inline: false,
+	}}
+}
 
-	// Produce scoreboard
+// Build the final scoreboard of a game, with any extra fields before the review note
+func scoreboardEmbed(g *Game, extra ...*discordgo.MessageEmbedField) *discordgo.MessageEmbed {
 	fields := make([]*discordgo.MessageEmbedField, 0, 2)
 	var winners string
 	var participants string
+	won := g.Winners()
 
-	for _, p := range ranking(players) {
-		if p.Score >= winLimit {
+	for _, p := range ranking(g.Players) {
+		if hasString(won, p.Name) {
 			winners += fmt.Sprintf("<@%s>: %d points\n", p.Name, p.Score)
 		} else {
 			participants += fmt.Sprintf("<@%s>: %d point(s)\n", p.Name, p.Score)
@@ -1010,319 +524,81 @@ outer:
 		})
 	}
 
-	// Sleep for a little breathing room
-	time.Sleep(1 * time.Second)
+	fields = append(fields, extra...)
 
-	embed := &discordgo.MessageEmbed{
+	if g.Review && len(g.Failed) > 0 {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:   "Note",
+			Value:  fmt.Sprintf("Try `%squiz review` to replay the %d failed question(s)\n", g.Prefix, len(g.Failed)),
+			Inline: false,
+		})
+	}
+
+	return &discordgo.MessageEmbed{
 		Type:        "rich",
-		Title:       "Final Quiz Scoreboard: " + quizname,
+		Title:       "Final Quiz Scoreboard: " + g.Name,
 		Description: "-------------------------------",
 		Color:       0x33FF33,
 		Fields:      fields,
-		Footer:      &discordgo.MessageEmbedFooter{Text: strings.Join(quizHistory, "　")},
+		Footer:      &discordgo.MessageEmbedFooter{Text: truncate(strings.Join(g.History, "　"), 2000)},
 	}
-
-	embedSend(s, quizChannel, embed)
-
-	stopQuiz(s, quizChannel)
 }
 
-// Run sequential kanji quiz loop in given channel
-func runQuizSequential(s *discordgo.Session, quizChannel string, quizname string, startIndex string, waitTimeGiven int, pauseTimeGiven int) {
-
-	// Mark the quiz as started
-	if err := startQuiz(s, quizChannel); err != nil {
-		// Quiz already running, nothing to do here
-		return
-	}
-
-	timeout := 20                                                 // seconds to wait per round
-	timeoutLimit := 5                                             // count before aborting
-	pauseTime := time.Duration(pauseTimeGiven) * time.Millisecond // delay before next question
-
-	// Set delay before closing round
-	waitTime := time.Duration(waitTimeGiven) * time.Millisecond
-
-	var quiz Quiz
-	if quizname == "review" {
-		quiz = getReview(quizChannel)
-	} else {
-		quiz = LoadQuiz(quizname, false)
-	}
-	if len(quiz.Deck) == 0 {
-		msgSend(s, quizChannel, "Failed to find valid quiz: "+quizname)
-		stopQuiz(s, quizChannel)
-		return
-	}
-
-	// Parse provided start index
-	idx, _ := strconv.Atoi(startIndex[:strings.Index(startIndex, "-")])
-	if idx > len(quiz.Deck) {
-		idx = len(quiz.Deck)
-	}
-
-	// Flash forward deck up to given index
-	quiz.Deck = quiz.Deck[idx:]
+// Scrambled words from the English dictionary within a length range
+type scrambleSource struct {
+	order     []int
+	minLength int
+	maxLength int
+}
 
-	// Figure out maximum possible points
-	pointLimit := len(quiz.Deck)
+// Create a source going through the dictionary in random order
+func newScrambleSource(minLength, maxLength int) *scrambleSource {
 
-	// Replace default timeout with custom if specified
-	if quiz.Timeout > 0 {
-		timeout = quiz.Timeout
+	// Create an index order, then shuffle it
+	order := make([]int, len(Dictionary))
+	for i := range order {
+		order[i] = i
 	}
+	shuffle(order)
 
-	c := make(chan *discordgo.MessageCreate, 100)
-	quitChan := make(chan struct{}, 100)
-
-	killHandler := s.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
-		// Ignore all messages created by self and bots
-		if m.Author.ID == s.State.User.ID || m.Author.Bot {
-			return
-		}
-
-		// Only react on current quiz channel
-		if m.ChannelID != quizChannel {
-			return
-		}
-
-		// Handle quiz aborts
-		if strings.ToLower(strings.TrimSpace(m.Content)) == CMD_PREFIX+"stop" {
-			quitChan <- struct{}{}
-			return
-		}
-
-		// Relay the message to the quiz loop
-		c <- m
-	})
-
-	msgSend(s, quizChannel, fmt.Sprintf("```Starting new %s quiz (%d questions) in %.f seconds:\n\"%s\"\nType %sstop to give up.```", quizname, len(quiz.Deck), float64(pauseTime/time.Second), quiz.Description, CMD_PREFIX))
-
-	var quizHistory []string
-	var failed []Card
-	var questionTitle string
-	players := make(map[string]int)
-	var timeoutCount int
-
-outer:
-	for len(quiz.Deck) > 0 {
-		time.Sleep(pauseTime)
-
-		// Grab new word from the quiz
-		var current Card
-		current, quiz.Deck = quiz.Deck[0], quiz.Deck[1:]
-
-		// Replace readings with hiragana-only version
-		answers := make([]string, len(current.Answers))
-		for i, ans := range current.Answers {
-			answers[i] = k2h(ans)
-		}
-
-		// Add word to quiz history
-		if (quiz.Type == "text" || quiz.Type == "url") && len(current.Answers) > 0 {
-			quizHistory = append(quizHistory, current.Answers[0])
-			questionTitle = ""
-		} else {
-			quizHistory = append(quizHistory, current.Question)
-			questionTitle = truncate(current.Question, 100)
-		}
+	return &scrambleSource{order: order, minLength: minLength, maxLength: maxLength}
+}
 
-		// Round's score keeper
-		scoreKeeper := make(map[string]int)
+func (src *scrambleSource) Next() (Card, bool) {
+	for len(src.order) > 0 {
+		var idx int
+		idx, src.order = src.order[0], src.order[1:]
 
-		// Drain premature "answers" from channel buffer
-		for len(c) > 0 {
-			<-c
-		}
+		// Pick a group of scramble words from the Dictionary
+		group := Dictionary[idx]
 
-		// Send out quiz question
-		if quiz.Type == "text" {
-			msgSend(s, quizChannel, fmt.Sprintf("```\n%s```", current.Question))
-		} else if quiz.Type == "url" {
-			msgSend(s, quizChannel, current.Question)
-		} else {
-			imgSend(s, quizChannel, current.Question)
-		}
+		// Grab a representative word to work with
+		word := group[0]
 
-		// Set timeout for no correct answers
-		timeoutChan := time.NewTimer(time.Duration(timeout) * time.Second)
-
-	inner:
-		for {
-
-			select {
-			case <-quitChan:
-				// Quit order received, but store remaining questions for reviews
-				if quizname == "review" {
-					// Did this question get answered
-					if len(scoreKeeper) == 0 {
-						// Store question for later review deck
-						failed = append(failed, current)
-					}
-
-					// Store unused review questions
-					failed = append(failed, quiz.Deck...)
-				}
-				break outer
-			case <-timeoutChan.C:
-				if len(scoreKeeper) > 0 {
-					break inner
-				}
-
-				embed := &discordgo.MessageEmbed{
-					Type:        "rich",
-					Title:       fmt.Sprintf(UNICODE_NO_ENTRY+" Timed out! %s", questionTitle),
-					Description: fmt.Sprintf("**%s**", truncate(strings.Join(current.Answers, ", "), 2000)),
-					Color:       0xAA2222,
-				}
-
-				if len(current.Comment) > 0 {
-					embed.Fields = []*discordgo.MessageEmbedField{
-						&discordgo.MessageEmbedField{
-							Name:   "Comment",
-							Value:  truncate(current.Comment, 1024),
-							Inline: false,
-						}}
-				}
-
-				embedSend(s, quizChannel, embed)
-
-				// Store question for later review deck
-				failed = append(failed, current)
-
-				// Mark latest question as failed in quiz history as well
-				quizHistory[len(quizHistory)-1] = "*" + quizHistory[len(quizHistory)-1]
-
-				timeoutCount++
-				if timeoutCount >= timeoutLimit {
-					msgSend(s, quizChannel, "```Too many timeouts in a row reached, aborting quiz.```")
-
-					if quizname == "review" {
-						// Store unused review questions
-						failed = append(failed, quiz.Deck...)
-					}
-
-					break outer
-				}
-				break inner
-			case msg := <-c:
-				// Handle passing on question
-				if msg.Content == ".." || msg.Content == "。。" {
-
-					// Abort the question
-					timeoutChan.Reset(0)
-
-				} else if hasString(answers, k2h(msg.Content)) {
-					if len(scoreKeeper) == 0 {
-						timeoutChan.Reset(waitTime)
-					}
-
-					// Make sure we don't add the same user again
-					if _, exists := scoreKeeper[msg.Author.ID]; !exists {
-						scoreKeeper[msg.Author.ID] = len(scoreKeeper) + 1
-					}
-
-					// Reset timeouts since we're active
-					timeoutCount = 0
-				}
-			}
+		// Skip words that are too short/long
+		if len(word) < src.minLength || len(word) > src.maxLength {
+			continue
 		}
 
-		if len(scoreKeeper) > 0 {
-
-			var fastest string
-			var scorers []string
-			for player, position := range scoreKeeper {
-				players[player]++
-				if position == 1 {
-					fastest = fmt.Sprintf("<@%s> %dp", player, players[player])
-				} else {
-					scorers = append(scorers, fmt.Sprintf("<@%s> %dp", player, players[player]))
-				}
-			}
-
-			scorers = append([]string{fastest}, scorers...)
-
-			embed := &discordgo.MessageEmbed{
-				Type:        "rich",
-				Title:       fmt.Sprintf(UNICODE_CHECK_MARK+" #%d Correct: %s", idx, questionTitle),
-				Description: fmt.Sprintf("**%s**", truncate(strings.Join(current.Answers, ", "), 2000)),
-				Color:       0x22AA22,
-				Fields: []*discordgo.MessageEmbedField{
-					&discordgo.MessageEmbedField{
-						Name:   fmt.Sprintf("Scorers - %s to %d", quizname, pointLimit),
-						Value:  strings.Join(scorers, ", "),
-						Inline: false,
-					}},
-			}
-
-			if len(current.Comment) > 0 {
-				embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
-					Name:   "Comment",
-					Value:  truncate(current.Comment, 1024),
-					Inline: false,
-				})
+		// Attempt to shuffle thrice to get something random enough
+		for i := 0; i < 3; i++ {
+			shuffled := []rune(word)
+			shuffle(shuffled)
+			if !hasString(group, string(shuffled)) {
+				return Card{Question: string(shuffled), Answers: group}, true
 			}
-
-			embedSend(s, quizChannel, embed)
 		}
 
-		// Increase question index
-		idx++
-	}
-
-	// Clean up
-	killHandler()
-
-	// Produce scoreboard
-	fields := make([]*discordgo.MessageEmbedField, 0, 2)
-	var participants string
-
-	for _, p := range ranking(players) {
-		participants += fmt.Sprintf("<@%s>: %d point(s)\n", p.Name, p.Score)
-	}
-
-	if len(participants) > 0 {
-		fields = append(fields, &discordgo.MessageEmbedField{
-			Name:   "Participants",
-			Value:  participants,
-			Inline: false,
-		})
-	}
-
-	if len(quiz.Deck) > 0 {
-		fields = append(fields, &discordgo.MessageEmbedField{
-			Name:   "Resuming",
-			Value:  fmt.Sprintf("Try `%squiz %s %d-` to continue from the last question\n", CMD_PREFIX, quizname, idx),
-			Inline: false,
-		})
-	}
-
-	if len(failed) > 0 {
-		fields = append(fields, &discordgo.MessageEmbedField{
-			Name:   "Note",
-			Value:  fmt.Sprintf("Try `%squiz review` to replay the %d failed question(s)\n", CMD_PREFIX, len(failed)),
-			Inline: false,
-		})
-	}
-
-	// Sleep for a little breathing room
-	time.Sleep(1 * time.Second)
-
-	embed := &discordgo.MessageEmbed{
-		Type:        "rich",
-		Title:       "Final Quiz Scoreboard: " + quizname,
-		Description: "-------------------------------",
-		Color:       0x33FF33,
-		Fields:      fields,
-		Footer:      &discordgo.MessageEmbedFooter{Text: truncate(strings.Join(quizHistory, "　"), 2000)},
+		// If we're still left with a proper word, give up and pick a new one
 	}
 
-	embedSend(s, quizChannel, embed)
+	return Card{}, false
+}
 
-	// Store review questions in memory
-	quiz.Deck = failed
-	putReview(quizChannel, copyQuiz(quiz))
+func (src *scrambleSource) Len() int {
+	return len(src.order)
+}
 
-	stopQuiz(s, quizChannel)
+func (src *scrambleSource) Rest() []Card {
+	return nil
 }
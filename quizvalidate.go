@@ -1,9 +1,9 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime"
@@ -32,18 +32,21 @@ func (set *SortedStringSet) Add(s string) bool {
 }
 
 // AddOrdered takes in a string and an integer to identify its position
+// Strings already in the set keep their position
 func (set *SortedStringSet) AddOrdered(s string, i int) bool {
 	_, exists := set.content[s]
-	set.content[s] = i
+	if !exists {
+		set.content[s] = i
+	}
 	return !exists
 }
 
-// AddAll inserts multiple string elements into set
+// AddAll inserts multiple string elements into set, after the ones already in it
 // Returns any strings that already exist in set (unconventional, but I want to print them)
 func (set *SortedStringSet) AddAll(strs ...string) []string {
 	var dups []string
-	for i, s := range strs {
-		changed := set.AddOrdered(s, i)
+	for _, s := range strs {
+		changed := set.Add(s)
 		if !changed {
 			dups = append(dups, s)
 		}
@@ -75,15 +78,116 @@ func (set SortedStringSet) Values() []string {
 	return keys
 }
 
-// ValidateQuizzes will run through the following checks:
-//   checkDuplicates - validates duplicate questions and answers
+// Issue is a single problem a validator found in a deck
+type Issue struct {
+	Check    string `json:"check"`
+	Card     int    `json:"card,omitempty"` // Position in the deck counting from 1, 0 for the whole deck
+	Question string `json:"question,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Report holds everything the validators found in one deck
+type Report struct {
+	Quiz    string   `json:"quiz"`
+	Cards   int      `json:"cards"`
+	Issues  []Issue  `json:"issues"`
+	Skipped []string `json:"skipped,omitempty"` // Checks that couldn't run and why
+	Diff    string   `json:"diff,omitempty"`    // Proposed fix as a unified diff
+	Fix     *QuizFix `json:"-"`
+}
+
+// Issue with a given card found by given validator
+func newIssue(v Validator, i int, card Card, message string) Issue {
+	return Issue{Check: v.Name(), Card: i + 1, Question: card.Question, Message: message}
+}
+
+// Run all validators on a deck
+func validateQuiz(name string, quiz Quiz) Report {
+	report := Report{Quiz: name, Cards: len(quiz.Deck), Issues: []Issue{}}
+	if len(quiz.Deck) == 0 {
+		report.Issues = append(report.Issues, Issue{Check: "load", Message: "Deck failed to load"})
+		return report
+	}
+
+	for _, v := range Validators {
+		issues, err := v.Check(quiz)
+		if err != nil {
+			report.Skipped = append(report.Skipped, v.Name()+": "+err.Error())
+			continue
+		}
+		report.Issues = append(report.Issues, issues...)
+	}
+
+	return report
+}
+
+// Check whether any of the report's issues came from given check
+func (r Report) Has(check string) bool {
+	for _, issue := range r.Issues {
+		if issue.Check == check {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Text renders the report for people, one issue per line
+func (r Report) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %d cards, %d issues\n", r.Quiz, r.Cards, len(r.Issues))
+	for _, issue := range r.Issues {
+		if issue.Card > 0 {
+			fmt.Fprintf(&b, "\t%s: card %d (%s): %s\n", issue.Check, issue.Card, strings.ReplaceAll(issue.Question, "\n", " "), issue.Message)
+		} else {
+			fmt.Fprintf(&b, "\t%s: %s\n", issue.Check, issue.Message)
+		}
+	}
+	for _, skipped := range r.Skipped {
+		fmt.Fprintf(&b, "\tskipped %s\n", skipped)
+	}
+	b.WriteString(r.Diff)
+
+	return b.String()
+}
+
+// Write reports in given format, text or json
+func writeReports(w io.Writer, reports []Report, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "\t")
+		return enc.Encode(reports)
+	case "text":
+		for _, report := range reports {
+			if _, err := io.WriteString(w, report.Text()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("Unknown report format: %s", format)
+}
+
+// ValidateQuizzes will run every validator in Validators on the given quizzes:
+//   empty - empty questions and answers
+//   duplicates - duplicate questions and answers
+//   kana - answers that are matched the same
+//   url - malformed URLs in url decks
+//   width - questions too wide to render legibly
+//   comment - comments too long for an embed field
+//   glyphs - characters missing from the font
+//   render - render options that can't be drawn with
 //
 // Parameter quizNames defines the quizzes to be checked
-// Parameter generateFix is a boolean that controls the creation of fixed quiz copies
-func ValidateQuizzes(quizNames []string, generateFix bool) {
+// Parameter generateFix is a boolean that controls proposing fixes, which are only written with QuizFix.Apply
+// Returns a report for every quiz, sorted by name
+func ValidateQuizzes(quizNames []string, generateFix bool) []Report {
 
 	quizzes := make(chan string, len(quizNames))
-	done := make(chan string, len(quizNames))
+	done := make(chan *Report, len(quizNames))
 
 	for w := 0; w < runtime.NumCPU(); w++ {
 		go quizValidationWorker(quizzes, done, generateFix)
@@ -94,84 +198,73 @@ func ValidateQuizzes(quizNames []string, generateFix bool) {
 	}
 	close(quizzes)
 
+	var reports []Report
 	for w := 0; w < len(quizNames); w++ {
-		q := <-done
-		log.Printf("[%s] Validation complete\n", q)
+		if report := <-done; report != nil {
+			log.Printf("[%s] Validation complete\n", report.Quiz)
+			reports = append(reports, *report)
+		}
 	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Quiz < reports[j].Quiz
+	})
+
+	return reports
 }
 
-func quizValidationWorker(quizzes <-chan string, done chan<- string, generateFix bool) {
+func quizValidationWorker(quizzes <-chan string, done chan<- *Report, generateFix bool) {
 	for quizName := range quizzes {
-		quiz := LoadQuiz(quizName, true)
-		log.Printf("[%s] Running checks...\n", quizName)
 
-		// Run checks
-		//
-		// *TODO* look into making a validator interface and move specific validation logic into structs when the list
-		//        of validations grows too long, or if some have particularly complex logic
-		fixed, hasError := checkDuplicates(quiz)
+		// Combined decks are checked through the decks they're made of
+		Quizzes.RLock()
+		combined := isDeckExpr(Quizzes.Map[quizName])
+		Quizzes.RUnlock()
+		if combined {
+			done <- nil
+			continue
+		}
+
+		quiz := LoadQuiz(quizName, false)
+		log.Printf("[%s] Running checks...\n", quizName)
 
+		report := validateQuiz(quizName, quiz)
+		hasError := report.Has("duplicates")
 		if hasError && generateFix {
+			Quizzes.RLock()
+			fileName := Quizzes.Map[quizName]
+			Quizzes.RUnlock()
 
-			// Create a copy of quiz file
-			// Delete if exists
-			fileName := QUIZ_FOLDER + Quizzes.Map[quizName] + ".fix"
-			if _, err := os.Stat(fileName); !os.IsNotExist(err) {
-				err := os.Remove(fileName)
-				if err != nil {
-					log.Fatal(err)
-				}
-			}
-			f, err := os.Create(fileName)
+			fix, err := fixQuizFile(QUIZ_FOLDER + fileName)
 			if err != nil {
-				log.Fatal(err)
-			}
-			w := bufio.NewWriter(f)
-
-			// Write quiz JSON file
-			buf := new(bytes.Buffer)
-			enc := json.NewEncoder(buf)
-			enc.SetEscapeHTML(false)
-			if err := enc.Encode(&fixed); err != nil {
-				log.Fatal(err)
+				log.Printf("ERROR, [%s] Couldn't fix %s: %s\n", quizName, fileName, err)
+			} else if fix != nil {
+				report.Fix = fix
+				report.Diff = fix.Diff()
+				log.Printf("[%s] Proposed fix for %s\n", quizName, fileName)
 			}
-
-			// Indent the JSON manually
-			j := strings.NewReplacer(
-				`"description":`, "\n\t"+`"description": `,
-				`"type":`, "\n\t"+`"type": `,
-				`"timeout":`, "\n\t"+`"timeout": `,
-				`"deck":[`, "\n\t"+`"deck": [`,
-				`{"question":`, "\n\t\t"+`{ "question": `,
-				`,"answers":[`, `, "answers": [ `,
-				`],"comment":`, ` ], "comment": `,
-				`}]}`, "}\n\t]\n}",
-			).Replace(buf.String())
-			strings.NewReplacer(
-				`]}`, `] }`,
-				`"}`, `" }`,
-				`"]`, `" ]`,
-			).WriteString(w, j)
-			w.Flush()
-			f.Close()
-			log.Printf("[%s] Generated fixed file %s\n", quizName, fileName)
 		}
 
-		done <- quizName
+		done <- &report
 	}
 }
 
 // Checks duplicate questions and answers in a given quiz
 // Currently the strategy is to merge the answers and comments for cards with the same question
-// Returns fixed quiz
+// Returns fixed quiz, with cards in their original order
 func checkDuplicates(quiz Quiz) (Quiz, bool) {
 	log.Println("Checking duplicates...")
 	var hasError bool
 
 	// Use a map to hold merged card data temporarily
 	cardMap := make(map[string][]*SortedStringSet)
+	firstCards := make(map[string]Card)
+	var questions []string
 	for _, card := range quiz.Deck {
 		question := card.Question
+		if _, seen := firstCards[question]; !seen {
+			firstCards[question] = card
+			questions = append(questions, question)
+		}
 
 		var cardDataSets []*SortedStringSet
 		if cardMap[question] != nil {
@@ -181,7 +274,9 @@ func checkDuplicates(quiz Quiz) (Quiz, bool) {
 		} else {
 			cardDataSets = []*SortedStringSet{NewStringSet(), NewStringSet()}
 		}
-		cardDataSets[1].Add(card.Comment)
+		if len(card.Comment) > 0 {
+			cardDataSets[1].Add(card.Comment)
+		}
 
 		dups := cardDataSets[0].AddAll(card.Answers...)
 		if dups != nil {
@@ -191,30 +286,56 @@ func checkDuplicates(quiz Quiz) (Quiz, bool) {
 		cardMap[question] = cardDataSets
 	}
 
-	// Populate quiz deck with fixed cards
-	fixedDeck := make([]Card, len(cardMap))
-	i := 0
-	for question, cardDataSets := range cardMap {
-		fixedDeck[i] = Card{
-			Question: question,
-			Answers:  cardDataSets[0].Values(),
-			Comment:  strings.Join(cardDataSets[1].Values(), "\n"),
-		}
-		i++
+	// Populate quiz deck with fixed cards, where their question first appeared
+	fixedDeck := make([]Card, len(questions))
+	for i, question := range questions {
+		// Other card fields are kept from the first card with the question
+		cardDataSets := cardMap[question]
+		fixedDeck[i] = firstCards[question]
+		fixedDeck[i].Answers = cardDataSets[0].Values()
+		fixedDeck[i].Comment = strings.Join(cardDataSets[1].Values(), "\n")
 	}
-	sort.Slice(fixedDeck, func(i, j int) bool {
 
-		// Since we're deduping, the questions should never be equal
-		if fixedDeck[i].Question < fixedDeck[j].Question {
-			return true
+	fixedQuiz := quiz
+	fixedQuiz.Deck = fixedDeck
+
+	return fixedQuiz, hasError
+}
+
+// Run the validation asked for on the command line, writing reports to stdout
+// and applying proposed fixes if confirmed
+// Returns whether any issues were found
+func runValidate() (bool, error) {
+	if err := loadQuizList(); err != nil {
+		return false, err
+	}
+
+	// Glyphs can only be checked with the font, which isn't always around
+	if _, err := os.Stat(RESOURCES_FOLDER + fontFile); err == nil {
+		loadFont()
+	}
+
+	quizNames := GetQuizlist()
+	if Validate.Decks != "all" {
+		quizNames = strings.Split(Validate.Decks, ",")
+	}
+
+	reports := ValidateQuizzes(quizNames, Validate.Fix || Validate.Apply)
+	if err := writeReports(os.Stdout, reports, Validate.Report); err != nil {
+		return false, err
+	}
+
+	var found bool
+	for _, report := range reports {
+		found = found || len(report.Issues) > 0
+		if report.Fix == nil || !Validate.Apply {
+			continue
 		}
-		return false
-	})
+		if err := report.Fix.Apply(); err != nil {
+			return found, err
+		}
+		log.Printf("[%s] Fixed %s\n", report.Quiz, report.Fix.File)
+	}
 
-	return Quiz{
-		Description: quiz.Description,
-		Type:        quiz.Type,
-		Timeout:     quiz.Timeout,
-		Deck:        fixedDeck,
-	}, hasError
+	return found, nil
 }
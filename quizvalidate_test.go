@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -59,9 +62,9 @@ func TestValidations(t *testing.T) {
 	// Would be better to eventually have another less specific test covering the bot's initialization
 	loadQuizList()
 	Quizzes.Map[TestQuiz] = "_" + TestQuiz + ".json"
-	fixedQuizPath := QUIZ_FOLDER + Quizzes.Map[TestQuiz] + ".fix"
 
 	// Raw strings and indentation don't go together
+	// Only the duplicate cards change, everything else is left where it was
 	correctQuizRaw := `{
 	"description": "Test quiz with duplicates",
 	"type": "text",
@@ -69,26 +72,39 @@ func TestValidations(t *testing.T) {
 		{ "question": "q1", "answers": [ "aaa", "bbb" ], "comment": "c1\nc2" },
 		{ "question": "q2", "answers": [ "ccc", "ddd", "eee" ], "comment": "c3" }
 	]
-}`
-	correctQuiz := createTestQuiz(correctQuizRaw)
+}
+`
 
 	// Actual validation logic is tested below
-	// This test covers the genereation of fixed quiz copies
-	ValidateQuizzes(GetQuizlist(), true)
-	var fixedQuiz Quiz
-	f, err := os.Open(fixedQuizPath)
-	if err != nil {
-		log.Fatal(err)
+	// This test covers proposing and applying fixes
+	var fix *QuizFix
+	for _, report := range ValidateQuizzes(GetQuizlist(), true) {
+		if report.Quiz == TestQuiz {
+			fix = report.Fix
+			if !strings.Contains(report.Diff, "\n-\t\t{ \"question\": \"q1\", \"answers\": [ \"bbb\" ], \"comment\": \"c2\" },\n") {
+				t.Errorf("Unexpected diff:\n%s", report.Diff)
+			}
+		}
+	}
+	if fix == nil {
+		t.Fatal("No fix proposed")
+	}
+	if diff := cmp.Diff(correctQuizRaw, string(fix.Fixed)); diff != "" {
+		t.Errorf("Unexpected fix (-want +got):\n%s", diff)
 	}
-	json.NewDecoder(f).Decode(&fixedQuiz)
-	f.Close()
 
-	// Ignoring comment field because supporting field-specific comparison behavior is too annoying
-	if !quizEqual(correctQuiz, fixedQuiz, cmpopts.IgnoreFields(Card{}, "Comment")) {
-		t.Errorf("Check duplicates failed! %+v != %+v", correctQuiz, fixedQuiz)
+	// Fixes are written to the deck file, as long as it hasn't changed since
+	fix.File = filepath.Join(t.TempDir(), "deck.json")
+	os.WriteFile(fix.File, fix.Original, 0644)
+	if err := fix.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if written, _ := os.ReadFile(fix.File); string(written) != correctQuizRaw {
+		t.Errorf("Fix wasn't written: %s", written)
+	}
+	if err := fix.Apply(); err == nil {
+		t.Error("Fix applied to a changed file")
 	}
-	// Clean up
-	os.Remove(fixedQuizPath)
 }
 
 func TestDuplicateValidation(t *testing.T) {
@@ -118,6 +134,15 @@ func TestDuplicateValidation(t *testing.T) {
 	if !quizEqual(dedupQuiz, fixedQuiz, cmpopts.IgnoreFields(Card{}, "Comment")) {
 		t.Errorf("Check duplicates failed! %+v != %+v", dedupQuiz, fixedQuiz)
 	}
+
+	// Cards stay in the order their questions first appear in
+	dupQuiz.Deck = append([]Card{{Question: "q3", Answers: []string{"fff"}}}, dupQuiz.Deck...)
+	dupQuiz.Deck = append(dupQuiz.Deck, Card{Question: "q3", Answers: []string{"ggg", "fff"}, Comment: "c4"})
+	fixedQuiz, _ = checkDuplicates(dupQuiz)
+	expected := append([]Card{{Question: "q3", Answers: []string{"fff", "ggg"}, Comment: "c4"}}, dedupQuiz.Deck...)
+	if diff := cmp.Diff(expected, fixedQuiz.Deck); diff != "" {
+		t.Errorf("Check duplicates changed the order (-want +got):\n%s", diff)
+	}
 }
 
 func createTestQuiz(raw string) (quiz Quiz) {
@@ -138,3 +163,59 @@ func quizEqual(qx, qy Quiz, additionalOpts ...cmp.Option) bool {
 	opts = append(opts, additionalOpts...)
 	return cmp.Equal(qx, qy, opts...)
 }
+
+func TestValidators(t *testing.T) {
+	quiz := Quiz{
+		Type: MEDIA_IMAGE,
+		Deck: []Card{
+			{Question: "ok", Answers: []string{"a"}},
+			{Question: " ", Answers: []string{""}},
+			{Question: "q", Answers: []string{"b", "b"}},
+			{Question: "q", Answers: []string{"c"}},
+			{Question: "kana", Answers: []string{"イチ", "いち", "ｲﾁ"}},
+			{Question: "http//broken", Answers: []string{"d"}, Media: MEDIA_URL},
+			{Question: "https://example.com/a.png", Answers: []string{"e"}, Media: MEDIA_URL},
+			{Question: strings.Repeat("漢", 20), Answers: []string{"f"}},
+			{Question: "short\n" + strings.Repeat("w", 40), Answers: []string{"g"}},
+			{Question: "long", Answers: []string{"h"}, Comment: strings.Repeat("c", MAX_COMMENT_LENGTH+1)},
+			{Question: "../resources/secret.png", Answers: []string{"i"}, Media: MEDIA_FILE},
+			{Question: "missing.png", Answers: []string{"j"}, Media: MEDIA_FILE},
+		},
+	}
+
+	report := validateQuiz("test", quiz)
+
+	found := make(map[string][]int)
+	for _, issue := range report.Issues {
+		found[issue.Check] = append(found[issue.Check], issue.Card)
+	}
+	expected := map[string][]int{
+		"empty":      {2, 2},
+		"duplicates": {3, 4},
+		"kana":       {5, 5},
+		"url":        {6},
+		"files":      {11, 12},
+		"width":      {8, 9},
+		"comment":    {10},
+	}
+	if diff := cmp.Diff(expected, found); diff != "" {
+		t.Errorf("Unexpected issues (-want +got):\n%s", diff)
+	}
+
+	// Font dependent checks are skipped without the font
+	if fontTtf == nil && len(report.Skipped) != 1 {
+		t.Errorf("Expected glyphs check to be skipped: %v", report.Skipped)
+	}
+
+	var text, raw bytes.Buffer
+	if err := writeReports(&text, []Report{report}, "text"); err != nil || !strings.Contains(text.String(), "url: card 6 (http//broken): Malformed URL") {
+		t.Errorf("Unexpected text report: %v\n%s", err, text.String())
+	}
+	if err := writeReports(&raw, []Report{report}, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []Report
+	if err := json.Unmarshal(raw.Bytes(), &decoded); err != nil || !cmp.Equal([]Report{report}, decoded) {
+		t.Errorf("JSON report doesn't round trip: %v", err)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/text/width"
+)
+
+// Widest question line in pixels that still reads well once Discord scales
+// the image down, about 16 kanji at the default font size
+const MAX_RENDER_WIDTH = 1200
+
+// Longest comment that fits an embed field without being truncated
+const MAX_COMMENT_LENGTH = 1024
+
+// Validator checks a deck for one kind of problem
+type Validator interface {
+	Name() string
+
+	// Problems found in the deck, or an error if the check couldn't run
+	Check(quiz Quiz) ([]Issue, error)
+}
+
+// Checks run on every deck, in report order
+var Validators = []Validator{
+	emptyValidator{},
+	duplicateValidator{},
+	kanaValidator{},
+	urlValidator{},
+	fileValidator{},
+	widthValidator{},
+	commentValidator{},
+	glyphValidator{},
+	renderValidator{},
+}
+
+// Flags cards without a question or without answers, and empty answers
+type emptyValidator struct{}
+
+func (emptyValidator) Name() string { return "empty" }
+
+func (ev emptyValidator) Check(quiz Quiz) (issues []Issue, err error) {
+	for i, card := range quiz.Deck {
+		if len(strings.TrimSpace(card.Question)) == 0 {
+			issues = append(issues, newIssue(ev, i, card, "Empty question"))
+		}
+		if len(card.Answers) == 0 {
+			issues = append(issues, newIssue(ev, i, card, "No answers"))
+		}
+		for _, ans := range card.Answers {
+			if len(strings.TrimSpace(ans)) == 0 {
+				issues = append(issues, newIssue(ev, i, card, "Empty answer"))
+				break
+			}
+		}
+	}
+
+	return issues, nil
+}
+
+// Flags questions asked more than once and answers given twice on a card,
+// the same problems checkDuplicates fixes
+type duplicateValidator struct{}
+
+func (duplicateValidator) Name() string { return "duplicates" }
+
+func (dv duplicateValidator) Check(quiz Quiz) (issues []Issue, err error) {
+	seen := make(map[string]int)
+	for i, card := range quiz.Deck {
+		if first, ok := seen[card.Question]; ok {
+			issues = append(issues, newIssue(dv, i, card, fmt.Sprintf("Same question as card %d", first+1)))
+		} else {
+			seen[card.Question] = i
+		}
+
+		var answers []string
+		for _, ans := range card.Answers {
+			if hasString(answers, ans) {
+				issues = append(issues, newIssue(dv, i, card, "Duplicate answer: "+ans))
+			}
+			answers = append(answers, ans)
+		}
+	}
+
+	return issues, nil
+}
+
+// Flags answers that only differ in ways answer matching ignores, like
+// katakana and hiragana or full-width and half-width
+type kanaValidator struct{}
+
+func (kanaValidator) Name() string { return "kana" }
+
+func (kv kanaValidator) Check(quiz Quiz) (issues []Issue, err error) {
+	for i, card := range quiz.Deck {
+		keys := make(map[string]string)
+		for _, ans := range card.Answers {
+			key := normalizeKana(ans, quiz.LongVowels)
+			if quiz.SmallKana {
+				key = foldSmallKana(key)
+			}
+			if other, ok := keys[key]; ok && other != ans {
+				issues = append(issues, newIssue(kv, i, card, fmt.Sprintf("Answers %s and %s are matched the same", other, ans)))
+			}
+			keys[key] = ans
+		}
+	}
+
+	return issues, nil
+}
+
+// Flags url questions that aren't absolute http or https links
+type urlValidator struct{}
+
+func (urlValidator) Name() string { return "url" }
+
+func (uv urlValidator) Check(quiz Quiz) (issues []Issue, err error) {
+	for i, card := range quiz.Deck {
+		if quiz.media(card) != MEDIA_URL {
+			continue
+		}
+
+		link, err := url.ParseRequestURI(card.Question)
+		if err != nil || (link.Scheme != "http" && link.Scheme != "https") || len(link.Host) == 0 {
+			issues = append(issues, newIssue(uv, i, card, "Malformed URL"))
+		}
+	}
+
+	return issues, nil
+}
+
+// Flags file questions outside the quizzes folder or missing from it
+type fileValidator struct{}
+
+func (fileValidator) Name() string { return "files" }
+
+func (fv fileValidator) Check(quiz Quiz) (issues []Issue, err error) {
+	for i, card := range quiz.Deck {
+		if quiz.media(card) != MEDIA_FILE {
+			continue
+		}
+
+		if !filepath.IsLocal(card.Question) {
+			issues = append(issues, newIssue(fv, i, card, "File outside the quizzes folder"))
+		} else if _, err := os.Stat(filepath.Join(QUIZ_FOLDER, card.Question)); err != nil {
+			issues = append(issues, newIssue(fv, i, card, "Missing file"))
+		}
+	}
+
+	return issues, nil
+}
+
+// Flags image questions with lines too wide to read once scaled down, or
+// columns too tall in vertical decks, measured with the deck's font if it's
+// loaded and estimated otherwise
+type widthValidator struct{}
+
+func (widthValidator) Name() string { return "width" }
+
+func (wv widthValidator) Check(quiz Quiz) (issues []Issue, err error) {
+	opts := RenderOptions{}.with(quiz.Render)
+	size := fontSize
+	if opts.Size > 0 {
+		size = opts.Size
+	}
+
+	var face font.Face
+	if ttf, err := getFont(opts.Font); err == nil && ttf != nil {
+		ff := newFallbackFace(fontChain(ttf), &truetype.Options{Size: size, DPI: fontDpi})
+		defer ff.Close()
+		face = ff
+	}
+
+	for i, card := range quiz.Deck {
+		if quiz.media(card) != MEDIA_IMAGE {
+			continue
+		}
+
+		for _, line := range strings.Split(card.Question, "\n") {
+			if opts.Vertical {
+				if h := utf8.RuneCountInString(line) * int(math.Ceil(size*fontDpi/72*1.05)); h > MAX_RENDER_WIDTH {
+					issues = append(issues, newIssue(wv, i, card, fmt.Sprintf("Column is %dpx tall, over %dpx", h, MAX_RENDER_WIDTH)))
+					break
+				}
+			} else if w := renderWidth(face, line, size); w > MAX_RENDER_WIDTH {
+				issues = append(issues, newIssue(wv, i, card, fmt.Sprintf("Line is %dpx wide, over %dpx", w, MAX_RENDER_WIDTH)))
+				break
+			}
+		}
+	}
+
+	return issues, nil
+}
+
+// Width of a line drawn at given font size, full-width characters counting
+// as a full em and others as half of one without a font
+func renderWidth(face font.Face, line string, size float64) int {
+	if face != nil {
+		return font.MeasureString(face, line).Round()
+	}
+
+	var w float64
+	for _, r := range line {
+		switch width.LookupRune(r).Kind() {
+		case width.EastAsianWide, width.EastAsianFullwidth:
+			w += size * fontDpi / 72
+		default:
+			w += size * fontDpi / 72 / 2
+		}
+	}
+
+	return int(w)
+}
+
+// Flags comments that would be cut short in the answer embed
+type commentValidator struct{}
+
+func (commentValidator) Name() string { return "comment" }
+
+func (cv commentValidator) Check(quiz Quiz) (issues []Issue, err error) {
+	for i, card := range quiz.Deck {
+		if n := utf8.RuneCountInString(card.Comment); n > MAX_COMMENT_LENGTH {
+			issues = append(issues, newIssue(cv, i, card, fmt.Sprintf("Comment is %d characters, over %d", n, MAX_COMMENT_LENGTH)))
+		}
+	}
+
+	return issues, nil
+}
+
+// Flags image questions and answers with characters that neither the deck's
+// font nor any fallback can draw
+type glyphValidator struct{}
+
+func (glyphValidator) Name() string { return "glyphs" }
+
+func (gv glyphValidator) Check(quiz Quiz) (issues []Issue, err error) {
+	ttf, err := getFont(RenderOptions{}.with(quiz.Render).Font)
+	if err != nil {
+		return nil, err
+	}
+	if ttf == nil {
+		return nil, fmt.Errorf("Font isn't loaded")
+	}
+	chain := fontChain(ttf)
+
+	for i, card := range quiz.Deck {
+		texts := card.Answers
+		if quiz.media(card) == MEDIA_IMAGE {
+			texts = append([]string{card.Question}, texts...)
+		}
+
+		if missing := missingGlyphs(chain, strings.Join(texts, "")); len(missing) > 0 {
+			issues = append(issues, newIssue(gv, i, card, "No font has glyphs for "+missing))
+		}
+	}
+
+	return issues, nil
+}
+
+// Flags render options that can't be drawn with, like unknown themes or fonts
+// missing from resources
+type renderValidator struct{}
+
+func (renderValidator) Name() string { return "render" }
+
+func (rv renderValidator) Check(quiz Quiz) (issues []Issue, err error) {
+	if quiz.Render == nil {
+		return nil, nil
+	}
+
+	if err := quiz.Render.validate(); err != nil {
+		issues = append(issues, Issue{Check: rv.Name(), Message: err.Error()})
+	}
+
+	return issues, nil
+}
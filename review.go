@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Filename for persisted review decks
+const REVIEW_FILE = "review.json"
+
+// Most cards kept in a personal review deck, the oldest misses go first
+const REVIEW_DECK_LIMIT = 200
+
+// Added to the deck name of review decks from reversed games, so it can be
+// given as a single word
+const REVIEW_REVERSE_SUFFIX = ":reverse"
+
+// Review keeps track of review quizzes, both for the channels they belong to
+// and for every player who missed questions
+// Personal review decks are kept apart per deck they came from, so that every
+// card is judged and drawn by the rules of its own deck
+var Review struct {
+	sync.RWMutex
+	ChannelID   map[string]Quiz            `json:"channels"`
+	ChannelDeck map[string]string          `json:"channel_decks"` // Deck each channel's review deck came from
+	UserID      map[string]map[string]Quiz `json:"user_decks"`    // Review decks by player, then by deck
+	Persist     bool                       `json:"-"`             // Whether review decks are kept on disk
+}
+
+// Serializes writes of the review file
+var reviewWriter sync.Mutex
+
+// Get review quiz for given channel, the deck stays in place until replaced
+func getReview(quizChannel string) Quiz {
+	Review.RLock()
+	result := copyQuiz(Review.ChannelID[quizChannel])
+	Review.RUnlock()
+
+	shuffle(result.Deck)
+
+	return result
+}
+
+// Deck the review quiz of given channel came from
+func reviewSource(quizChannel string) string {
+	Review.RLock()
+	defer Review.RUnlock()
+
+	return Review.ChannelDeck[quizChannel]
+}
+
+// Insert quiz into Review for given channel, along with the deck it came from
+func putReview(quizChannel string, deck string, quiz Quiz) {
+	Review.Lock()
+	Review.ChannelID[quizChannel] = quiz
+	Review.ChannelDeck[quizChannel] = deck
+	Review.Unlock()
+
+	writeReview()
+}
+
+// Get a player's personal review quiz for given deck, the deck stays in place
+// until replaced
+func getUserReview(userID string, deck string) Quiz {
+	Review.RLock()
+	result := copyQuiz(Review.UserID[userID][deck])
+	Review.RUnlock()
+
+	shuffle(result.Deck)
+
+	return result
+}
+
+// Number of cards in each of a player's personal review decks
+func userReviewSizes(userID string) map[string]int {
+	Review.RLock()
+	defer Review.RUnlock()
+
+	sizes := make(map[string]int)
+	for deck, quiz := range Review.UserID[userID] {
+		sizes[deck] = len(quiz.Deck)
+	}
+
+	return sizes
+}
+
+// Replace a player's personal review quiz for given deck, removing it once
+// there's nothing left to review
+func putUserReview(userID string, deck string, quiz Quiz) {
+	Review.Lock()
+	if len(quiz.Deck) > 0 {
+		if Review.UserID[userID] == nil {
+			Review.UserID[userID] = make(map[string]Quiz)
+		}
+		Review.UserID[userID][deck] = quiz
+	} else {
+		delete(Review.UserID[userID], deck)
+		if len(Review.UserID[userID]) == 0 {
+			delete(Review.UserID, userID)
+		}
+	}
+	Review.Unlock()
+
+	writeReview()
+}
+
+// Add missed cards to every player's personal review quiz for given deck,
+// taking on the deck's latest rules
+func mergeUserReviews(deck string, quiz Quiz, missed map[string][]Card) {
+	if len(missed) == 0 || len(deck) == 0 {
+		return
+	}
+
+	Review.Lock()
+	for player, cards := range missed {
+		if Review.UserID[player] == nil {
+			Review.UserID[player] = make(map[string]Quiz)
+		}
+
+		review := quiz
+		review.Deck = Review.UserID[player][deck].Deck
+
+		for _, card := range cards {
+			if !hasCard(review.Deck, card.Question) {
+				review.Deck = append(review.Deck, card)
+			}
+		}
+
+		// Only the latest misses are kept
+		if over := len(review.Deck) - REVIEW_DECK_LIMIT; over > 0 {
+			review.Deck = review.Deck[over:]
+		}
+
+		Review.UserID[player][deck] = copyQuiz(review)
+	}
+	Review.Unlock()
+
+	writeReview()
+}
+
+// Check whether a deck has a card with the given question
+func hasCard(deck []Card, question string) bool {
+	for _, card := range deck {
+		if card.Question == question {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Review deck and max score from the review command's arguments, in any order
+func parseReviewArgs(args []string) (deck string, winLimit string) {
+	var reverse bool
+	for _, arg := range args {
+		if _, err := strconv.Atoi(arg); err == nil {
+			winLimit = arg
+		} else if strings.ToLower(arg) == "reverse" {
+			reverse = true
+		} else {
+			deck = arg
+		}
+	}
+
+	if reverse && !strings.HasSuffix(deck, REVIEW_REVERSE_SUFFIX) {
+		deck += REVIEW_REVERSE_SUFFIX
+	}
+
+	return deck, winLimit
+}
+
+// Run a player's personal review quiz for given deck in DM, which may be left
+// out if there's only one
+func runReview(t Transport, m *discordgo.MessageCreate, deck string, winLimitGiven string) {
+
+	// Only react in private messages
+	if len(m.GuildID) != 0 {
+		// Not a private channel
+		t.Send(m.ChannelID, fmt.Sprintf(UNICODE_NO_ENTRY_SIGN+" Game mode `%sreview` is only for DM!", guildPrefix(m.GuildID)))
+		return
+	}
+
+	// Mark the quiz as started
+	if err := startQuiz(t, m.ChannelID); err != nil {
+		// Quiz already running, nothing to do here
+		return
+	}
+
+	sizes := userReviewSizes(m.Author.ID)
+	if len(sizes) == 0 {
+		t.Send(m.ChannelID, "No missed questions to review, well done!")
+		stopQuiz(t, m.ChannelID)
+		return
+	}
+	if len(deck) == 0 && len(sizes) == 1 {
+		for name := range sizes {
+			deck = name
+		}
+	}
+
+	quiz := getUserReview(m.Author.ID, deck)
+	if len(quiz.Deck) == 0 {
+		var decks []string
+		for name, size := range sizes {
+			decks = append(decks, fmt.Sprintf("%s (%d)", name, size))
+		}
+		sort.Strings(decks)
+		t.Send(m.ChannelID, fmt.Sprintf("Missed questions to review: ```%s```\nUse `%sreview <deck>` to review one of them.", strings.Join(decks, ", "), guildPrefix(m.GuildID)))
+		stopQuiz(t, m.ChannelID)
+		return
+	}
+
+	g := newGame(t, m.ChannelID, "review", quiz)
+	g.Starter = m.Author.ID
+	g.ReviewUser = m.Author.ID
+	g.ReviewDeck = deck
+
+	// Review decks are played until the end
+	g.WinLimit = parseWinLimit(winLimitGiven, g.Source.Len(), g.Source.Len())
+
+	g.Wait = time.Duration(Settings.Speed["quiz"][0]) * time.Millisecond
+	g.Pause = time.Duration(Settings.Speed["quiz"][1]) * time.Millisecond
+
+	g.Run()
+}
+
+// Writes review decks as JSON to disk
+func writeReview() {
+	reviewWriter.Lock()
+	defer reviewWriter.Unlock()
+
+	Review.RLock()
+	if !Review.Persist {
+		Review.RUnlock()
+		return
+	}
+	b, err := json.Marshal(&Review)
+	Review.RUnlock()
+	if err != nil {
+		log.Println("ERROR, Could not marshal Review to json:", err)
+		return
+	}
+
+	if err = writeFileAtomic(REVIEW_FILE, b); err != nil {
+		log.Println("ERROR, Could not write Review file to disk:", err)
+	}
+}
+
+// Load review decks from JSON on disk
+func loadReview() {
+
+	Review.Lock()
+	defer Review.Unlock()
+
+	Review.Persist = true
+
+	file, err := ioutil.ReadFile(REVIEW_FILE)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("ERROR, Reading Review json:", err)
+		}
+		return
+	}
+
+	if err = json.Unmarshal(file, &Review); err != nil {
+		log.Println("ERROR, Unmarshalling Review json:", err)
+	}
+
+	// Make sure both maps are usable even with an old or partial file
+	if Review.ChannelID == nil {
+		Review.ChannelID = make(map[string]Quiz)
+	}
+	if Review.ChannelDeck == nil {
+		Review.ChannelDeck = make(map[string]string)
+	}
+	if Review.UserID == nil {
+		Review.UserID = make(map[string]map[string]Quiz)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMergeUserReviews(t *testing.T) {
+	kanji := Quiz{Description: "Kanji", Type: "image", LongVowels: true}
+	english := Quiz{Description: "English", Type: "image", Fuzzy: &FuzzyRules{Typos: 0.2}, Timeout: 30}
+
+	mergeUserReviews("kanji", kanji, map[string][]Card{"dave": {{Question: "猫", Answers: []string{"ねこ"}}}})
+	mergeUserReviews("english", english, map[string][]Card{"dave": {{Question: "猫", Answers: []string{"cat"}}}})
+	mergeUserReviews("kanji", kanji, map[string][]Card{"dave": {{Question: "猫", Answers: []string{"ねこ"}}, {Question: "犬", Answers: []string{"いぬ"}}}})
+
+	// Each deck keeps its own cards and rules
+	if diff := cmp.Diff(map[string]int{"kanji": 2, "english": 1}, userReviewSizes("dave")); diff != "" {
+		t.Errorf("Unexpected review decks (-want +got):\n%s", diff)
+	}
+	if review := getUserReview("dave", "kanji"); review.Fuzzy != nil || !review.LongVowels || review.Description != "Kanji" {
+		t.Errorf("Kanji reviews picked up other rules: %+v", review)
+	}
+	if review := getUserReview("dave", "english"); review.Fuzzy == nil || review.Timeout != 30 || review.Deck[0].Answers[0] != "cat" {
+		t.Errorf("English reviews lost their rules: %+v", review)
+	}
+
+	// Only the latest misses are kept
+	var missed []Card
+	for i := 0; i < REVIEW_DECK_LIMIT+10; i++ {
+		missed = append(missed, Card{Question: fmt.Sprint(i), Answers: []string{"a"}})
+	}
+	mergeUserReviews("english", english, map[string][]Card{"dave": missed})
+	review := getUserReview("dave", "english")
+	if len(review.Deck) != REVIEW_DECK_LIMIT || hasCard(review.Deck, "猫") || !hasCard(review.Deck, fmt.Sprint(REVIEW_DECK_LIMIT+9)) {
+		t.Errorf("Expected the %d latest cards, got %d", REVIEW_DECK_LIMIT, len(review.Deck))
+	}
+
+	// Reviewed decks go away once there's nothing left in them
+	putUserReview("dave", "english", Quiz{})
+	putUserReview("dave", "kanji", Quiz{})
+	if sizes := userReviewSizes("dave"); len(sizes) != 0 {
+		t.Errorf("Expected no review decks left, got %v", sizes)
+	}
+}
+
+func TestRunReviewDecks(t *testing.T) {
+	t.Parallel()
+
+	kanji := Quiz{Description: "Kanji", Type: "text"}
+	mergeUserReviews("kanji", kanji, map[string][]Card{"erin": {{Question: "猫", Answers: []string{"ねこ"}}}})
+	mergeUserReviews("kanji"+REVIEW_REVERSE_SUFFIX, kanji, map[string][]Card{"erin": {{Question: "cat", Answers: []string{"猫"}}}})
+	t.Cleanup(func() {
+		putUserReview("erin", "kanji", Quiz{})
+		putUserReview("erin", "kanji"+REVIEW_REVERSE_SUFFIX, Quiz{})
+	})
+
+	tests := []struct {
+		args     []string
+		deck     string
+		winLimit string
+	}{
+		{[]string{"kanji"}, "kanji", ""},
+		{[]string{"5", "kanji"}, "kanji", "5"},
+		{[]string{"kanji", "reverse", "5"}, "kanji" + REVIEW_REVERSE_SUFFIX, "5"},
+		{[]string{"kanji:reverse"}, "kanji" + REVIEW_REVERSE_SUFFIX, ""},
+		{nil, "", ""},
+	}
+	for _, test := range tests {
+		if deck, winLimit := parseReviewArgs(test.args); deck != test.deck || winLimit != test.winLimit {
+			t.Errorf("parseReviewArgs(%q) = %q, %q, expected %q, %q", test.args, deck, winLimit, test.deck, test.winLimit)
+		}
+	}
+
+	ft := newFakeTransport()
+	m := &discordgo.MessageCreate{Message: &discordgo.Message{ChannelID: "review decks", Author: &discordgo.User{ID: "erin"}}}
+
+	// Either deck has to be picked
+	runReview(ft, m, "", "")
+	if msg := ft.next(t); !strings.Contains(msg.Text, "kanji (1), kanji:reverse (1)") {
+		t.Errorf("Expected both review decks to be listed: %+v", msg)
+	}
+
+	// The reversed one can be picked by name
+	deck, winLimit := parseReviewArgs([]string{"kanji", "reverse"})
+	done := make(chan struct{})
+	go func() {
+		runReview(ft, m, deck, winLimit)
+		close(done)
+	}()
+	if msg := ft.next(t); !strings.Contains(msg.Text, "review") {
+		t.Errorf("Expected the review to start: %+v", msg)
+	}
+	Ongoing.Lock()
+	g := Ongoing.Games[m.ChannelID]
+	Ongoing.Unlock()
+	if g == nil || g.ReviewDeck != "kanji"+REVIEW_REVERSE_SUFFIX || g.Source.Rest()[0].Question != "cat" {
+		t.Error("Expected the reversed review deck to be played")
+	}
+
+	ft.say(m.ChannelID, "erin", "kq!stop")
+	for {
+		select {
+		case <-ft.sent:
+			continue
+		case <-done:
+		}
+		break
+	}
+}
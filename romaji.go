@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strings"
+)
+
+// Romaji syllables in Hepburn, Kunrei-shiki and wapuro spellings, as hiragana
+var romajiSyllables = map[string]string{
+	"a": "あ", "i": "い", "u": "う", "e": "え", "o": "お",
+	"ka": "か", "ki": "き", "ku": "く", "ke": "け", "ko": "こ",
+	"ga": "が", "gi": "ぎ", "gu": "ぐ", "ge": "げ", "go": "ご",
+	"sa": "さ", "si": "し", "shi": "し", "su": "す", "se": "せ", "so": "そ",
+	"za": "ざ", "zi": "じ", "ji": "じ", "zu": "ず", "ze": "ぜ", "zo": "ぞ",
+	"ta": "た", "ti": "ち", "chi": "ち", "tu": "つ", "tsu": "つ", "te": "て", "to": "と",
+	"da": "だ", "di": "ぢ", "du": "づ", "dzu": "づ", "de": "で", "do": "ど",
+	"na": "な", "ni": "に", "nu": "ぬ", "ne": "ね", "no": "の",
+	"ha": "は", "hi": "ひ", "hu": "ふ", "fu": "ふ", "he": "へ", "ho": "ほ",
+	"ba": "ば", "bi": "び", "bu": "ぶ", "be": "べ", "bo": "ぼ",
+	"pa": "ぱ", "pi": "ぴ", "pu": "ぷ", "pe": "ぺ", "po": "ぽ",
+	"ma": "ま", "mi": "み", "mu": "む", "me": "め", "mo": "も",
+	"ya": "や", "yu": "ゆ", "yo": "よ",
+	"ra": "ら", "ri": "り", "ru": "る", "re": "れ", "ro": "ろ",
+	"la": "ら", "li": "り", "lu": "る", "le": "れ", "lo": "ろ",
+	"wa": "わ", "wi": "ゐ", "we": "ゑ", "wo": "を",
+	"vu": "ゔ",
+
+	"kya": "きゃ", "kyu": "きゅ", "kyo": "きょ",
+	"gya": "ぎゃ", "gyu": "ぎゅ", "gyo": "ぎょ",
+	"sya": "しゃ", "syu": "しゅ", "syo": "しょ", "sha": "しゃ", "shu": "しゅ", "sho": "しょ", "she": "しぇ",
+	"zya": "じゃ", "zyu": "じゅ", "zyo": "じょ", "ja": "じゃ", "ju": "じゅ", "jo": "じょ", "je": "じぇ",
+	"jya": "じゃ", "jyu": "じゅ", "jyo": "じょ",
+	"tya": "ちゃ", "tyu": "ちゅ", "tyo": "ちょ", "cha": "ちゃ", "chu": "ちゅ", "cho": "ちょ", "che": "ちぇ",
+	"cya": "ちゃ", "cyu": "ちゅ", "cyo": "ちょ",
+	"dya": "ぢゃ", "dyu": "ぢゅ", "dyo": "ぢょ",
+	"nya": "にゃ", "nyu": "にゅ", "nyo": "にょ",
+	"hya": "ひゃ", "hyu": "ひゅ", "hyo": "ひょ",
+	"bya": "びゃ", "byu": "びゅ", "byo": "びょ",
+	"pya": "ぴゃ", "pyu": "ぴゅ", "pyo": "ぴょ",
+	"mya": "みゃ", "myu": "みゅ", "myo": "みょ",
+	"rya": "りゃ", "ryu": "りゅ", "ryo": "りょ",
+	"fa": "ふぁ", "fi": "ふぃ", "fe": "ふぇ", "fo": "ふぉ",
+	"va": "ゔぁ", "vi": "ゔぃ", "ve": "ゔぇ", "vo": "ゔぉ",
+	"thi": "てぃ", "dhi": "でぃ", "twu": "とぅ", "dwu": "どぅ",
+
+	"xa": "ぁ", "xi": "ぃ", "xu": "ぅ", "xe": "ぇ", "xo": "ぉ",
+	"xya": "ゃ", "xyu": "ゅ", "xyo": "ょ", "xtu": "っ", "xtsu": "っ", "xwa": "ゎ",
+	"lya": "ゃ", "lyu": "ゅ", "lyo": "ょ", "ltu": "っ", "ltsu": "っ", "lwa": "ゎ",
+	"-": "ー",
+}
+
+// Long vowels written with a macron (Hepburn) or circumflex (Kunrei), and the
+// ways each can be spelled out in kana
+var romajiLongVowels = map[rune][]string{
+	'ā': {"a", "aa"}, 'â': {"a", "aa"},
+	'ī': {"i", "ii"}, 'î': {"i", "ii"},
+	'ū': {"u", "uu"}, 'û': {"u", "uu"},
+	'ē': {"e", "ei", "ee"}, 'ê': {"e", "ei", "ee"},
+	'ō': {"o", "ou", "oo"}, 'ô': {"o", "ou", "oo"},
+}
+
+// Cap on spelled out variations of long vowels, to keep silly input cheap
+const ROMAJI_MAX_VARIANTS = 64
+
+// Longest romaji syllable in the table
+const ROMAJI_MAX_SYLLABLE = 4
+
+// Convert romaji to all the hiragana spellings it could stand for, or nothing
+// if it isn't romaji. Long vowels with a macron or circumflex can be written
+// with or without the doubled vowel, so each variant is tried
+func romajiToKana(s string) []string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) == 0 {
+		return nil
+	}
+
+	// Spell out long vowels first
+	variants := []string{""}
+	for _, r := range s {
+		spellings, long := romajiLongVowels[r]
+		if !long {
+			spellings = []string{string(r)}
+		}
+
+		var next []string
+		for _, v := range variants {
+			for _, spelling := range spellings {
+				if len(next) < ROMAJI_MAX_VARIANTS {
+					next = append(next, v+spelling)
+				}
+			}
+		}
+		variants = next
+	}
+
+	var result []string
+	for _, v := range variants {
+		if kana, ok := romajiVariantToKana(v); ok && !hasString(result, kana) {
+			result = append(result, kana)
+		}
+	}
+
+	return result
+}
+
+// Convert plain ASCII romaji to hiragana, returns false if it isn't romaji
+func romajiVariantToKana(s string) (string, bool) {
+	var kana strings.Builder
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		// Spaces and apostrophes only separate syllables
+		if c == ' ' || c == '\'' {
+			i++
+			continue
+		}
+
+		// Syllabic n, unless it starts a syllable of its own (na, ni, nya...),
+		// and m before b, m and p in traditional Hepburn
+		if c == 'n' && !startsRomajiSyllable(s, i+1) || c == 'm' && i+1 < len(s) && strings.IndexByte("bmp", s[i+1]) >= 0 {
+			kana.WriteString("ん")
+			i++
+
+			// Wapuro nn, as long as the second n doesn't start a syllable
+			if c == 'n' && i < len(s) && s[i] == 'n' && !startsRomajiSyllable(s, i+1) {
+				i++
+			}
+			continue
+		}
+
+		// Small tsu from a doubled consonant, or tch in Hepburn
+		if i+1 < len(s) && isRomajiConsonant(c) && (s[i+1] == c || c == 't' && s[i+1] == 'c') {
+			kana.WriteString("っ")
+			i++
+			continue
+		}
+
+		// Longest matching syllable
+		matched := false
+		for l := minint(ROMAJI_MAX_SYLLABLE, len(s)-i); l > 0; l-- {
+			if syllable, ok := romajiSyllables[s[i:i+l]]; ok {
+				kana.WriteString(syllable)
+				i += l
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return "", false
+		}
+	}
+
+	return kana.String(), true
+}
+
+// Check whether an n followed by the character at i starts a syllable
+func startsRomajiSyllable(s string, i int) bool {
+	return i < len(s) && strings.IndexByte("aiueoy", s[i]) >= 0
+}
+
+// Check whether a character is a consonant that can be doubled into a small tsu
+func isRomajiConsonant(c byte) bool {
+	return c >= 'a' && c <= 'z' && strings.IndexByte("aiueon", c) < 0
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRomajiToKana(t *testing.T) {
+	tests := []struct {
+		romaji string
+		kana   string
+	}{
+		{"sushi", "すし"},
+		{"susi", "すし"},
+		{"tsukue", "つくえ"},
+		{"tukue", "つくえ"},
+		{"chikatetsu", "ちかてつ"},
+		{"tikatetu", "ちかてつ"},
+		{"fuji", "ふじ"},
+		{"huzi", "ふじ"},
+		{"kitte", "きって"},
+		{"matcha", "まっちゃ"},
+		{"zasshi", "ざっし"},
+		{"kon'ya", "こんや"},
+		{"konya", "こにゃ"},
+		{"kan'i", "かんい"},
+		{"konnichiha", "こんにちは"},
+		{"konnnichiha", "こんにちは"},
+		{"onna", "おんな"},
+		{"hon", "ほん"},
+		{"shimbun", "しんぶん"},
+		{"tōkyō", "とうきょう"},
+		{"tôkyô", "とうきょう"},
+		{"toukyou", "とうきょう"},
+		{"ōkii", "おおきい"},
+		{"obāsan", "おばあさん"},
+		{"ko-hi-", "こーひー"},
+		{"KYOU", "きょう"},
+		{"jisho", "じしょ"},
+		{"zisyo", "じしょ"},
+		{"wo", "を"},
+	}
+
+	for _, test := range tests {
+		kana := romajiToKana(test.romaji)
+		if !hasString(kana, test.kana) {
+			t.Errorf("romajiToKana(%q) = %q, expected %q among them", test.romaji, kana, test.kana)
+		}
+	}
+
+	// Not romaji at all
+	for _, s := range []string{"", "きょう", "q", "xyz", "3"} {
+		if kana := romajiToKana(s); len(kana) != 0 {
+			t.Errorf("romajiToKana(%q) = %q, expected nothing", s, kana)
+		}
+	}
+}
+
+func TestReadingJudgeRomaji(t *testing.T) {
+	card := Card{Question: "東京", Answers: []string{"トウキョウ"}}
+
+	if key, ok := (readingJudge{romaji: true}).Judge(card, "Tōkyō"); !ok || key != "とうきょう" {
+		t.Errorf("Romaji answer should be accepted: %q %t", key, ok)
+	}
+
+	if _, ok := (readingJudge{}).Judge(card, "toukyou"); ok {
+		t.Error("Romaji answer should only be accepted when enabled")
+	}
+}
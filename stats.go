@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Filename for persisted player statistics
+const STATS_FILE = "stats.json"
+
+// Long-term results of a player on a single deck
+type DeckStats struct {
+	Answered     int     `json:"answered"`                // Questions answered correctly
+	First        int     `json:"first"`                   // Questions answered correctly first
+	Games        int     `json:"games"`                   // Games scored in
+	Wins         int     `json:"wins"`                    // Games won
+	Gauntlets    int     `json:"gauntlets,omitempty"`     // Ranked gauntlets run
+	GauntletBest float64 `json:"gauntlet_best,omitempty"` // Best ranked gauntlet score
+}
+
+// Stats keeps track of every player's results per deck
+var Stats struct {
+	sync.RWMutex
+	Users   map[string]map[string]*DeckStats // User ID -> deck name -> results
+	Persist bool                             // Whether statistics are kept on disk
+}
+
+// Serializes writes of the stats file
+var statsWriter sync.Mutex
+
+// Add the results of a finished game to the players' statistics, whatever
+// the quiz mode
+// Review decks and combined decks are left out since their cards come from
+// other decks, study sessions since they're not played to score, local games
+// in a terminal since they have no real players, and only ranked gauntlets
+// count towards gauntlet bests so that they stay comparable
+func recordStats(g *Game) {
+	if g.Reviewing || len(g.ReviewUser) > 0 || isDeckExpr(g.Name) || isTerminal(g.Transport) {
+		return
+	}
+	if _, studying := g.Source.(*studySource); studying {
+		return
+	}
+
+	deck := strings.ToLower(g.Name)
+	winners := g.Winners()
+
+	Stats.Lock()
+	if Stats.Users == nil {
+		Stats.Users = make(map[string]map[string]*DeckStats)
+	}
+
+	for player := range g.Players {
+		if Stats.Users[player] == nil {
+			Stats.Users[player] = make(map[string]*DeckStats)
+		}
+		ds := Stats.Users[player][deck]
+		if ds == nil {
+			ds = &DeckStats{}
+			Stats.Users[player][deck] = ds
+		}
+
+		ds.Answered += g.Correct[player]
+		ds.First += g.Firsts[player]
+		ds.Games++
+		if hasString(winners, player) {
+			ds.Wins++
+		}
+
+		if g.Timed && g.Ranked {
+			ds.Gauntlets++
+			if score := gauntletScore(g.Correct[player], g.Answered); score > ds.GauntletBest {
+				ds.GauntletBest = score
+			}
+		}
+	}
+	Stats.Unlock()
+
+	writeStats()
+}
+
+// Returns a copy of a player's statistics for every deck
+func getStats(userID string) map[string]DeckStats {
+	result := make(map[string]DeckStats)
+
+	Stats.RLock()
+	for deck, ds := range Stats.Users[userID] {
+		result[deck] = *ds
+	}
+	Stats.RUnlock()
+
+	return result
+}
+
+// Writes player statistics as JSON to disk
+func writeStats() {
+	statsWriter.Lock()
+	defer statsWriter.Unlock()
+
+	Stats.RLock()
+	if !Stats.Persist {
+		Stats.RUnlock()
+		return
+	}
+	b, err := json.Marshal(Stats.Users)
+	Stats.RUnlock()
+	if err != nil {
+		log.Println("ERROR, Could not marshal Stats to json:", err)
+		return
+	}
+
+	if err = writeFileAtomic(STATS_FILE, b); err != nil {
+		log.Println("ERROR, Could not write Stats file to disk:", err)
+	}
+}
+
+// Load player statistics from JSON on disk
+func loadStats() {
+
+	Stats.Lock()
+	defer Stats.Unlock()
+
+	Stats.Users = make(map[string]map[string]*DeckStats)
+	Stats.Persist = true
+
+	file, err := ioutil.ReadFile(STATS_FILE)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("ERROR, Reading Stats json:", err)
+		}
+		return
+	}
+
+	if err = json.Unmarshal(file, &Stats.Users); err != nil {
+		log.Println("ERROR, Unmarshalling Stats json:", err)
+	}
+}
+
+// Write a file by renaming a finished temporary copy over it, so that
+// readers never see half-written data
+func writeFileAtomic(filename string, data []byte) error {
+	tmp := filename + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filename)
+}
+
+// Show a player's statistics, for all decks or only the given one
+func showStats(s *discordgo.Session, m *discordgo.MessageCreate, input []string) (sent *discordgo.Message) {
+
+	user := m.Author
+	if len(m.Mentions) > 0 {
+		user = m.Mentions[0]
+	}
+
+	// Any argument that isn't a mention is the deck
+	var deck string
+	for _, arg := range input[1:] {
+		if !strings.HasPrefix(arg, "<@") {
+			deck = arg
+		}
+	}
+
+	stats := getStats(user.ID)
+	var fields []*discordgo.MessageEmbedField
+	var description string
+
+	if len(deck) > 0 {
+		ds, ok := stats[deck]
+		if !ok {
+			return msgSend(s, m.ChannelID, fmt.Sprintf("No results on `%s` for %s yet!", deck, user.Username))
+		}
+
+		description = "Deck: " + deck
+		fields = append(fields,
+			&discordgo.MessageEmbedField{Name: "Answered", Value: fmt.Sprint(ds.Answered), Inline: true},
+			&discordgo.MessageEmbedField{Name: "First", Value: fmt.Sprint(ds.First), Inline: true},
+			&discordgo.MessageEmbedField{Name: "Games won", Value: fmt.Sprintf("%d/%d", ds.Wins, ds.Games), Inline: true},
+		)
+		if ds.Gauntlets > 0 {
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:   "Gauntlet best",
+				Value:  fmt.Sprintf("%.2f (%d runs)", ds.GauntletBest, ds.Gauntlets),
+				Inline: true,
+			})
+		}
+	} else {
+		if len(stats) == 0 {
+			return msgSend(s, m.ChannelID, fmt.Sprintf("No results for %s yet!", user.Username))
+		}
+
+		// Most played decks first
+		var decks []string
+		var total DeckStats
+		for name, ds := range stats {
+			decks = append(decks, name)
+			total.Answered += ds.Answered
+			total.First += ds.First
+			total.Games += ds.Games
+			total.Wins += ds.Wins
+		}
+		sort.Slice(decks, func(i, j int) bool {
+			if stats[decks[i]].Answered != stats[decks[j]].Answered {
+				return stats[decks[i]].Answered > stats[decks[j]].Answered
+			}
+			return decks[i] < decks[j]
+		})
+
+		description = fmt.Sprintf("%d answered, %d first, %d/%d games won", total.Answered, total.First, total.Wins, total.Games)
+
+		// Stay well within Discord's field limit
+		for _, name := range decks[:minint(len(decks), 20)] {
+			ds := stats[name]
+			value := fmt.Sprintf("%d answered, %d first, %d/%d games won", ds.Answered, ds.First, ds.Wins, ds.Games)
+			if ds.Gauntlets > 0 {
+				value += fmt.Sprintf("\nGauntlet best: %.2f", ds.GauntletBest)
+			}
+
+			fields = append(fields, &discordgo.MessageEmbedField{
+				Name:   name,
+				Value:  value,
+				Inline: true,
+			})
+		}
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Type:        "rich",
+		Title:       ":bar_chart: Quiz Statistics: " + user.Username,
+		Color:       0xFADE40,
+		Description: description,
+		Fields:      fields,
+	}
+
+	return embedSend(s, m.ChannelID, embed)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRecordStats(t *testing.T) {
+	Stats.Lock()
+	saved := Stats.Users
+	Stats.Users = nil
+	Stats.Unlock()
+	t.Cleanup(func() {
+		Stats.Lock()
+		Stats.Users = saved
+		Stats.Unlock()
+	})
+
+	// A quiz won by alice, with bob getting one question first
+	ft := newFakeTransport()
+	g := newTestGame(t, ft, "stats", "StatsDeck")
+	g.Timeout = 5 * time.Second
+	g.WinLimit = 2
+	done := runTestGame(g)
+
+	ft.next(t)
+	for _, answer := range []struct{ player, text string }{{"bob", "サン"}, {"alice", "ふた"}, {"alice", "いち"}} {
+		ft.next(t)
+		ft.say("stats", answer.player, answer.text)
+		ft.next(t)
+	}
+	ft.next(t)
+	<-done
+
+	expected := map[string]DeckStats{"statsdeck": {Answered: 2, First: 2, Games: 1, Wins: 1}}
+	if diff := cmp.Diff(expected, getStats("alice")); diff != "" {
+		t.Errorf("Unexpected stats for alice (-want +got):\n%s", diff)
+	}
+	expected = map[string]DeckStats{"statsdeck": {Answered: 1, First: 1, Games: 1}}
+	if diff := cmp.Diff(expected, getStats("bob")); diff != "" {
+		t.Errorf("Unexpected stats for bob (-want +got):\n%s", diff)
+	}
+
+	// Ranked gauntlets set bests, while unranked ones still count answers
+	gauntlet := &Game{Name: "StatsDeck", Timed: true, Ranked: true, Players: map[string]int{"bob": 3}, Correct: map[string]int{"bob": 3}, Answered: 4}
+	recordStats(gauntlet)
+	custom := &Game{Name: "StatsDeck", Timed: true, Players: map[string]int{"bob": 5}, Correct: map[string]int{"bob": 5}, Answered: 5}
+	recordStats(custom)
+
+	expected = map[string]DeckStats{"statsdeck": {Answered: 9, First: 1, Games: 3, Gauntlets: 1, GauntletBest: gauntletScore(3, 4)}}
+	if diff := cmp.Diff(expected, getStats("bob")); diff != "" {
+		t.Errorf("Unexpected stats after gauntlets (-want +got):\n%s", diff)
+	}
+
+	// Review decks, combined decks and study sessions don't count for any deck
+	recordStats(&Game{Name: "review", Reviewing: true, Players: map[string]int{"carol": 1}, Correct: map[string]int{"carol": 1}})
+	recordStats(&Game{Name: "n5+n4", Players: map[string]int{"carol": 1}, Correct: map[string]int{"carol": 1}})
+	recordStats(&Game{Name: "jouyou[grade<=3]", Players: map[string]int{"carol": 1}, Correct: map[string]int{"carol": 1}})
+	recordStats(&Game{Name: "n5", Source: &studySource{}, Timed: true, Players: map[string]int{"carol": 1}, Correct: map[string]int{"carol": 1}})
+	if stats := getStats("carol"); len(stats) != 0 {
+		t.Errorf("Expected no stats from reviews, combined decks or studying, got %v", stats)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Filename for persisted study schedules
+const STUDY_FILE = "study.json"
+
+// Time to wait for an answer before giving up on a study session
+const STUDY_IDLE_TIMEOUT = 10 * time.Minute
+
+// Spaced repetition schedule of a single card for a player (SM-2)
+type StudyCard struct {
+	Interval int       `json:"interval"` // Days until the next review
+	Ease     float64   `json:"ease"`     // Interval multiplier
+	Reps     int       `json:"reps"`     // Correct reviews in a row
+	Due      time.Time `json:"due"`
+}
+
+// Study keeps track of every player's study schedules per deck
+var Study struct {
+	sync.RWMutex
+	Users   map[string]map[string]map[string]*StudyCard // User ID -> deck name -> question -> schedule
+	Persist bool                                        // Whether schedules are kept on disk
+}
+
+// Serializes writes of the study file
+var studyWriter sync.Mutex
+
+// Update a card's schedule after a review, using SM-2 with a fixed grade for
+// correct (4) and wrong (1) answers
+func (sc *StudyCard) Review(correct bool, now time.Time) {
+	quality := 1.0
+	if correct {
+		quality = 4
+	}
+
+	if correct {
+		switch sc.Reps {
+		case 0:
+			sc.Interval = 1
+		case 1:
+			sc.Interval = 6
+		default:
+			sc.Interval = int(math.Round(float64(sc.Interval) * sc.Ease))
+		}
+		sc.Reps++
+	} else {
+		sc.Reps = 0
+		sc.Interval = 1
+	}
+
+	sc.Ease += 0.1 - (5-quality)*(0.08+(5-quality)*0.02)
+	if sc.Ease < 1.3 {
+		sc.Ease = 1.3
+	}
+
+	sc.Due = now.AddDate(0, 0, sc.Interval)
+}
+
+// Cards for a study session, due ones first and then new ones
+type studySource struct {
+	deckSource
+	user    string
+	deck    string
+	due     int // Number of due cards at the start
+	fresh   int // Number of new cards at the start
+	correct int
+}
+
+// Put together a study session for a player on a deck
+func newStudySource(user string, deck string, quiz Quiz, newLimit int) *studySource {
+	now := time.Now()
+
+	Study.RLock()
+	schedule := Study.Users[user][deck]
+
+	var due, fresh []Card
+	for _, card := range quiz.Deck {
+		sc, seen := schedule[card.Question]
+		if !seen {
+			if len(fresh) < newLimit {
+				fresh = append(fresh, card)
+			}
+		} else if !sc.Due.After(now) {
+			due = append(due, card)
+		}
+	}
+
+	// Most overdue first
+	sort.SliceStable(due, func(i, j int) bool {
+		return schedule[due[i].Question].Due.Before(schedule[due[j].Question].Due)
+	})
+	Study.RUnlock()
+
+	return &studySource{
+		deckSource: deckSource{deck: append(due, fresh...), sequential: true},
+		user:       user,
+		deck:       deck,
+		due:        len(due),
+		fresh:      len(fresh),
+	}
+}
+
+func (src *studySource) Record(card Card, correct bool) {
+	if correct {
+		src.correct++
+	}
+
+	Study.Lock()
+	if Study.Users == nil {
+		Study.Users = make(map[string]map[string]map[string]*StudyCard)
+	}
+	if Study.Users[src.user] == nil {
+		Study.Users[src.user] = make(map[string]map[string]*StudyCard)
+	}
+	if Study.Users[src.user][src.deck] == nil {
+		Study.Users[src.user][src.deck] = make(map[string]*StudyCard)
+	}
+	sc := Study.Users[src.user][src.deck][card.Question]
+	if sc == nil {
+		sc = &StudyCard{Ease: 2.5}
+		Study.Users[src.user][src.deck][card.Question] = sc
+	}
+	sc.Review(correct, time.Now())
+	Study.Unlock()
+}
+
+// Days until a card is due again for the studying player
+func (src *studySource) interval(card Card) int {
+	Study.RLock()
+	defer Study.RUnlock()
+
+	if sc := Study.Users[src.user][src.deck][card.Question]; sc != nil {
+		return sc.Interval
+	}
+
+	return 0
+}
+
+// Number of the player's cards in the deck due by the given time
+func (src *studySource) dueBy(t time.Time) (count int) {
+	Study.RLock()
+	for _, sc := range Study.Users[src.user][src.deck] {
+		if !sc.Due.After(t) {
+			count++
+		}
+	}
+	Study.RUnlock()
+
+	return count
+}
+
+// Study session presentation with feedback after every answer
+type studyRenderer struct {
+	quizRenderer
+	src *studySource
+}
+
+func (sr studyRenderer) Start(g *Game) {
+	g.Transport.Send(g.Channel, fmt.Sprintf("```Starting %s study session:\n\"%s\"\n%d due and %d new card(s). Type %sstop to finish early.```", g.Name, g.Quiz.Description, sr.src.due, sr.src.fresh, g.Prefix))
+}
+
+func (sr studyRenderer) Correct(g *Game, r *Round) {
+	g.Transport.SendEmbed(g.Channel, roundEmbed(
+		fmt.Sprintf(UNICODE_CHECK_MARK+" Correct: %s", g.questionTitle(r.Card)),
+		0x22AA22,
+		r.Card,
+		append(matchedFields(r), &discordgo.MessageEmbedField{
+			Name:   "Next review",
+			Value:  fmt.Sprintf("In %d day(s)", sr.src.interval(r.Card)),
+			Inline: false,
+		})...,
+	))
+}
+
+func (sr studyRenderer) TimedOut(g *Game, r *Round) {
+	g.Transport.SendEmbed(g.Channel, roundEmbed(
+		fmt.Sprintf(UNICODE_NO_ENTRY+" Wrong: %s", g.questionTitle(r.Card)),
+		0xAA2222,
+		r.Card,
+		&discordgo.MessageEmbedField{
+			Name:   "Next review",
+			Value:  "Tomorrow",
+			Inline: false,
+		},
+	))
+}
+
+func (sr studyRenderer) Finish(g *Game) {
+	embed := &discordgo.MessageEmbed{
+		Type:        "rich",
+		Title:       "Study Session: " + g.Name,
+		Description: fmt.Sprintf("%d/%d correct, %d card(s) due by tomorrow", sr.src.correct, g.Answered, sr.src.dueBy(time.Now().AddDate(0, 0, 1))),
+		Color:       0x33FF33,
+	}
+
+	if len(g.History) > 0 {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: "Mistakes: " + truncate(strings.Join(g.History, "　"), 2000)}
+	}
+
+	g.Transport.SendEmbed(g.Channel, embed)
+}
+
+// Run a private spaced repetition study session
+func runStudy(t Transport, m *discordgo.MessageCreate, quizname string, newLimitGiven string) {
+
+	// Only react in private messages
+	if len(m.GuildID) != 0 {
+		// Not a private channel
+		t.Send(m.ChannelID, fmt.Sprintf(UNICODE_NO_ENTRY_SIGN+" Game mode `%sstudy` is only for DM!", guildPrefix(m.GuildID)))
+		return
+	}
+
+	newLimit := 10 // new cards per session
+
+	// Parse provided new card limit with sane defaults
+	if i, err := strconv.Atoi(newLimitGiven); err == nil {
+		if i > 50 {
+			newLimit = 50
+		} else if i >= 0 {
+			newLimit = i
+		}
+	}
+
+	// Mark the quiz as started
+	if err := startQuiz(t, m.ChannelID); err != nil {
+		// Quiz already running, nothing to do here
+		return
+	}
+
+	if isDeckDisabled(t.ChannelGuild(m.ChannelID), quizname) {
+		t.Send(m.ChannelID, "Quiz is disabled on this server: "+quizname)
+		stopQuiz(t, m.ChannelID)
+		return
+	}
+
+	// New cards follow the deck's order, to work through decks like kklc
+	quiz := LoadQuiz(quizname, false)
+	if len(quiz.Deck) == 0 {
+		t.Send(m.ChannelID, "Failed to find valid quiz: "+quizname)
+		stopQuiz(t, m.ChannelID)
+		return
+	}
+
+	src := newStudySource(m.Author.ID, quizname, quiz, newLimit)
+	if src.Len() == 0 {
+		t.Send(m.ChannelID, fmt.Sprintf("Nothing to study in %s right now, come back later!", quizname))
+		stopQuiz(t, m.ChannelID)
+		return
+	}
+
+	g := newGame(t, m.ChannelID, quizname, quiz)
+	g.Starter = m.Author.ID
+	g.Source = src
+	g.Render = studyRenderer{src: src}
+	g.Timed = true
+	g.Timeout = 0                      // sessions last as long as there are cards
+	g.IdleTimeout = STUDY_IDLE_TIMEOUT // give up on forgotten sessions
+	g.Pause = 2 * time.Second
+	g.WinLimit = 0
+	g.Review = false
+	g.Ranked = false
+
+	g.Run()
+
+	// Schedules are written once per session rather than after every answer
+	writeStudy()
+}
+
+// Writes study schedules as JSON to disk
+func writeStudy() {
+	studyWriter.Lock()
+	defer studyWriter.Unlock()
+
+	Study.RLock()
+	if !Study.Persist {
+		Study.RUnlock()
+		return
+	}
+	b, err := json.Marshal(Study.Users)
+	Study.RUnlock()
+	if err != nil {
+		log.Println("ERROR, Could not marshal Study to json:", err)
+		return
+	}
+
+	if err = writeFileAtomic(STUDY_FILE, b); err != nil {
+		log.Println("ERROR, Could not write Study file to disk:", err)
+	}
+}
+
+// Load study schedules from JSON on disk
+func loadStudy() {
+
+	Study.Lock()
+	defer Study.Unlock()
+
+	Study.Users = make(map[string]map[string]map[string]*StudyCard)
+	Study.Persist = true
+
+	file, err := ioutil.ReadFile(STUDY_FILE)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("ERROR, Reading Study json:", err)
+		}
+		return
+	}
+
+	if err = json.Unmarshal(file, &Study.Users); err != nil {
+		log.Println("ERROR, Unmarshalling Study json:", err)
+	}
+}
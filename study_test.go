@@ -0,0 +1,160 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestStudyCardReview(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		card     StudyCard
+		correct  bool
+		expected StudyCard
+	}{
+		{"first", StudyCard{Ease: 2.5}, true, StudyCard{Interval: 1, Ease: 2.5, Reps: 1}},
+		{"second", StudyCard{Interval: 1, Ease: 2.5, Reps: 1}, true, StudyCard{Interval: 6, Ease: 2.5, Reps: 2}},
+		{"third", StudyCard{Interval: 6, Ease: 2.5, Reps: 2}, true, StudyCard{Interval: 15, Ease: 2.5, Reps: 3}},
+		{"rounded", StudyCard{Interval: 7, Ease: 1.3, Reps: 5}, true, StudyCard{Interval: 9, Ease: 1.3, Reps: 6}},
+		{"wrong", StudyCard{Interval: 20, Ease: 2.5, Reps: 4}, false, StudyCard{Interval: 1, Ease: 1.96, Reps: 0}},
+		{"ease floor", StudyCard{Interval: 1, Ease: 1.5, Reps: 0}, false, StudyCard{Interval: 1, Ease: 1.3, Reps: 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			card := test.card
+			card.Review(test.correct, now)
+
+			test.expected.Due = now.AddDate(0, 0, test.expected.Interval)
+			if diff := cmp.Diff(test.expected, card, cmpopts.EquateApprox(0, 1e-9)); diff != "" {
+				t.Errorf("Unexpected schedule (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewStudySource(t *testing.T) {
+	now := time.Now()
+
+	Study.Lock()
+	saved := Study.Users
+	Study.Users = map[string]map[string]map[string]*StudyCard{
+		"erin": {"n5": {
+			"a": {Interval: 1, Ease: 2.5, Reps: 1, Due: now.AddDate(0, 0, -2)},
+			"b": {Interval: 6, Ease: 2.5, Reps: 2, Due: now.AddDate(0, 0, -5)},
+			"c": {Interval: 6, Ease: 2.5, Reps: 2, Due: now.AddDate(0, 0, 1)},
+		}},
+	}
+	Study.Unlock()
+	t.Cleanup(func() {
+		Study.Lock()
+		Study.Users = saved
+		Study.Unlock()
+	})
+
+	quiz := Quiz{Deck: []Card{{Question: "a"}, {Question: "b"}, {Question: "c"}, {Question: "d"}, {Question: "e"}, {Question: "f"}}}
+	src := newStudySource("erin", "n5", quiz, 2)
+
+	// Most overdue first, then as many new cards as allowed
+	var order []string
+	for _, card := range src.Rest() {
+		order = append(order, card.Question)
+	}
+	if diff := cmp.Diff([]string{"b", "a", "d", "e"}, order); diff != "" {
+		t.Errorf("Unexpected study order (-want +got):\n%s", diff)
+	}
+	if src.due != 2 || src.fresh != 2 {
+		t.Errorf("Expected 2 due and 2 new cards, got %d and %d", src.due, src.fresh)
+	}
+
+	// Answers update the schedule without touching the disk
+	src.Record(Card{Question: "d"}, true)
+	if src.interval(Card{Question: "d"}) != 1 || src.correct != 1 {
+		t.Error("Expected d to be scheduled for tomorrow")
+	}
+
+	// Players without a schedule start with new cards only
+	if src := newStudySource("frank", "n5", quiz, 10); src.Len() != 6 || src.due != 0 {
+		t.Errorf("Expected the whole deck as new cards, got %d", src.Len())
+	}
+}
+
+func TestRunStudyOrder(t *testing.T) {
+	t.Parallel()
+	loadQuizList()
+
+	ft := newFakeTransport()
+	m := &discordgo.MessageCreate{Message: &discordgo.Message{ChannelID: "study order", Author: &discordgo.User{ID: "gina"}}}
+
+	done := make(chan struct{})
+	go func() {
+		runStudy(ft, m, "n5", "5")
+		close(done)
+	}()
+
+	if msg := ft.next(t); !strings.Contains(msg.Text, "0 due and 5 new") {
+		t.Errorf("Expected the study session to start: %+v", msg)
+	}
+
+	// New cards come in deck order
+	var expected, order []string
+	for _, card := range LoadQuiz("n5", false).Deck[:5] {
+		expected = append(expected, card.Question)
+	}
+	Ongoing.Lock()
+	g := Ongoing.Games[m.ChannelID]
+	Ongoing.Unlock()
+	if g != nil {
+		for _, card := range g.Source.Rest() {
+			order = append(order, card.Question)
+		}
+	}
+	if diff := cmp.Diff(expected, order); diff != "" {
+		t.Errorf("Unexpected study order (-want +got):\n%s", diff)
+	}
+
+	ft.say(m.ChannelID, "gina", "kq!stop")
+	for {
+		select {
+		case <-ft.sent:
+			continue
+		case <-done:
+		}
+		break
+	}
+}
+
+// Transport with every channel in the given guild
+type guildTransport struct {
+	*fakeTransport
+	guild string
+}
+
+func (gt guildTransport) ChannelGuild(cid string) string {
+	return gt.guild
+}
+
+func TestRunStudyDisabled(t *testing.T) {
+	withGuilds(t, map[string]*GuildConfig{"g1": {Disabled: []string{"n5"}}})
+
+	gt := guildTransport{newFakeTransport(), "g1"}
+	m := &discordgo.MessageCreate{Message: &discordgo.Message{ChannelID: "study disabled", Author: &discordgo.User{ID: "gina"}}}
+
+	runStudy(gt, m, "n5", "")
+	if msg := gt.next(t); msg.Text != "Quiz is disabled on this server: n5" {
+		t.Errorf("Expected n5 to be disabled: %+v", msg)
+	}
+	Ongoing.RLock()
+	started := Ongoing.ChannelID[m.ChannelID]
+	Ongoing.RUnlock()
+	if started {
+		t.Error("Expected the channel to be free again")
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Channel and user IDs used when playing in a terminal
+const TERMINAL_CHANNEL = "terminal"
+const TERMINAL_PLAYER = "player"
+
+// Transport playing games in a terminal, reading answers line by line
+type terminalTransport struct {
+	sync.Mutex
+	out      io.Writer
+	imageDir string // Folder to write question images to, if any
+	images   int
+	handler  func(m *discordgo.MessageCreate)
+}
+
+// Strip Discord markup that doesn't make sense in a terminal
+var terminalReplacer = strings.NewReplacer(
+	"```\n", "",
+	"```", "",
+	"**", "",
+	"<@"+TERMINAL_PLAYER+">", "You",
+)
+
+// Create a terminal transport, reading answers from in until it's exhausted
+func newTerminalTransport(in io.Reader, out io.Writer, imageDir string) *terminalTransport {
+	tt := &terminalTransport{out: out, imageDir: imageDir}
+
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			tt.Lock()
+			handler := tt.handler
+			tt.Unlock()
+
+			if handler != nil {
+				handler(&discordgo.MessageCreate{Message: &discordgo.Message{
+					ChannelID: TERMINAL_CHANNEL,
+					Content:   strings.TrimSpace(scanner.Text()),
+					Author:    &discordgo.User{ID: TERMINAL_PLAYER, Username: TERMINAL_PLAYER},
+				}})
+			}
+		}
+	}()
+
+	return tt
+}
+
+// Check whether games are played locally in a terminal, where there's nobody
+// to rank or keep statistics for
+func isTerminal(t Transport) bool {
+	_, local := t.(*terminalTransport)
+	return local
+}
+
+func (tt *terminalTransport) Send(cid string, msg string) *discordgo.Message {
+	fmt.Fprintln(tt.out, terminalReplacer.Replace(msg))
+	return &discordgo.Message{ChannelID: cid, Content: msg}
+}
+
+func (tt *terminalTransport) SendImage(cid string, text string, opts RenderOptions) *discordgo.Message {
+	fmt.Fprintf(tt.out, "[ %s ]\n", text)
+
+	// Write out the image as it would have been sent to Discord
+	if len(tt.imageDir) > 0 {
+		tt.Lock()
+		tt.images++
+		filename := filepath.Join(tt.imageDir, fmt.Sprintf("question%03d.png", tt.images))
+		tt.Unlock()
+
+		if image := Images.Get(text, opts); image != nil {
+			if err := ioutil.WriteFile(filename, image, 0644); err != nil {
+				log.Println("ERROR, Could not write image:", err)
+			} else {
+				fmt.Fprintln(tt.out, "Image:", filename)
+			}
+		}
+	}
+
+	return &discordgo.Message{ChannelID: cid}
+}
+
+func (tt *terminalTransport) SendFile(cid string, path string) *discordgo.Message {
+	fmt.Fprintf(tt.out, "[ %s ]\n", path)
+	return &discordgo.Message{ChannelID: cid}
+}
+
+func (tt *terminalTransport) SendChoices(cid string, choices []string) *discordgo.Message {
+	fmt.Fprintln(tt.out, choiceList(choices))
+	return &discordgo.Message{ChannelID: cid}
+}
+
+func (tt *terminalTransport) SendEmbed(cid string, embed *discordgo.MessageEmbed) *discordgo.Message {
+	var lines []string
+
+	lines = append(lines, "== "+embed.Title+" ==")
+	if len(embed.Description) > 0 {
+		lines = append(lines, embed.Description)
+	}
+	for _, field := range embed.Fields {
+		lines = append(lines, field.Name+":", "  "+strings.Replace(strings.TrimSpace(field.Value), "\n", "\n  ", -1))
+	}
+	if embed.Footer != nil && len(embed.Footer.Text) > 0 {
+		lines = append(lines, "-- "+embed.Footer.Text)
+	}
+
+	fmt.Fprintln(tt.out, terminalReplacer.Replace(strings.Join(lines, "\n")))
+
+	return &discordgo.Message{ChannelID: cid}
+}
+
+func (tt *terminalTransport) Subscribe(cid string, handler func(m *discordgo.MessageCreate)) func() {
+	tt.Lock()
+	tt.handler = handler
+	tt.Unlock()
+
+	return func() {
+		tt.Lock()
+		tt.handler = nil
+		tt.Unlock()
+	}
+}
+
+func (tt *terminalTransport) SetStatus(status string) {}
+
+func (tt *terminalTransport) ChannelGuild(cid string) string {
+	return ""
+}
+
+func (tt *terminalTransport) IsMember(guildID, userID string) bool {
+	return false
+}
+
+// Whoever's at the terminal runs the show
+func (tt *terminalTransport) Permission(cid, userID string) Permission {
+	return PERM_ADMIN
+}
+
+// Play a deck locally in the terminal with the given game mode
+func playTerminal(quizname string, mode string, imageDir string, opts GameOptions) error {
+
+	if err := loadQuizList(); err != nil {
+		return err
+	}
+
+	// Kanji info is needed for deck filters like jouyou[grade<=3]
+	loadAllKanji()
+
+	// Images are only drawn when they're written out
+	if len(imageDir) > 0 {
+		if err := os.MkdirAll(imageDir, 0755); err != nil {
+			return err
+		}
+		loadFont()
+	}
+
+	tt := newTerminalTransport(os.Stdin, os.Stdout, imageDir)
+
+	switch mode {
+	case "gauntlet":
+		runGauntlet(tt, &discordgo.MessageCreate{Message: &discordgo.Message{
+			ChannelID: TERMINAL_CHANNEL,
+			Author:    &discordgo.User{ID: TERMINAL_PLAYER, Username: TERMINAL_PLAYER},
+		}}, quizname, "", opts)
+	case "multi":
+		runMultiQuiz(tt, TERMINAL_CHANNEL, TERMINAL_PLAYER, quizname, "", Settings.Speed[mode][0], Settings.Speed[mode][1], opts)
+	case "choice":
+		runChoiceQuiz(tt, TERMINAL_CHANNEL, TERMINAL_PLAYER, quizname, "", Settings.Speed[mode][0], Settings.Speed[mode][1], opts)
+	default:
+		speed, ok := Settings.Speed[mode]
+		if !ok {
+			return fmt.Errorf("Unknown game mode: %s", mode)
+		}
+		runQuiz(tt, TERMINAL_CHANNEL, TERMINAL_PLAYER, quizname, "", speed[0], speed[1], opts)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Question lines as printed for the test deck
+var terminalQuestion = regexp.MustCompile(`^q\d\n$`)
+
+// Terminal output that lets the player answer once a question is asked
+type terminalScreen struct {
+	sync.Mutex
+	buf   bytes.Buffer
+	asked chan struct{}
+}
+
+func (ts *terminalScreen) Write(p []byte) (int, error) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	if terminalQuestion.Match(p) {
+		ts.asked <- struct{}{}
+	}
+
+	return ts.buf.Write(p)
+}
+
+func (ts *terminalScreen) String() string {
+	ts.Lock()
+	defer ts.Unlock()
+
+	return ts.buf.String()
+}
+
+// Player typing one line of input per question asked
+type terminalPlayer struct {
+	in    *bufio.Reader
+	asked chan struct{}
+}
+
+func (tp terminalPlayer) Read(p []byte) (int, error) {
+	select {
+	case <-tp.asked:
+	case <-time.After(5 * time.Second):
+		return 0, io.EOF
+	}
+
+	line, err := tp.in.ReadString('\n')
+	return copy(p, line), err
+}
+
+func TestTerminalTransport(t *testing.T) {
+	screen := &terminalScreen{asked: make(chan struct{}, 10)}
+	player := terminalPlayer{bufio.NewReader(strings.NewReader("サン\n  ふた  \n")), screen.asked}
+	tt := newTerminalTransport(player, screen, "")
+
+	quiz := Quiz{
+		Description: "Test deck",
+		Type:        "text",
+		Deck: []Card{
+			{Question: "q1", Answers: []string{"イチ"}},
+			{Question: "q2", Answers: []string{"に", "ふた"}},
+			{Question: "q3", Answers: []string{"さん"}},
+		},
+	}
+
+	if err := startQuiz(tt, TERMINAL_CHANNEL); err != nil {
+		t.Fatal(err)
+	}
+	g := newGame(tt, TERMINAL_CHANNEL, "test", quiz)
+	g.Timeout = 5 * time.Second
+	g.WinLimit = 2
+	if g.Ranked {
+		t.Error("Games in a terminal shouldn't be ranked")
+	}
+	g.Run()
+
+	// Nor do they count towards anybody's statistics
+	if stats := getStats(TERMINAL_PLAYER); len(stats) != 0 {
+		t.Errorf("Unexpected stats from a terminal game: %v", stats)
+	}
+
+	output := screen.String()
+
+	// Questions come from the back of the deck, without code blocks
+	if !strings.Contains(output, "\nq3\n") || !strings.Contains(output, "\nq2\n") || strings.Contains(output, "q1") {
+		t.Errorf("Expected questions q3 and q2:\n%s", output)
+	}
+
+	// Answers are trimmed and matched like on Discord, and the player is addressed directly
+	if !strings.Contains(output, "You 2p") {
+		t.Errorf("Expected both answers to be accepted:\n%s", output)
+	}
+
+	// Discord markup is stripped
+	for _, markup := range []string{"```", "**", "<@" + TERMINAL_PLAYER + ">"} {
+		if strings.Contains(output, markup) {
+			t.Errorf("Unexpected markup %s in output:\n%s", markup, output)
+		}
+	}
+}
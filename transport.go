@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Transport is how games talk to their players, so that they can be played
+// without being connected to Discord
+type Transport interface {
+	Send(cid string, msg string) *discordgo.Message                           // Send a text message
+	SendImage(cid string, text string, opts RenderOptions) *discordgo.Message // Send text drawn on an image
+	SendFile(cid string, path string) *discordgo.Message                      // Send a local image file
+	SendChoices(cid string, choices []string) *discordgo.Message              // Send lettered options to pick from
+	SendEmbed(cid string, embed *discordgo.MessageEmbed) *discordgo.Message   // Send an embedded message
+
+	// Relay messages from other users in the given channel to handler,
+	// picks of options come in as "<message ID>:<letter>"
+	// Returns a function to stop listening
+	Subscribe(cid string, handler func(m *discordgo.MessageCreate)) func()
+
+	// Show the bot as busy with status, or idle if empty
+	SetStatus(status string)
+
+	// Guild the given channel belongs to, empty for private channels
+	ChannelGuild(cid string) string
+
+	// Check whether a user is a member of the given guild
+	IsMember(guildID, userID string) bool
+
+	// Permission level of a user in the given channel
+	Permission(cid, userID string) Permission
+}
+
+// Transport using a live Discord session
+type discordTransport struct {
+	s *discordgo.Session
+}
+
+func (dt discordTransport) Send(cid string, msg string) *discordgo.Message {
+	return msgSend(dt.s, cid, msg)
+}
+
+func (dt discordTransport) SendImage(cid string, text string, opts RenderOptions) *discordgo.Message {
+	return imgSend(dt.s, cid, text, opts)
+}
+
+func (dt discordTransport) SendFile(cid string, path string) *discordgo.Message {
+	return fileSend(dt.s, cid, path)
+}
+
+func (dt discordTransport) SendEmbed(cid string, embed *discordgo.MessageEmbed) *discordgo.Message {
+	return embedSend(dt.s, cid, embed)
+}
+
+func (dt discordTransport) SendChoices(cid string, choices []string) *discordgo.Message {
+	return choicesSend(dt.s, cid, choices)
+}
+
+func (dt discordTransport) Subscribe(cid string, handler func(m *discordgo.MessageCreate)) func() {
+	removeMessages := dt.s.AddHandler(func(s *discordgo.Session, m *discordgo.MessageCreate) {
+		// Ignore all messages created by self and bots
+		if m.Author.ID == s.State.User.ID || m.Author.Bot {
+			return
+		}
+
+		// Only react on given channel
+		if m.ChannelID != cid {
+			return
+		}
+
+		handler(m)
+	})
+
+	// Button clicks on options
+	removeClicks := dt.s.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if i.Type != discordgo.InteractionMessageComponent || i.ChannelID != cid {
+			return
+		}
+
+		letter, ok := strings.CutPrefix(i.MessageComponentData().CustomID, CHOICE_BUTTON_PREFIX)
+		if !ok {
+			return
+		}
+
+		// Nothing to show for the click itself
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredMessageUpdate,
+		})
+		if err != nil {
+			log.Println("ERROR, Could not acknowledge button click:", err)
+		}
+
+		m := interactionMessage(i)
+		if m.Author == nil || m.Author.Bot {
+			return
+		}
+		m.Content = i.Message.ID + ":" + letter
+
+		handler(m)
+	})
+
+	// Reactions on options, for when buttons couldn't be sent
+	removeReactions := dt.s.AddHandler(func(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+		if r.ChannelID != cid || r.UserID == s.State.User.ID {
+			return
+		}
+
+		letter := -1
+		for i, reaction := range choiceReactions {
+			if r.Emoji.Name == reaction {
+				letter = i
+			}
+		}
+		if letter < 0 {
+			return
+		}
+
+		author := &discordgo.User{ID: r.UserID}
+		if r.Member != nil && r.Member.User != nil {
+			author = r.Member.User
+		}
+		if author.Bot {
+			return
+		}
+
+		handler(&discordgo.MessageCreate{Message: &discordgo.Message{
+			ChannelID: cid,
+			GuildID:   r.GuildID,
+			Author:    author,
+			Content:   fmt.Sprintf("%s:%c", r.MessageID, CHOICE_LETTERS[letter]),
+		}})
+	})
+
+	return func() {
+		removeMessages()
+		removeClicks()
+		removeReactions()
+	}
+}
+
+func (dt discordTransport) SetStatus(status string) {
+	err := dt.s.UpdateGameStatus(0, status)
+	if err != nil {
+		log.Println("ERROR, Could not update status:", err)
+	}
+}
+
+func (dt discordTransport) ChannelGuild(cid string) string {
+	ch, err := dt.s.State.Channel(cid)
+	if err != nil {
+		return ""
+	}
+
+	return ch.GuildID
+}
+
+func (dt discordTransport) IsMember(guildID, userID string) bool {
+	return isGuildMember(dt.s, guildID, userID)
+}
+
+func (dt discordTransport) Permission(cid, userID string) Permission {
+	return permissionLevel(dt.s, dt.ChannelGuild(cid), cid, userID)
+}
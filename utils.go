@@ -11,6 +11,7 @@ import (
 	"math/rand"
 	"net/http"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"sort"
@@ -67,6 +68,21 @@ func loadFiles() {
 	Storage.Map = make(map[string]string)
 	loadStorage()
 
+	// Initialize player statistics
+	loadStats()
+
+	// Initialize game results for leaderboards
+	loadResults()
+
+	// Initialize server settings
+	loadGuilds()
+
+	// Initialize study schedules
+	loadStudy()
+
+	// Initialize review decks
+	loadReview()
+
 	// Initialize Kanji info map
 	loadAllKanji()
 
@@ -196,6 +212,21 @@ func shuffle(slice interface{}) {
 	}
 }
 
+// Send a given message to the bot owner in Direct Message
+func ownerSend(s *discordgo.Session, msg string) {
+	if Settings.Owner == nil {
+		return
+	}
+
+	channel, err := s.UserChannelCreate(Settings.Owner.ID)
+	if err != nil {
+		log.Println("ERROR, Could not open Direct Message with owner:", err)
+		return
+	}
+
+	msgSend(s, channel.ID, msg)
+}
+
 // Send a given message to channel
 func msgSend(s *discordgo.Session, cid string, msg string) (sent *discordgo.Message) {
 
@@ -213,14 +244,18 @@ func msgSend(s *discordgo.Session, cid string, msg string) (sent *discordgo.Mess
 }
 
 // Send an image message to Discord
-func imgSend(s *discordgo.Session, cid string, word string) (sent *discordgo.Message) {
+func imgSend(s *discordgo.Session, cid string, word string, opts RenderOptions) (sent *discordgo.Message) {
 
-	image := GenerateImage(word)
+	image := Images.Get(word, opts)
+	if image == nil {
+		log.Println("ERROR, Could not draw image for:", word)
+		return
+	}
 
 	// Try thrice in case of timeouts
 	retryErr := retryOnServerError(func() error {
 		var err error
-		sent, err = s.ChannelFileSend(cid, "word.png", image)
+		sent, err = s.ChannelFileSend(cid, "word.png", bytes.NewReader(image))
 		return err
 	})
 	if retryErr != nil {
@@ -230,6 +265,71 @@ func imgSend(s *discordgo.Session, cid string, word string) (sent *discordgo.Mes
 	return
 }
 
+// Send a local file to Discord
+func fileSend(s *discordgo.Session, cid string, path string) (sent *discordgo.Message) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Println("ERROR, Could not read file to send:", err)
+		return
+	}
+
+	// Try thrice in case of timeouts
+	retryErr := retryOnServerError(func() error {
+		var err error
+		sent, err = s.ChannelFileSend(cid, filepath.Base(path), bytes.NewReader(data))
+		return err
+	})
+	if retryErr != nil {
+		log.Println("ERROR, Could not send file:", retryErr)
+	}
+
+	return
+}
+
+// Send lettered options to Discord as buttons, or with reactions to pick
+// them by if buttons can't be sent
+func choicesSend(s *discordgo.Session, cid string, choices []string) (sent *discordgo.Message) {
+
+	buttons := make([]discordgo.MessageComponent, len(choices))
+	for i := range choices {
+		letter := string(CHOICE_LETTERS[i])
+		buttons[i] = discordgo.Button{
+			Label:    strings.ToUpper(letter),
+			Style:    discordgo.SecondaryButton,
+			CustomID: CHOICE_BUTTON_PREFIX + letter,
+		}
+	}
+
+	// Try thrice in case of timeouts
+	retryErr := retryOnServerError(func() error {
+		var err error
+		sent, err = s.ChannelMessageSendComplex(cid, &discordgo.MessageSend{
+			Content:    choiceList(choices),
+			Components: []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}},
+		})
+		return err
+	})
+	if retryErr == nil {
+		return
+	}
+	log.Println("ERROR, Could not send option buttons:", retryErr)
+
+	sent = msgSend(s, cid, choiceList(choices))
+	if sent == nil {
+		return
+	}
+
+	for _, reaction := range choiceReactions[:len(choices)] {
+		if err := s.MessageReactionAdd(cid, sent.ID, reaction); err != nil {
+			log.Println("ERROR, Could not add option reaction:", err)
+			break
+		}
+	}
+
+	return
+}
+
 // Send an embedded message type to Discord
 func embedSend(s *discordgo.Session, cid string, embed *discordgo.MessageEmbed) (sent *discordgo.Message) {
 
@@ -307,13 +407,13 @@ func retryOnServerError(f func() error) (err error) {
 }
 
 // Determine if given line is a bot command
-func isBotCommand(s string) bool {
+func isBotCommand(s string, prefix string) bool {
 
-	if len(s) < len(CMD_PREFIX) {
+	if len(s) < len(prefix) {
 		return false
 	}
 
-	return s[:len(CMD_PREFIX)] == CMD_PREFIX || strings.ToLower(s[:len(CMD_PREFIX)]) == strings.ToLower(CMD_PREFIX)
+	return s[:len(prefix)] == prefix || strings.ToLower(s[:len(prefix)]) == strings.ToLower(prefix)
 }
 
 // Determine if given channel is for bot spam
@@ -324,6 +424,11 @@ func isBotChannel(s *discordgo.Session, m *discordgo.MessageCreate) bool {
 		return true
 	}
 
+	// Servers may pick their own quiz channels
+	if channels := getGuildConfig(m.GuildID).Channels; len(channels) > 0 {
+		return hasString(channels, m.ChannelID)
+	}
+
 	// Otherwise only accept #bot* channels
 	var retryErr error
 	for i := 0; i < 3; i++ {
@@ -485,7 +590,7 @@ func putStorage(key, value string) {
 // Writes Storage map as JSON to disk
 func writeStorage() {
 	Storage.RLock()
-	b, err := json.Marshal(Storage)
+	b, err := json.Marshal(&Storage)
 	Storage.RUnlock()
 	if err != nil {
 		log.Println("ERROR, Could not marshal Storage to json:", err)
@@ -555,11 +660,13 @@ func loadWordFrequency() {
 			Reading:             k2h(reading),
 		}
 
-		WordFrequencyMap[wf.Lexeme] = append(WordFrequencyMap[wf.Lexeme], wf)
+		lexeme := normalizeKana(wf.Lexeme, false)
+		WordFrequencyMap[lexeme] = append(WordFrequencyMap[lexeme], wf)
 
 		// Add standard orthonography reading if needed
-		if wf.Orthography != wf.Lexeme && wf.Orthography != "#N/A" && wf.Orthography != "＊" {
-			WordFrequencyMap[wf.Orthography] = append(WordFrequencyMap[wf.Orthography], wf)
+		orthography := normalizeKana(wf.Orthography, false)
+		if orthography != lexeme && wf.Orthography != "#N/A" && wf.Orthography != "＊" {
+			WordFrequencyMap[orthography] = append(WordFrequencyMap[orthography], wf)
 		}
 	}
 	if err := scanner.Err(); err != nil {
@@ -572,7 +679,7 @@ func sendWordFrequencyInfo(s *discordgo.Session, cid string, query string) (sent
 
 	var wfs []WordFrequency
 	var exists bool
-	if wfs, exists = WordFrequencyMap[query]; !exists {
+	if wfs, exists = WordFrequencyMap[normalizeKana(query, false)]; !exists {
 		return nil, fmt.Errorf("Word '%s' not found", query)
 	}
 
@@ -607,20 +714,29 @@ func loadPitchInfo() {
 	}
 	defer file.Close()
 
-	err = json.NewDecoder(file).Decode(&PitchMap)
+	var pitches map[string]string
+	err = json.NewDecoder(file).Decode(&pitches)
 	if err != nil {
 		log.Fatalln("ERROR, Unmarshalling pitch json:", err)
 	}
+
+	// Key by normalized words, so lookups match however they're typed
+	PitchMap = make(map[string]string, len(pitches))
+	for word, pitch := range pitches {
+		key := normalizeKana(word, false)
+		if previous, exists := PitchMap[key]; exists && previous != pitch {
+			pitch = previous + "\n" + pitch
+		}
+		PitchMap[key] = pitch
+	}
 }
 
 // Return Pitch Info loaded from local cache
 func sendPitchInfo(s *discordgo.Session, cid string, query string) (sent *discordgo.Message, err error) {
 
-	query = regexp.MustCompile(`(.)々`).ReplaceAllString(query, "$1$1")
-
 	var pitches string
 	var exists bool
-	if pitches, exists = PitchMap[strings.ToLower(k2h(query))]; !exists {
+	if pitches, exists = PitchMap[normalizeKana(query, false)]; !exists {
 		return nil, fmt.Errorf("Word '%s' not found", query)
 	}
 